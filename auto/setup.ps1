@@ -82,6 +82,7 @@ Push-Location $repoRoot
 go mod download
 go build -o ".\bin\baobun-client.exe" .\cmd\client
 go build -o ".\bin\baobun-maker.exe" .\cmd\maker
+go build -o ".\bin\baobun-tracker.exe" .\cmd\tracker
 Pop-Location
 
 Write-Host "[setup] Done."
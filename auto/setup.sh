@@ -91,6 +91,7 @@ build_project() {
   go mod download
   go build -o ./bin/baobun-client ./cmd/client
   go build -o ./bin/baobun-maker ./cmd/maker
+  go build -o ./bin/baobun-tracker ./cmd/tracker
 }
 
 install_prereqs
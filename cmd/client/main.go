@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/baoswarm/baobun/internal/api"
@@ -22,55 +27,111 @@ func main() {
 	// Set the flags for the default logger
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
-	// fmt.Println("Spinning up 3 test clients that all want file X")
-	// fmt.Println("Client with file X available will come online after you press enter.")
-
 	cwd, err := os.Getwd()
 	if err != nil {
 		fmt.Println("Error getting working directory:", err)
 		return
 	}
 
+	// `baobun-client token ...` manages API tokens instead of running a node
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := runTokenCommand(cwd, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	configPath := flag.String("config", filepath.Join(cwd, "baobun.json"), "config file (JSON); missing is fine unless given explicitly")
+	multiNode := flag.Bool("multi", false, "run every node in the config's nodes list with the seeds from seeds.json, loading ./test.bao (test harness)")
+	settingsFlags := appconfig.RegisterSettingsFlags(flag.CommandLine)
+	flag.Parse()
+
+	explicitConfig := false
+	flag.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+
+	settings, err := appconfig.LoadSettings(*configPath, explicitConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	settingsFlags.Apply(&settings)
+	if err := settings.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	settingsStore := appconfig.NewSettingsStore(*configPath, settings)
+
 	seedStore, err := appconfig.NewSeedStore(filepath.Join(cwd, "seeds.json"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	seeds := seedStore.Seeds()
 
-	core0 := LaunchCore(filepath.Join(cwd, "downloads_0"), seeds[0], true)
-	go LaunchWebApp(core0, seedStore, ":8880")
-	core1 := LaunchCore(filepath.Join(cwd, "downloads_1"), seeds[1], true)
-	go LaunchWebApp(core1, seedStore, ":8881")
-	core2 := LaunchCore(filepath.Join(cwd, "downloads_2"), seeds[2], true)
-	go LaunchWebApp(core2, seedStore, ":8882")
-	core := LaunchCore(filepath.Join(cwd, "downloads"), seeds[3], true)
-	go LaunchWebApp(core, seedStore, ":8888")
+	var clients []*core.Client
+	var servers []*http.Server
+
+	if *multiNode {
+		seeds := seedStore.Seeds()
+		if len(settings.Nodes) == 0 || len(settings.Nodes) > len(seeds) {
+			log.Fatalf("invalid config: multi-node mode needs 1 to %d nodes, got %d", len(seeds), len(settings.Nodes))
+		}
+
+		for i, node := range settings.Nodes {
+			node.DataDir = resolvePath(cwd, node.DataDir)
+			client := LaunchCore(settings, node.DataDir, seeds[i], true)
+			clients = append(clients, client)
+			servers = append(servers, LaunchWebApp(client, seedStore, settingsStore, node))
+		}
+	} else {
+		dataDir := resolvePath(cwd, settings.DataDir)
+		identity := resolvePath(cwd, settings.IdentityFile())
+		seed, created, err := appconfig.LoadOrCreateSeedFile(identity)
+		if err != nil {
+			log.Fatalf("failed to load identity: %v", err)
+		}
+		if created {
+			log.Printf("Generated a new identity in %s", identity)
+		}
 
-	// Setup signal handling
-	// sigs := make(chan os.Signal, 1)
-	// signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		client := LaunchCore(settings, dataDir, seed, false)
+		clients = append(clients, client)
+		servers = append(servers, LaunchWebApp(client, seedStore, settingsStore, appconfig.NodeSettings{
+			Listen:  settings.Listen,
+			DataDir: dataDir,
+		}))
+	}
 
-	// go func() {
-	// 	<-sigs
-	// 	fmt.Println("Shutting down gracefully...")
+	// ---------------- Shutdown ----------------
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+	log.Println("Shutting down gracefully...")
 
-	// 	core0.Transport.Close()
-	// 	core1.Transport.Close()
-	// 	core2.Transport.Close()
-	// 	core.Transport.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), appconfig.ShutdownTimeout)
+	defer cancel()
 
-	// 	os.Exit(0)
-	// }()
+	for _, server := range servers {
+		_ = server.Shutdown(ctx)
+	}
 
-	// defer core0.Transport.Close()
-	// defer core1.Transport.Close()
-	// defer core2.Transport.Close()
-	// defer core.Transport.Close()
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *core.Client) {
+			defer wg.Done()
+			client.Close(ctx)
+		}(client)
+	}
+	wg.Wait()
+}
 
-	select {} // block forever
+// resolvePath makes a relative path from the config relative to cwd.
+func resolvePath(cwd string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cwd, path)
 }
 
-func LaunchCore(downloadsLocation string, seed string, loadTest bool) *core.Client {
+func LaunchCore(settings appconfig.Settings, downloadsLocation string, seed string, loadTest bool) *core.Client {
 	// ---------------- Identity ----------------
 	account, err := nkn.NewAccount([]byte(seed))
 	if err != nil {
@@ -81,10 +142,10 @@ func LaunchCore(downloadsLocation string, seed string, loadTest bool) *core.Clie
 		account,
 		"bao",
 		&nkn.ClientConfig{
-			MultiClientNumClients:     4,
+			MultiClientNumClients:     settings.MultiClientNumClients,
 			MultiClientOriginalClient: true,
 			WebRTC:                    false,
-			SeedRPCServerAddr:         nkn.NewStringArray("http://85.215.219.214:30003"),
+			SeedRPCServerAddr:         nkn.NewStringArray(settings.SeedRPCServers...),
 		},
 	)
 	if err != nil {
@@ -97,6 +158,30 @@ func LaunchCore(downloadsLocation string, seed string, loadTest bool) *core.Clie
 	// ---------------- Core client ----------------
 	coreClient := core.NewClient(client.Address(), transport, transport.Sessions)
 
+	// ---------------- DHT ----------------
+	dht := core.NewDHT(protocol.NodeKey(client.Address()), transport.Sessions)
+	coreClient.AddDiscovery("dht", dht)
+	go bootstrapDHT(dht, filepath.Join(downloadsLocation, ".baobun", "dht_nodes.json"))
+
+	// ---------------- Restore swarms ----------------
+	stateStore := core.NewStateStore(filepath.Join(downloadsLocation, ".baobun", "state.json"))
+	restored, err := coreClient.RestoreState(stateStore)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, ih := range restored {
+		go coreClient.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+	}
+	log.Printf("Restored %d swarms from %s", len(restored), stateStore.Path())
+
+	// Transfer totals change too often to save on every unit
+	stateTicker := time.NewTicker(appconfig.StateSaveInterval)
+	go func() {
+		for range stateTicker.C {
+			coreClient.SaveState()
+		}
+	}()
+
 	// ---------------- Load .bao ----------------
 	if loadTest {
 		ih, err := coreClient.ImportBao(
@@ -118,6 +203,22 @@ func LaunchCore(downloadsLocation string, seed string, loadTest bool) *core.Clie
 		)
 	}
 
+	// Peer exchange keeps swarms growing when trackers are unreachable
+	pexTicker := time.NewTicker(appconfig.PexInterval / 4)
+	go func() {
+		for range pexTicker.C {
+			coreClient.ExchangePeers()
+		}
+	}()
+
+	// Bandwidth schedules switch limits at minute boundaries
+	scheduleTicker := time.NewTicker(time.Minute)
+	go func() {
+		for now := range scheduleTicker.C {
+			coreClient.ApplyBandwidthSchedule(now)
+		}
+	}()
+
 	//TODO: stagger or find some way to avoid this being a massive burst of announcements
 	reannounceTicker := time.NewTicker(time.Second * 10)
 	go func() {
@@ -133,27 +234,104 @@ func LaunchCore(downloadsLocation string, seed string, loadTest bool) *core.Clie
 	return coreClient
 }
 
-func LaunchWebApp(core *core.Client, seedStore *appconfig.SeedStore, addr string) {
+// bootstrapDHT joins the DHT through the nodes saved last run and any listed
+// in the environment, then keeps the saved node list current.
+func bootstrapDHT(dht *core.DHT, nodesPath string) {
+	nodes, err := core.LoadDHTNodes(nodesPath)
+	if err != nil {
+		log.Printf("failed to load dht nodes: %v", err)
+	}
+	for _, node := range appconfig.DHTBootstrapNodes() {
+		nodes = append(nodes, protocol.NodeKey(node))
+	}
+
+	dht.Bootstrap(context.Background(), nodes)
+
+	ticker := time.NewTicker(appconfig.DHTAnnounceInterval)
+	for range ticker.C {
+		if err := dht.SaveNodes(nodesPath); err != nil {
+			log.Printf("failed to save dht nodes: %v", err)
+		}
+	}
+}
+
+// LaunchWebApp serves the web UI and API for one client in the background.
+func LaunchWebApp(core *core.Client, seedStore *appconfig.SeedStore, settingsStore *appconfig.SettingsStore, node appconfig.NodeSettings) *http.Server {
 	apiAdapter := api.NewAdapter(core)
-	apiServer := api.NewServer(apiAdapter, core, seedStore)
+	apiServer := api.NewServer(apiAdapter, core, seedStore, settingsStore, node.DataDir)
+	useTLS := settingsStore.Settings().TLS
+
+	tokens, err := api.NewTokenStore(api.TokenStorePath(node.DataDir))
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := tokens.Bootstrap("admin")
+	if err != nil {
+		log.Fatalf("failed to create the first API token: %v", err)
+	}
+	if token != "" {
+		log.Printf("Created admin API token \"admin\" in %s. Log in to %s with it; it is not shown again:\n\n    %s\n", tokens.Path(), node.Listen, token)
+	}
+	auth := api.NewAuth(tokens, useTLS)
 
 	mux := http.NewServeMux()
 
+	// Auth
+	mux.HandleFunc("/api/v1/auth/login", auth.HandleLogin)
+	mux.HandleFunc("/api/v1/auth/logout", auth.HandleLogout)
+	mux.HandleFunc("/api/v1/auth/session", auth.HandleSession)
+
 	// API
 	mux.HandleFunc("/api/v1/baos", apiServer.HandleBaos)
 	mux.HandleFunc("/api/v1/bao", apiServer.UploadBao)
+	mux.HandleFunc("GET /api/v1/baos/{id}", apiServer.HandleBao)
+	mux.HandleFunc("GET /api/v1/baos/{id}/content", apiServer.ServeBaoContent)
 	mux.HandleFunc("/api/v1/baos/actions/pause", apiServer.PauseBaos)
+	mux.HandleFunc("/api/v1/baos/actions/resume", apiServer.ResumeBaos)
+	mux.HandleFunc("/api/v1/baos/actions/strategy", apiServer.SetBaoStrategy)
+	mux.HandleFunc("/api/v1/baos/actions/limits", apiServer.SetBaoLimits)
+	mux.HandleFunc("/api/v1/baos/actions/queue", apiServer.MoveBaos)
 	mux.HandleFunc("/api/v1/baos/actions/archive", apiServer.ArchiveBaos)
 	mux.HandleFunc("/api/v1/baos/actions/delete", apiServer.DeleteBaos)
 	mux.HandleFunc("/api/v1/baos/actions/hide", apiServer.HideBaos)
 	mux.HandleFunc("/api/v1/baos/hidden/count", apiServer.HiddenCount)
 	mux.HandleFunc("/api/v1/baos/hidden/unhide", apiServer.UnhideBaos)
+	mux.HandleFunc("/api/v1/config", apiServer.HandleConfig)
 	mux.HandleFunc("/api/v1/config/seeds", apiServer.HandleSeedConfig)
 	mux.HandleFunc("/api/v1/config/seeds/generate", apiServer.GenerateSeedConfig)
+	mux.HandleFunc("/api/v1/config/limits", apiServer.HandleBandwidthLimits)
+	mux.HandleFunc("/api/v1/config/queue", apiServer.HandleQueueConfig)
+	mux.HandleFunc("/api/v1/events", apiServer.HandleEvents)
 
 	// UI
 	mux.Handle("/", webui.Handler())
 
-	log.Println("listening on", addr)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	server := &http.Server{Addr: node.Listen, Handler: auth.Middleware(mux)}
+	server.RegisterOnShutdown(apiServer.CloseStreams)
+
+	if !useTLS {
+		go func() {
+			log.Println("listening on", node.Listen)
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		return server
+	}
+
+	certFile, keyFile := api.TLSPaths(node.DataDir)
+	created, err := api.LoadOrCreateCertificate(certFile, keyFile, node.Listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if created {
+		log.Printf("Generated a self-signed TLS certificate in %s", certFile)
+	}
+	go func() {
+		log.Println("listening with TLS on", node.Listen)
+		if err := server.ListenAndServeTLS(certFile, keyFile); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	return server
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/baoswarm/baobun/internal/api"
+	appconfig "github.com/baoswarm/baobun/internal/config"
+)
+
+const tokenUsage = `usage:
+  baobun-client token add [-scope read|admin] <name>
+  baobun-client token list
+  baobun-client token revoke <name>
+Every subcommand also takes -config and -data-dir to pick the client.`
+
+// runTokenCommand manages the API tokens of the client whose data dir the
+// config, environment and flags select. A running client picks up changes
+// at once.
+func runTokenCommand(cwd string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(tokenUsage)
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("token "+command, flag.ContinueOnError)
+	configPath := fs.String("config", filepath.Join(cwd, "baobun.json"), "config file (JSON)")
+	dataDir := fs.String("data-dir", "", "data dir of the client (default from the config)")
+	scopeName := fs.String("scope", string(api.ScopeRead), "add: what the token may do, read or admin")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	explicitConfig := false
+	fs.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+	settings, err := appconfig.LoadSettings(*configPath, explicitConfig)
+	if err != nil {
+		return err
+	}
+	if *dataDir != "" {
+		settings.DataDir = *dataDir
+	}
+
+	store, err := api.NewTokenStore(api.TokenStorePath(resolvePath(cwd, settings.DataDir)))
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "add":
+		if fs.NArg() != 1 {
+			return errors.New(tokenUsage)
+		}
+		scope, err := api.ParseScope(*scopeName)
+		if err != nil {
+			return err
+		}
+		token, err := store.Add(fs.Arg(0), scope)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Created %s token %q in %s. It is not shown again:\n", scope, fs.Arg(0), store.Path())
+		fmt.Println(token)
+
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPE\tCREATED")
+		for _, token := range store.List() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", token.Name, token.Scope, token.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+
+	case "revoke":
+		if fs.NArg() != 1 {
+			return errors.New(tokenUsage)
+		}
+		revoked, err := store.Revoke(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return fmt.Errorf("no token named %q in %s", fs.Arg(0), store.Path())
+		}
+		fmt.Fprintf(os.Stderr, "Revoked token %q.\n", fs.Arg(0))
+
+	default:
+		return errors.New(tokenUsage)
+	}
+	return nil
+}
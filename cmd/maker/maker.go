@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -8,9 +10,36 @@ import (
 
 	appconfig "github.com/baoswarm/baobun/internal/config"
 	"github.com/baoswarm/baobun/internal/core"
+	"github.com/nknorg/nkn-sdk-go"
 )
 
 func main() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	configPath := flag.String("config", filepath.Join(cwd, "baobun.json"), "client config file (JSON) naming the identity and transfer unit size")
+	dataDir := flag.String("data-dir", "", "data dir of the client to sign as (default from the config)")
+	seedPath := flag.String("seed-file", "", "sign with the seed in this file instead of the client identity (created if missing)")
+	seedIndex := flag.Int("seed-index", -1, "sign with this seed from seeds.json, as a multi-node client does")
+	unsigned := flag.Bool("unsigned", false, "do not sign the .bao file")
+	flag.Parse()
+
+	explicitConfig := false
+	flag.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+	settings, err := appconfig.LoadSettings(*configPath, explicitConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dataDir != "" {
+		settings.DataDir = *dataDir
+	}
+	if err := settings.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	settings.Apply()
+
 	trackers := append([]string(nil), appconfig.DefaultTrackers...)
 
 	inputPath, outputPath, err := resolvePaths()
@@ -18,11 +47,32 @@ func main() {
 		log.Fatal(err)
 	}
 
-	file, err := core.CreateFromFile(inputPath, trackers)
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var file *core.BaoFile
+	if info.IsDir() {
+		file, err = core.CreateFromDirectory(inputPath, trackers)
+	} else {
+		file, err = core.CreateFromFile(inputPath, trackers)
+	}
 	if err != nil {
 		log.Fatalf("failed to create .bao from %s: %v", inputPath, err)
 	}
 
+	if !*unsigned {
+		seed, err := publisherSeed(cwd, settings, *seedPath, *seedIndex)
+		if err != nil {
+			log.Fatalf("failed to load publisher identity: %v", err)
+		}
+		if err := signFile(file, seed); err != nil {
+			log.Fatalf("failed to sign .bao file: %v", err)
+		}
+		log.Printf("Signed as publisher %s", file.Publisher)
+	}
+
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		log.Fatalf("failed to create output directory: %v", err)
 	}
@@ -34,7 +84,66 @@ func main() {
 	log.Printf("Saved .bao file: %s", outputPath)
 }
 
+// publisherSeed picks the identity to sign with: the client's own identity
+// by default, so the publisher key matches its bao.<pubkey> address, or the
+// seed file or seeds.json entry asked for.
+func publisherSeed(cwd string, settings appconfig.Settings, seedPath string, seedIndex int) (string, error) {
+	if seedPath != "" && seedIndex >= 0 {
+		return "", fmt.Errorf("-seed-file and -seed-index cannot be used together")
+	}
+
+	if seedIndex >= 0 {
+		store, err := appconfig.NewSeedStore(filepath.Join(cwd, "seeds.json"))
+		if err != nil {
+			return "", err
+		}
+		seeds := store.Seeds()
+		if seedIndex >= len(seeds) {
+			return "", fmt.Errorf("seeds.json has %d seeds, no seed %d", len(seeds), seedIndex)
+		}
+		return seeds[seedIndex], nil
+	}
+
+	if seedPath == "" {
+		seedPath = settings.IdentityFile()
+	}
+	if !filepath.IsAbs(seedPath) {
+		seedPath = filepath.Join(cwd, seedPath)
+	}
+
+	seed, created, err := appconfig.LoadOrCreateSeedFile(seedPath)
+	if err != nil {
+		return "", err
+	}
+	if created {
+		log.Printf("Generated a new identity in %s", seedPath)
+	}
+	return seed, nil
+}
+
+// signFile signs the bao with the NKN account derived from seed, so the
+// publisher key matches that identity's NKN address.
+func signFile(file *core.BaoFile, seed string) error {
+	account, err := nkn.NewAccount([]byte(seed))
+	if err != nil {
+		return fmt.Errorf("failed to create account: %w", err)
+	}
+
+	return file.Sign(ed25519.PrivateKey(account.PrivKey()))
+}
+
+// resolvePaths takes the input file or directory and the output path from
+// the command line, falling back to the bundled test video.
 func resolvePaths() (string, string, error) {
+	if flag.NArg() > 0 {
+		input := filepath.Clean(flag.Arg(0))
+		output := filepath.Base(input) + ".bao"
+		if flag.NArg() > 1 {
+			output = filepath.Clean(flag.Arg(1))
+		}
+		return input, output, nil
+	}
+
 	candidates := []struct {
 		input  string
 		output string
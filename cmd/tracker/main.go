@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	appconfig "github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	nkntransport "github.com/baoswarm/baobun/internal/transport/nkn"
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+func main() {
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	seedPath := flag.String("seed-file", "tracker_seed.txt", "file holding the tracker identity seed (created if missing)")
+	seedRPC := flag.String("seed-rpc", "http://85.215.219.214:30003", "NKN seed RPC server address")
+	interval := flag.Duration("interval", tracker.DefaultInterval, "announce interval returned to clients")
+	peerTTL := flag.Duration("peer-ttl", 0, "how long a peer stays listed without announcing (default 3x interval)")
+	maxPeers := flag.Int("max-peers", tracker.DefaultMaxPeers, "maximum peers returned per announce")
+	flag.Parse()
+
+	seed, created, err := appconfig.LoadOrCreateSeedFile(*seedPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if created {
+		log.Printf("Generated new tracker identity in %s", *seedPath)
+	}
+
+	account, err := nkn.NewAccount([]byte(seed))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := nkn.NewMultiClientV2(
+		account,
+		"bao",
+		&nkn.ClientConfig{
+			MultiClientNumClients:     4,
+			MultiClientOriginalClient: true,
+			WebRTC:                    false,
+			SeedRPCServerAddr:         nkn.NewStringArray(*seedRPC),
+		},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	t := tracker.New(tracker.Config{
+		Interval: *interval,
+		PeerTTL:  *peerTTL,
+		MaxPeers: *maxPeers,
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go t.RunExpiry(stop)
+
+	nkntransport.ServeTracker(client, t)
+}
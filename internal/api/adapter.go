@@ -3,7 +3,9 @@ package api
 
 import (
 	"fmt"
+	"time"
 
+	appconfig "github.com/baoswarm/baobun/internal/config"
 	"github.com/baoswarm/baobun/internal/core"
 )
 
@@ -16,89 +18,189 @@ func NewAdapter(c *core.Client) *Adapter {
 }
 
 func (a *Adapter) Baos() []BaoStatus {
-	coreBaos := a.client.Swarms
+	coreBaos := a.client.Swarms.All()
 
 	out := make([]BaoStatus, 0, len(coreBaos))
 	for _, t := range coreBaos {
-		remaining := t.CalcLeft()
-		downloaded := t.File.Length - remaining
-		uploaded := t.Uploaded
+		out = append(out, a.status(t))
+	}
 
-		ratio := 0.0
-		if downloaded > 0 {
-			ratio = float64(uploaded) / float64(downloaded)
-		}
+	return out
+}
 
-		downrate := uint32(0)
-		uprate := uint32(0)
-
-		record := BaoStatus{
-			ID:         fmt.Sprintf("%x", t.InfoHash),
-			Name:       t.File.Name,
-			DownRate:   uint32(downrate),
-			UpRate:     uint32(uprate),
-			Downloaded: downloaded,
-			Uploaded:   uploaded,
-			Ratio:      ratio,
-			Peers:      make([]PeerStatus, 0),
-			State:      mapState(a.client, t),
-			FileSize:   t.File.Length,
-			Remaining:  remaining,
-			Files: []FileStatus{
-				{
-					Path:      t.File.Name,
-					Length:    t.File.Length,
-					Remaining: remaining,
-				},
-			},
-		}
+func (a *Adapter) status(t *core.Swarm) BaoStatus {
+	remaining := t.CalcLeft()
+	downloaded := t.File.Length - remaining
+	uploaded := t.Uploaded.Load()
 
-		for _, p := range t.Peers {
-			peerstatus := PeerStatus{
-				ID:       string(p.Peer),
-				DownRate: p.UploadRate(), //flipped because if a peer is uploading to us, we are downloading.
-				UpRate:   p.DownloadRate(),
-			}
-
-			downrate += peerstatus.DownRate
-			uprate += peerstatus.UpRate
-
-			switch p.GetState() {
-			case 0:
-				peerstatus.State = "connecting"
-			case 1:
-				peerstatus.State = "handshake"
-			case 2:
-				peerstatus.State = "active"
-			case 3:
-				peerstatus.State = "closed"
-			}
-
-			record.Peers = append(record.Peers, peerstatus)
-		}
+	ratio := 0.0
+	if downloaded > 0 {
+		ratio = float64(uploaded) / float64(downloaded)
+	}
+
+	record := BaoStatus{
+		ID:         fmt.Sprintf("%x", t.InfoHash),
+		Name:       t.File.Name,
+		Downloaded: downloaded,
+		Uploaded:   uploaded,
+		Ratio:      ratio,
+		Peers:      make([]PeerStatus, 0),
+		State:      mapState(a.client, t),
+		FileSize:   t.File.Length,
+		Remaining:  remaining,
+		Strategy:   string(t.TransferUnitManager.Strategy()),
+
+		PlaybackPosition: t.TransferUnitManager.PlaybackPosition(),
+		Publisher:        t.File.Publisher,
+		URI:              t.File.URI().String(),
+		Files:            make([]FileStatus, 0, 1),
+	}
+
+	var offset uint64
+	for _, entry := range t.File.FileEntries() {
+		record.Files = append(record.Files, FileStatus{
+			Path:      entry.Path,
+			Length:    entry.Length,
+			Remaining: t.CalcLeftRange(offset, entry.Length),
+		})
+		offset += entry.Length
+	}
+
+	record.UploadLimit, record.DownloadLimit = t.BandwidthLimit()
+	record.QueuePosition = a.client.QueuePosition(t.InfoHash)
+
+	for _, p := range t.Handlers() {
+		peerstatus := peerStatus(p)
+		record.DownRate += peerstatus.DownRate
+		record.UpRate += peerstatus.UpRate
+		record.Peers = append(record.Peers, peerstatus)
+	}
+
+	return record
+}
+
+func peerStatus(p *core.PeerHandler) PeerStatus {
+	peerstatus := PeerStatus{
+		ID:       string(p.Peer),
+		DownRate: p.UploadRate(), //flipped because if a peer is uploading to us, we are downloading.
+		UpRate:   p.DownloadRate(),
+	}
 
-		record.DownRate = downrate
-		record.UpRate = uprate
+	choke := p.ChokeState()
+	peerstatus.Choking = choke.AmChoking
+	peerstatus.Choked = choke.PeerChoking
+	peerstatus.Interested = choke.AmInterested
+	peerstatus.PeerInterested = choke.PeerInterested
+
+	switch p.GetState() {
+	case 0:
+		peerstatus.State = "connecting"
+	case 1:
+		peerstatus.State = "handshake"
+	case 2:
+		peerstatus.State = "active"
+	case 3:
+		peerstatus.State = "closed"
+	}
+
+	return peerstatus
+}
+
+// Detail returns the swarm's status together with its unit map, outstanding
+// requests and per-peer statistics.
+func (a *Adapter) Detail(t *core.Swarm) BaoDetail {
+	now := time.Now()
+	detail := t.Detail()
+
+	out := BaoDetail{
+		BaoStatus:       a.status(t),
+		UnitCount:       detail.UnitCount,
+		UnitSize:        appconfig.TransferUnitSize,
+		Have:            detail.Have.Bytes(),
+		HaveCount:       detail.Have.Count(),
+		Advertised:      detail.Advertised.Bytes(),
+		AdvertisedCount: detail.Advertised.Count(),
+		Proven:          detail.Proven.Bytes(),
+		ProvenCount:     detail.Proven.Count(),
+		Availability:    detail.Availability,
+		Requests:        make([]RequestStatus, 0, len(detail.Requests)),
+		Peers:           make([]PeerDetail, 0, len(detail.Peers)),
+	}
 
-		out = append(out, record)
+	for _, req := range detail.Requests {
+		out.Requests = append(out.Requests, RequestStatus{
+			Unit:      req.Unit,
+			Peer:      string(req.Peer),
+			SentAt:    req.SentAt.UnixMilli(),
+			Age:       now.Sub(req.SentAt).Milliseconds(),
+			Attempts:  req.Attempts,
+			Duplicate: req.Duplicate,
+		})
+	}
+
+	statuses := make(map[string]PeerStatus, len(out.BaoStatus.Peers))
+	for _, status := range out.BaoStatus.Peers {
+		statuses[status.ID] = status
+	}
+	for _, peer := range detail.Peers {
+		record := PeerDetail{
+			PeerStatus:  statuses[string(peer.Peer)],
+			Uploaded:    peer.Uploaded,
+			Downloaded:  peer.Downloaded,
+			Units:       peer.Units,
+			Outstanding: peer.Outstanding,
+		}
+		record.ID = string(peer.Peer)
+		if detail.UnitCount > 0 {
+			record.Completion = float64(peer.Units) / float64(detail.UnitCount)
+		}
+		if !peer.ConnectedAt.IsZero() {
+			record.ConnectedFor = now.Sub(peer.ConnectedAt).Milliseconds()
+		}
+		out.Peers = append(out.Peers, record)
 	}
 
 	return out
 }
 
+// Progress returns the swarm's transfer totals and current rates.
+func (a *Adapter) Progress(t *core.Swarm) BaoProgress {
+	remaining := t.CalcLeft()
+	progress := BaoProgress{
+		Downloaded: t.File.Length - remaining,
+		Uploaded:   t.Uploaded.Load(),
+		Remaining:  remaining,
+		FileSize:   t.File.Length,
+	}
+	for _, p := range t.Handlers() {
+		progress.DownRate += p.UploadRate() // flipped, as in Baos
+		progress.UpRate += p.DownloadRate()
+	}
+	return progress
+}
+
+// State returns the swarm's state as shown in a BaoStatus.
+func (a *Adapter) State(t *core.Swarm) BaoState {
+	return mapState(a.client, t)
+}
+
 func mapState(client *core.Client, s *core.Swarm) BaoState {
 	if client.IsPaused(s.InfoHash) {
 		return StatePaused
 	}
+	if client.IsQueued(s.InfoHash) {
+		return StateQueued
+	}
 
 	left := s.CalcLeft()
-	if left == 0 && len(s.Peers) > 0 {
+	peers := s.PeerCount()
+	if left == 0 && peers > 0 {
 		return "seeding"
 	}
 	if left == 0 {
 		return StateStopped
 	}
-	if len(s.Peers) == 0 {
+	if peers == 0 {
 		return StateStopped
 	}
 	return "downloading"
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	appconfig "github.com/baoswarm/baobun/internal/config"
+)
+
+const (
+	sessionCookie = "baobun_session"
+	authPrefix    = "/api/v1/auth/"
+)
+
+// Auth guards the API. Requests need a token from the TokenStore, sent as
+// "Authorization: Bearer <token>" or through the session cookie set by
+// POST /api/v1/auth/login. Unsafe cross-origin browser requests are refused
+// whatever their credentials.
+type Auth struct {
+	tokens *TokenStore
+	// Served over TLS, so session cookies are marked Secure
+	secure bool
+
+	mu       sync.Mutex
+	sessions map[string]authSession
+}
+
+type authSession struct {
+	// Hash of the token the session was opened with, so revoking it ends
+	// the session even if a new token takes the same name
+	tokenHash string
+	expires   time.Time
+}
+
+func NewAuth(tokens *TokenStore, secure bool) *Auth {
+	return &Auth{
+		tokens:   tokens,
+		secure:   secure,
+		sessions: make(map[string]authSession),
+	}
+}
+
+// Middleware wraps the whole mux: /api/ paths other than the auth endpoints
+// are checked against the caller's token, and every path is protected
+// against cross-site request forgery.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	csrf := http.NewCrossOriginProtection()
+
+	return csrf.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, authPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := a.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="baobun"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !token.Scope.Allows(requiredScope(r)) {
+			http.Error(w, "token scope does not allow this request", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// HandleLogin opens a session for the token in a LoginRequest and sets the
+// session cookie, so the web UI and its event stream need no headers.
+func (a *Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, ok := a.tokens.Lookup(strings.TrimSpace(req.Token))
+	if !ok {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expires := time.Now().Add(appconfig.SessionLifetime)
+
+	a.mu.Lock()
+	a.pruneSessionsLocked(time.Now())
+	a.sessions[id] = authSession{tokenHash: token.hash, expires: expires}
+	a.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   a.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	a.writeStatus(w, token, true)
+}
+
+// HandleLogout ends the caller's session.
+func (a *Auth) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		a.mu.Lock()
+		delete(a.sessions, cookie.Value)
+		a.mu.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   a.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	a.writeStatus(w, TokenInfo{}, false)
+}
+
+// HandleSession tells the web UI whether it has to log in, and as whom.
+func (a *Auth) HandleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := a.authenticate(r)
+	a.writeStatus(w, token, ok)
+}
+
+func (a *Auth) writeStatus(w http.ResponseWriter, token TokenInfo, authenticated bool) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AuthStatus{
+		Required:      true,
+		Authenticated: authenticated,
+		Name:          token.Name,
+		Scope:         token.Scope,
+	})
+}
+
+// authenticate returns the token behind the request's bearer token or
+// session. Sessions end when their token is revoked.
+func (a *Auth) authenticate(r *http.Request) (TokenInfo, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return TokenInfo{}, false
+		}
+		return a.tokens.Lookup(strings.TrimSpace(token))
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return TokenInfo{}, false
+	}
+
+	a.mu.Lock()
+	session, ok := a.sessions[cookie.Value]
+	if ok && time.Now().After(session.expires) {
+		delete(a.sessions, cookie.Value)
+		ok = false
+	}
+	a.mu.Unlock()
+	if !ok {
+		return TokenInfo{}, false
+	}
+
+	return a.tokens.lookupHash(session.tokenHash)
+}
+
+func (a *Auth) pruneSessionsLocked(now time.Time) {
+	for id, session := range a.sessions {
+		if now.After(session.expires) {
+			delete(a.sessions, id)
+		}
+	}
+}
+
+// requiredScope is the scope a request needs: admin for anything that
+// changes state, and for the identity seeds, which are secrets.
+func requiredScope(r *http.Request) Scope {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return ScopeAdmin
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/v1/config/seeds") {
+		return ScopeAdmin
+	}
+	return ScopeRead
+}
+
+func newSessionID() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate session: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func isLoopbackName(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
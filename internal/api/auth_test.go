@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestAuth returns an Auth in front of a handler that answers 200, and
+// the store its tokens are kept in.
+func newTestAuth(t *testing.T) (http.Handler, *TokenStore) {
+	t.Helper()
+
+	store, err := NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("token store: %v", err)
+	}
+	auth := NewAuth(store, false)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/auth/login", auth.HandleLogin)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return auth.Middleware(mux), store
+}
+
+func addToken(t *testing.T, store *TokenStore, name string, scope Scope) string {
+	t.Helper()
+
+	token, err := store.Add(name, scope)
+	if err != nil {
+		t.Fatalf("add token %q: %v", name, err)
+	}
+	return token
+}
+
+// serve sends a request through handler. A token starting with "cookie="
+// is sent as the session cookie, anything else as a bearer token.
+func serve(handler http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if value, ok := strings.CutPrefix(token, "cookie="); ok {
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	} else if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func login(t *testing.T, handler http.Handler, token string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"token":"`+token+`"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: got %d", rec.Code)
+	}
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			return "cookie=" + cookie.Value
+		}
+	}
+	t.Fatalf("login did not set the session cookie")
+	return ""
+}
+
+func expectCode(t *testing.T, rec *httptest.ResponseRecorder, want int, what string) {
+	t.Helper()
+
+	if rec.Code != want {
+		t.Fatalf("%s: got %d, want %d", what, rec.Code, want)
+	}
+}
+
+func TestAuthReadScope(t *testing.T) {
+	handler, store := newTestAuth(t)
+	read := addToken(t, store, "viewer", ScopeRead)
+	admin := addToken(t, store, "admin", ScopeAdmin)
+
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", read), http.StatusOK, "read token GET")
+	expectCode(t, serve(handler, http.MethodPost, "/api/v1/swarms", read), http.StatusForbidden, "read token POST")
+	expectCode(t, serve(handler, http.MethodDelete, "/api/v1/swarms/abc", read), http.StatusForbidden, "read token DELETE")
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/config/seeds", read), http.StatusForbidden, "read token seeds")
+
+	expectCode(t, serve(handler, http.MethodPost, "/api/v1/swarms", admin), http.StatusOK, "admin token POST")
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/config/seeds", admin), http.StatusOK, "admin token seeds")
+}
+
+func TestAuthRejectsMissingOrBadToken(t *testing.T) {
+	handler, store := newTestAuth(t)
+	addToken(t, store, "admin", ScopeAdmin)
+
+	rec := serve(handler, http.MethodGet, "/api/v1/swarms", "")
+	expectCode(t, rec, http.StatusUnauthorized, "no token")
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("401 should carry a WWW-Authenticate challenge")
+	}
+
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", "bao_wrong"), http.StatusUnauthorized, "bad token")
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", "cookie=unknown"), http.StatusUnauthorized, "unknown session")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/swarms", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	expectCode(t, rec, http.StatusUnauthorized, "basic auth")
+
+	// The web UI itself loads without a token.
+	expectCode(t, serve(handler, http.MethodGet, "/", ""), http.StatusOK, "web UI")
+}
+
+func TestAuthSessionEndsOnRevoke(t *testing.T) {
+	handler, store := newTestAuth(t)
+	token := addToken(t, store, "alice", ScopeAdmin)
+
+	session := login(t, handler, token)
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", session), http.StatusOK, "session")
+
+	if ok, err := store.Revoke("alice"); err != nil || !ok {
+		t.Fatalf("revoke: %v %v", ok, err)
+	}
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", session), http.StatusUnauthorized, "session after revoke")
+
+	// A new token under the same name does not bring the old session back.
+	addToken(t, store, "alice", ScopeAdmin)
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", session), http.StatusUnauthorized, "session after re-adding the name")
+}
+
+func TestAuthRefusesCrossOriginPost(t *testing.T) {
+	handler, store := newTestAuth(t)
+	admin := addToken(t, store, "admin", ScopeAdmin)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/swarms", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	expectCode(t, rec, http.StatusForbidden, "cross-site POST")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/swarms", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	req.Header.Set("Origin", "https://evil.example")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	expectCode(t, rec, http.StatusForbidden, "foreign Origin POST")
+}
+
+func TestAuthPicksUpTokensAddedByCLI(t *testing.T) {
+	handler, store := newTestAuth(t)
+	addToken(t, store, "admin", ScopeAdmin)
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", ""), http.StatusUnauthorized, "before add")
+
+	// `baobun-client token add` opens the same file from another process.
+	cli, err := NewTokenStore(store.Path())
+	if err != nil {
+		t.Fatalf("cli token store: %v", err)
+	}
+	token := addToken(t, cli, "cli", ScopeRead)
+
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", token), http.StatusOK, "token added by the CLI")
+
+	if _, err := cli.Revoke("cli"); err != nil {
+		t.Fatalf("cli revoke: %v", err)
+	}
+	expectCode(t, serve(handler, http.MethodGet, "/api/v1/swarms", token), http.StatusUnauthorized, "token revoked by the CLI")
+}
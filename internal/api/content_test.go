@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appconfig "github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/core"
+)
+
+// newPartialContentServer serves a four unit bao of which only units 0 and
+// 1 are downloaded. It returns the handler, the bao's id and its content.
+func newPartialContentServer(t *testing.T) (http.Handler, string, []byte) {
+	t.Helper()
+
+	unitSize := appconfig.TransferUnitSize
+	content := make([]byte, unitSize*3+100)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	source := filepath.Join(t.TempDir(), "movie.bin")
+	if err := os.WriteFile(source, content, 0644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	file, err := core.CreateFromFile(source, nil)
+	if err != nil {
+		t.Fatalf("create bao: %v", err)
+	}
+
+	swarm := core.NewSwarm(file.InfoHash, file, t.TempDir())
+	t.Cleanup(func() { swarm.Close() })
+	for idx := 0; idx < 2; idx++ {
+		unit := content[idx*unitSize : (idx+1)*unitSize]
+		if err := swarm.FileIO.WriteTransferUnit(uint64(idx), unit); err != nil {
+			t.Fatalf("write unit %d: %v", idx, err)
+		}
+		swarm.MarkTransferUnitComplete(uint64(idx), unit)
+	}
+
+	swarms := core.NewSwarmRegistry()
+	swarms.Add(swarm)
+	server := &Server{coreClient: &core.Client{Swarms: swarms}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/baos/{id}/content", server.ServeBaoContent)
+	return mux, hex.EncodeToString(file.InfoHash[:]), content
+}
+
+func getRange(ctx context.Context, handler http.Handler, id, byteRange string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/baos/"+id+"/content", nil).WithContext(ctx)
+	req.Header.Set("Range", byteRange)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServeBaoContentRanges(t *testing.T) {
+	handler, id, content := newPartialContentServer(t)
+	unitSize := appconfig.TransferUnitSize
+	size := len(content)
+
+	cases := []struct{ start, end int }{
+		{100, 199},
+		// Across the boundary of the two downloaded units
+		{unitSize - 10, unitSize + 9},
+	}
+	for _, c := range cases {
+		rec := getRange(context.Background(), handler, id, fmt.Sprintf("bytes=%d-%d", c.start, c.end))
+		if rec.Code != http.StatusPartialContent {
+			t.Fatalf("range %d-%d: got %d, want 206", c.start, c.end, rec.Code)
+		}
+		if want := fmt.Sprintf("bytes %d-%d/%d", c.start, c.end, size); rec.Header().Get("Content-Range") != want {
+			t.Fatalf("range %d-%d: Content-Range %q, want %q", c.start, c.end, rec.Header().Get("Content-Range"), want)
+		}
+		if !bytes.Equal(rec.Body.Bytes(), content[c.start:c.end+1]) {
+			t.Fatalf("range %d-%d: wrong body", c.start, c.end)
+		}
+	}
+
+	rec := getRange(context.Background(), handler, id, fmt.Sprintf("bytes=%d-", size+10))
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("range past the end: got %d, want 416", rec.Code)
+	}
+	if want := fmt.Sprintf("bytes */%d", size); rec.Header().Get("Content-Range") != want {
+		t.Fatalf("416 Content-Range %q, want %q", rec.Header().Get("Content-Range"), want)
+	}
+}
+
+func TestServeBaoContentMissingRangeEndsWithRequest(t *testing.T) {
+	handler, id, content := newPartialContentServer(t)
+	start := appconfig.TransferUnitSize * 3
+
+	// Unit 3 has no peers, so the response waits until the client goes away.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- getRange(ctx, handler, id, fmt.Sprintf("bytes=%d-", start))
+	}()
+
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusPartialContent {
+			t.Fatalf("got %d, want 206", rec.Code)
+		}
+		body, _ := io.ReadAll(rec.Body)
+		if len(body) >= len(content)-start {
+			t.Fatalf("missing data should not be served, got %d bytes", len(body))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("response did not end with the request")
+	}
+}
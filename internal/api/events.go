@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	appconfig "github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/core"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// progressEvent is the one StreamEvent type not published by the core; it is
+// batched from unit completions.
+const progressEvent = "progress"
+
+// HandleEvents streams swarm events as server-sent events, so the UI learns
+// about changes as they happen instead of polling /api/v1/baos. Unit
+// completions are also summed up into one progress event per swarm every
+// EventProgressInterval.
+func (s *Server) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := s.coreClient.Swarms.Subscribe(appconfig.EventStreamBuffer)
+	defer cancel()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	progress := time.NewTicker(appconfig.EventProgressInterval)
+	defer progress.Stop()
+	heartbeat := time.NewTicker(appconfig.EventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	changed := make(map[protocol.InfoHash]bool)
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Kind == core.SwarmUnitCompleted {
+				changed[event.InfoHash] = true
+			}
+			err = writeStreamEvent(w, s.streamEvent(event))
+
+		case now := <-progress.C:
+			for ih := range changed {
+				swarm, ok := s.coreClient.Swarms.Get(ih)
+				if !ok {
+					continue
+				}
+				p := s.api.Progress(swarm)
+				err = writeStreamEvent(w, StreamEvent{
+					Type:     progressEvent,
+					ID:       fmt.Sprintf("%x", ih),
+					Time:     now.UnixMilli(),
+					Progress: &p,
+				})
+				if err != nil {
+					break
+				}
+			}
+			clear(changed)
+
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// CloseStreams ends every open event stream, so that shutting down the HTTP
+// server does not wait for them.
+func (s *Server) CloseStreams() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
+// streamEvent converts a core event for the stream. Events that change what
+// the bao shows carry its new state.
+func (s *Server) streamEvent(event core.SwarmEvent) StreamEvent {
+	out := StreamEvent{
+		Type: string(event.Kind),
+		ID:   fmt.Sprintf("%x", event.InfoHash),
+		Time: event.Time.UnixMilli(),
+		Peer: string(event.Peer),
+	}
+	if event.Err != nil {
+		out.Error = event.Err.Error()
+	}
+
+	switch event.Kind {
+	case core.SwarmUnitCompleted:
+		unit := event.Unit
+		out.Unit = &unit
+	case core.SwarmAnnounced:
+		peers := event.Peers
+		out.Tracker = event.Tracker
+		out.Peers = &peers
+	case core.SwarmRemoved, core.SwarmError:
+	default:
+		if swarm, ok := s.coreClient.Swarms.Get(event.InfoHash); ok {
+			out.State = s.api.State(swarm)
+		}
+	}
+	return out
+}
+
+func writeStreamEvent(w io.Writer, event StreamEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
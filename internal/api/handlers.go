@@ -9,11 +9,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	appconfig "github.com/baoswarm/baobun/internal/config"
 	"github.com/baoswarm/baobun/internal/core"
@@ -21,17 +24,26 @@ import (
 )
 
 type Server struct {
-	api        *Adapter
-	coreClient *core.Client
-	seedStore  *appconfig.SeedStore
-	hidden     *HiddenStore
+	api         *Adapter
+	coreClient  *core.Client
+	seedStore   *appconfig.SeedStore
+	settings    *appconfig.SettingsStore
+	downloadDir string
+	hidden      *HiddenStore
+
+	// Closed by CloseStreams to end the event streams
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
-func NewServer(api *Adapter, core *core.Client, seedStore *appconfig.SeedStore) *Server {
+func NewServer(api *Adapter, core *core.Client, seedStore *appconfig.SeedStore, settings *appconfig.SettingsStore, downloadDir string) *Server {
 	server := &Server{
-		api:        api,
-		coreClient: core,
-		seedStore:  seedStore,
+		api:         api,
+		coreClient:  core,
+		seedStore:   seedStore,
+		settings:    settings,
+		downloadDir: downloadDir,
+		shutdown:    make(chan struct{}),
 	}
 
 	hiddenPath := filepath.Join(server.resolveDownloadDir(), ".baobun", "hidden.json")
@@ -57,6 +69,29 @@ func (s *Server) HandleBaos(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(baos)
 }
 
+// HandleBao returns one bao's BaoDetail, for debugging transfers.
+func (s *Server) HandleBao(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ih, err := parseInfoHashHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid bao id", http.StatusBadRequest)
+		return
+	}
+
+	swarm, ok := s.coreClient.Swarms.Get(ih)
+	if !ok || swarm.FileIO == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.api.Detail(swarm))
+}
+
 func (s *Server) PauseBaos(w http.ResponseWriter, r *http.Request) {
 	ids, ok := s.decodeActionIDs(w, r)
 	if !ok {
@@ -83,6 +118,235 @@ func (s *Server) PauseBaos(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) ResumeBaos(w http.ResponseWriter, r *http.Request) {
+	ids, ok := s.decodeActionIDs(w, r)
+	if !ok {
+		return
+	}
+
+	processed := 0
+	for _, id := range ids {
+		ih, err := parseInfoHashHex(id)
+		if err != nil {
+			continue
+		}
+		if s.coreClient.ResumeSwarm(ih) {
+			processed++
+		}
+	}
+
+	s.writeActionResponse(w, BaoActionResponse{
+		Processed:  processed,
+		Hidden:     s.hiddenCount(),
+		Remaining:  len(s.api.Baos()),
+		Successful: true,
+		Message:    "Resumed selected baos.",
+	})
+}
+
+func (s *Server) SetBaoStrategy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	var req BaoStrategyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids are required", http.StatusBadRequest)
+		return
+	}
+
+	strategy, err := core.ParseDownloadStrategy(req.Strategy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	processed := 0
+	for _, id := range req.IDs {
+		ih, err := parseInfoHashHex(id)
+		if err != nil {
+			continue
+		}
+
+		swarm, ok := s.coreClient.Swarms.Get(ih)
+		if !ok {
+			continue
+		}
+
+		manager := swarm.TransferUnitManager
+		if req.Window > 0 {
+			manager.SetStreamWindow(req.Window)
+		}
+		if req.Position != nil {
+			manager.SetPlaybackPosition(*req.Position)
+		}
+		manager.SetStrategy(strategy)
+		processed++
+	}
+
+	s.writeActionResponse(w, BaoActionResponse{
+		Processed:  processed,
+		Hidden:     s.hiddenCount(),
+		Remaining:  len(s.api.Baos()),
+		Successful: true,
+		Message:    fmt.Sprintf("Set download strategy to %s.", strategy),
+	})
+}
+
+// MoveBaos changes the queue position of the selected baos. They keep their
+// order relative to each other.
+func (s *Server) MoveBaos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	var req BaoQueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids are required", http.StatusBadRequest)
+		return
+	}
+
+	move := core.QueueMove(req.Move)
+	switch move {
+	case core.QueueTop, core.QueueUp, core.QueueDown, core.QueueBottom:
+	default:
+		http.Error(w, "move must be one of top, up, down, bottom", http.StatusBadRequest)
+		return
+	}
+
+	ids := req.IDs
+	if move == core.QueueTop || move == core.QueueDown {
+		ids = make([]string, 0, len(req.IDs))
+		for i := len(req.IDs) - 1; i >= 0; i-- {
+			ids = append(ids, req.IDs[i])
+		}
+	}
+
+	processed := 0
+	for _, id := range ids {
+		ih, err := parseInfoHashHex(id)
+		if err != nil {
+			continue
+		}
+		if err := s.coreClient.MoveInQueue(ih, move); err != nil {
+			continue
+		}
+		processed++
+	}
+
+	s.writeActionResponse(w, BaoActionResponse{
+		Processed:  processed,
+		Hidden:     s.hiddenCount(),
+		Remaining:  len(s.api.Baos()),
+		Successful: true,
+		Message:    fmt.Sprintf("Moved selected baos %s.", move),
+	})
+}
+
+// SetBaoLimits caps the upload and download rate of the selected baos.
+func (s *Server) SetBaoLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	var req BaoLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids are required", http.StatusBadRequest)
+		return
+	}
+
+	processed := 0
+	for _, id := range req.IDs {
+		ih, err := parseInfoHashHex(id)
+		if err != nil {
+			continue
+		}
+
+		swarm, ok := s.coreClient.Swarms.Get(ih)
+		if !ok {
+			continue
+		}
+
+		swarm.SetBandwidthLimit(req.Upload, req.Download)
+		processed++
+	}
+
+	s.writeActionResponse(w, BaoActionResponse{
+		Processed:  processed,
+		Hidden:     s.hiddenCount(),
+		Remaining:  len(s.api.Baos()),
+		Successful: true,
+		Message:    "Set bandwidth limits.",
+	})
+}
+
+// ServeBaoContent serves the swarm's file with HTTP Range support. Ranges
+// that are not downloaded yet are prioritized and the response blocks until
+// their units are verified, so media players can stream an in-progress bao.
+func (s *Server) ServeBaoContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ih, err := parseInfoHashHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid bao id", http.StatusBadRequest)
+		return
+	}
+
+	swarm, ok := s.coreClient.Swarms.Get(ih)
+	if !ok || swarm.FileIO == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Directory baos serve one file at a time, picked with ?path=.
+	name := swarm.File.Name
+	content := swarm.NewContentReader(r.Context())
+	if swarm.File.IsMultiFile() {
+		relPath := r.URL.Query().Get("path")
+		if relPath == "" {
+			http.Error(w, "path is required for directory baos", http.StatusBadRequest)
+			return
+		}
+
+		content, err = swarm.NewFileContentReader(r.Context(), relPath)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		name = relPath
+	}
+
+	// Set explicitly so ServeContent does not sniff (and block on) unit 0.
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	http.ServeContent(w, r, name, time.Time{}, content)
+}
+
 func (s *Server) ArchiveBaos(w http.ResponseWriter, r *http.Request) {
 	ids, ok := s.decodeActionIDs(w, r)
 	if !ok {
@@ -101,10 +365,8 @@ func (s *Server) ArchiveBaos(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		swarm.DisconnectAll(s.coreClient.Sessions)
-		s.coreClient.Sessions.UnregisterSwarm(ih)
+		// RemoveSwarm closed the files, so they can be moved
 		_ = archiveSwarmData(swarm)
-		_ = swarm.Close()
 		processed++
 	}
 
@@ -135,9 +397,6 @@ func (s *Server) DeleteBaos(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		swarm.DisconnectAll(s.coreClient.Sessions)
-		s.coreClient.Sessions.UnregisterSwarm(ih)
-		_ = swarm.Close()
 		_ = deleteSwarmData(ih, swarm)
 		processed++
 	}
@@ -179,16 +438,14 @@ func (s *Server) HideBaos(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		swarm, exists := s.coreClient.RemoveSwarm(ih)
-		if !exists || swarm == nil {
+		swarm, exists := s.coreClient.Swarms.Get(ih)
+		if !exists {
 			continue
 		}
 
+		// The swarm is only removed once it is safely hidden.
 		baoJSON, err := json.Marshal(swarm.File)
 		if err != nil {
-			// Reinsert swarm if we failed to serialize.
-			s.coreClient.Swarms[ih] = swarm
-			s.coreClient.Sessions.RegisterSwarm(swarm)
 			continue
 		}
 
@@ -198,14 +455,12 @@ func (s *Server) HideBaos(w http.ResponseWriter, r *http.Request) {
 			BaoJSON:      baoJSON,
 		}, req.Passkey)
 		if err != nil {
-			s.coreClient.Swarms[ih] = swarm
-			s.coreClient.Sessions.RegisterSwarm(swarm)
 			continue
 		}
 
-		swarm.DisconnectAll(s.coreClient.Sessions)
-		s.coreClient.Sessions.UnregisterSwarm(ih)
-		_ = swarm.Close()
+		if _, exists := s.coreClient.RemoveSwarm(ih); !exists {
+			continue
+		}
 		processed++
 	}
 
@@ -273,7 +528,7 @@ func (s *Server) UnhideBaos(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		s.coreClient.UnpauseSwarm(ih)
+		go s.coreClient.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
 		processed++
 	}
 
@@ -307,6 +562,24 @@ func (s *Server) UploadBao(w http.ResponseWriter, r *http.Request) {
 
 	downloadDir := s.resolveDownloadDir()
 
+	if core.IsBaoURI(string(dataFromPost)) {
+		// A bao: link; the .bao is fetched from the swarm's peers.
+		uri, err := core.ParseBaoURI(string(dataFromPost))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ih, err := s.coreClient.ImportBaoURI(r.Context(), uri, downloadDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		s.startImportedSwarm(w, ih)
+		return
+	}
+
 	// Try treating upload as a .bao descriptor first.
 	ih, err := s.coreClient.ImportBaoData(dataFromPost, downloadDir)
 	if err != nil {
@@ -344,11 +617,17 @@ func (s *Server) UploadBao(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Raw file upload is complete data; mark all units as present.
-		if swarm, ok := s.coreClient.Swarms[ih]; ok {
+		if swarm, ok := s.coreClient.Swarms.Get(ih); ok {
 			swarm.MarkAllUnitsAvailable()
 		}
 	}
 
+	s.startImportedSwarm(w, ih)
+}
+
+// startImportedSwarm announces a newly imported swarm and writes the upload
+// response.
+func (s *Server) startImportedSwarm(w http.ResponseWriter, ih protocol.InfoHash) {
 	log.Printf("Loaded swarm %x", ih)
 
 	// ---------------- Announce ----------------
@@ -358,7 +637,7 @@ func (s *Server) UploadBao(w http.ResponseWriter, r *http.Request) {
 		protocol.EventStarted,
 	)
 
-	swarm, ok := s.coreClient.Swarms[ih]
+	swarm, ok := s.coreClient.Swarms.Get(ih)
 	if !ok {
 		http.Error(w, "swarm not found after import", http.StatusInternalServerError)
 		return
@@ -372,7 +651,10 @@ func (s *Server) UploadBao(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) resolveDownloadDir() string {
-	for _, swarm := range s.coreClient.Swarms {
+	if s.downloadDir != "" {
+		return s.downloadDir
+	}
+	for _, swarm := range s.coreClient.Swarms.All() {
 		if swarm.FileLocation != "" {
 			return swarm.FileLocation
 		}
@@ -384,7 +666,7 @@ func (s *Server) resolveTrackers() []string {
 	trackers := make([]string, 0)
 	seen := make(map[string]struct{})
 
-	for _, swarm := range s.coreClient.Swarms {
+	for _, swarm := range s.coreClient.Swarms.All() {
 		for _, tracker := range swarm.File.Trackers {
 			if _, ok := seen[tracker]; ok {
 				continue
@@ -472,6 +754,166 @@ func (s *Server) HandleSeedConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		http.Error(w, "settings unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		defer r.Body.Close()
+
+		var req RuntimeConfig
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		timeout, err := time.ParseDuration(req.TransferRequestTimeout)
+		if err != nil {
+			http.Error(w, "invalid transferRequestTimeout", http.StatusBadRequest)
+			return
+		}
+
+		err = s.settings.SetRuntime(appconfig.RuntimeSettings{
+			ActiveTransfersPerPeer: req.ActiveTransfersPerPeer,
+			ActiveTransfersTotal:   req.ActiveTransfersTotal,
+			TransferRequestTimeout: appconfig.Duration(timeout),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings := s.settings.Settings()
+	payload := ConfigResponse{
+		ConfigFile:            s.settings.Path(),
+		Listen:                settings.Listen,
+		DataDir:               settings.DataDir,
+		Identity:              settings.Identity,
+		TLS:                   settings.TLS,
+		SeedRPCServers:        settings.SeedRPCServers,
+		MultiClientNumClients: settings.MultiClientNumClients,
+		TransferUnitSize:      settings.TransferUnitSize,
+		Runtime: RuntimeConfig{
+			ActiveTransfersPerPeer: settings.ActiveTransfersPerPeer,
+			ActiveTransfersTotal:   settings.ActiveTransfersTotal,
+			TransferRequestTimeout: time.Duration(settings.TransferRequestTimeout).String(),
+		},
+	}
+	for _, node := range settings.Nodes {
+		payload.Nodes = append(payload.Nodes, NodeConfig{Listen: node.Listen, DataDir: node.DataDir})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func (s *Server) HandleQueueConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		defer r.Body.Close()
+
+		var req QueueConfig
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.coreClient.SetQueueLimits(req.MaxActiveDownloads, req.MaxActiveSeeds); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload QueueConfig
+	payload.MaxActiveDownloads, payload.MaxActiveSeeds = s.coreClient.QueueLimits()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func (s *Server) HandleBandwidthLimits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeBandwidthLimits(w)
+	case http.MethodPut:
+		defer r.Body.Close()
+
+		var req BandwidthLimits
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		limits := core.BandwidthLimits{
+			Upload:       req.Upload,
+			Download:     req.Download,
+			PeerUpload:   req.PeerUpload,
+			PeerDownload: req.PeerDownload,
+		}
+		for _, entry := range req.Schedule {
+			scheduled := core.LimitSchedule{
+				Start:    entry.Start,
+				End:      entry.End,
+				Upload:   entry.Upload,
+				Download: entry.Download,
+			}
+			for _, day := range entry.Days {
+				scheduled.Days = append(scheduled.Days, time.Weekday(day))
+			}
+			limits.Schedule = append(limits.Schedule, scheduled)
+		}
+
+		if err := s.coreClient.SetBandwidthLimits(limits); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.writeBandwidthLimits(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeBandwidthLimits(w http.ResponseWriter) {
+	limits := s.coreClient.BandwidthLimits()
+
+	payload := BandwidthLimits{
+		Upload:       limits.Upload,
+		Download:     limits.Download,
+		PeerUpload:   limits.PeerUpload,
+		PeerDownload: limits.PeerDownload,
+		Schedule:     make([]LimitScheduleEntry, 0, len(limits.Schedule)),
+	}
+	for _, entry := range limits.Schedule {
+		out := LimitScheduleEntry{
+			Start:    entry.Start,
+			End:      entry.End,
+			Upload:   entry.Upload,
+			Download: entry.Download,
+		}
+		for _, day := range entry.Days {
+			out.Days = append(out.Days, int(day))
+		}
+		payload.Schedule = append(payload.Schedule, out)
+	}
+	payload.ActiveUpload, payload.ActiveDownload = s.coreClient.ActiveBandwidthLimits()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
 func (s *Server) GenerateSeedConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -563,7 +1005,11 @@ func archiveSwarmData(swarm *core.Swarm) error {
 func deleteSwarmData(ih protocol.InfoHash, swarm *core.Swarm) error {
 	src := filepath.Join(swarm.FileLocation, swarm.File.Name)
 	if _, err := os.Stat(src); err == nil {
-		_ = os.Remove(src)
+		if swarm.File.IsMultiFile() {
+			_ = os.RemoveAll(src)
+		} else {
+			_ = os.Remove(src)
+		}
 	}
 
 	proofDir := filepath.Join(
@@ -574,6 +1020,10 @@ func deleteSwarmData(ih protocol.InfoHash, swarm *core.Swarm) error {
 	)
 	_ = os.RemoveAll(proofDir)
 
+	if swarm.AvailabilityStore != nil {
+		_ = swarm.AvailabilityStore.Remove()
+	}
+
 	return nil
 }
 
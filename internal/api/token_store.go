@@ -0,0 +1,316 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const tokenStoreVersion = 1
+
+// Scope is what an API token may do. Read tokens may only look; admin tokens
+// may also change things.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeAdmin Scope = "admin"
+)
+
+// ParseScope checks that value names a scope.
+func ParseScope(value string) (Scope, error) {
+	switch scope := Scope(value); scope {
+	case ScopeRead, ScopeAdmin:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown scope %q, expected %q or %q", value, ScopeRead, ScopeAdmin)
+	}
+}
+
+// Allows reports whether a token with scope s may do what needs required.
+func (s Scope) Allows(required Scope) bool {
+	return s == ScopeAdmin || s == required
+}
+
+var ErrTokenExists = errors.New("a token with that name already exists")
+
+// TokenStore keeps the API tokens, managed with `baobun-client token`. Only
+// a hash of each token is saved. The file is re-read when it changes, so
+// tokens added or revoked while the client runs take effect at once.
+type TokenStore struct {
+	mu   sync.Mutex
+	path string
+	data tokenStoreDisk
+
+	// Of the file as last read or written, to notice changes
+	modTime time.Time
+	size    int64
+}
+
+type tokenStoreDisk struct {
+	Version int               `json:"version"`
+	Tokens  []tokenStoreEntry `json:"tokens"`
+}
+
+type tokenStoreEntry struct {
+	Name      string `json:"name"`
+	Scope     Scope  `json:"scope"`
+	Hash      string `json:"hash"` // Hex SHA-256 of the token
+	CreatedAt int64  `json:"created_at_unix"`
+}
+
+// TokenInfo describes a token without revealing it.
+type TokenInfo struct {
+	Name      string
+	Scope     Scope
+	CreatedAt time.Time
+
+	hash string // Identifies this token even if the name is reused
+}
+
+// TokenStorePath is where the tokens of the client keeping its data in
+// dataDir are stored.
+func TokenStorePath(dataDir string) string {
+	return filepath.Join(dataDir, ".baobun", "tokens.json")
+}
+
+func NewTokenStore(path string) (*TokenStore, error) {
+	store := &TokenStore{
+		path: path,
+		data: tokenStoreDisk{
+			Version: tokenStoreVersion,
+			Tokens:  make([]tokenStoreEntry, 0),
+		},
+	}
+
+	if err := store.reloadLocked(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *TokenStore) Path() string {
+	return s.path
+}
+
+// Add creates a token called name and returns it. The token itself cannot
+// be recovered later.
+func (s *TokenStore) Add(name string, scope Scope) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "" {
+		return "", fmt.Errorf("token name is required")
+	}
+	if _, err := ParseScope(string(scope)); err != nil {
+		return "", err
+	}
+	if err := s.reloadLocked(); err != nil {
+		return "", err
+	}
+	if s.findLocked(name) >= 0 {
+		return "", ErrTokenExists
+	}
+	return s.addLocked(name, scope)
+}
+
+// Bootstrap creates an admin token called name if there are no tokens at
+// all, so a new client can be reached only by whoever sees the token. It
+// returns "" when tokens already exist.
+func (s *TokenStore) Bootstrap(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadLocked(); err != nil {
+		return "", err
+	}
+	if len(s.data.Tokens) > 0 {
+		return "", nil
+	}
+	return s.addLocked(name, ScopeAdmin)
+}
+
+func (s *TokenStore) addLocked(name string, scope Scope) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := "bao_" + hex.EncodeToString(raw)
+
+	s.data.Tokens = append(s.data.Tokens, tokenStoreEntry{
+		Name:      name,
+		Scope:     scope,
+		Hash:      hashToken(token),
+		CreatedAt: time.Now().Unix(),
+	})
+	if err := s.saveLocked(); err != nil {
+		s.data.Tokens = s.data.Tokens[:len(s.data.Tokens)-1]
+		return "", err
+	}
+	return token, nil
+}
+
+// Revoke deletes the token called name, reporting whether there was one.
+func (s *TokenStore) Revoke(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadLocked(); err != nil {
+		return false, err
+	}
+	i := s.findLocked(name)
+	if i < 0 {
+		return false, nil
+	}
+
+	s.data.Tokens = append(s.data.Tokens[:i], s.data.Tokens[i+1:]...)
+	return true, s.saveLocked()
+}
+
+// List returns the tokens by name.
+func (s *TokenStore) List() []TokenInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshLocked()
+	out := make([]TokenInfo, 0, len(s.data.Tokens))
+	for _, entry := range s.data.Tokens {
+		out = append(out, entry.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *TokenStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshLocked()
+	return len(s.data.Tokens)
+}
+
+// Lookup returns the token matching token.
+func (s *TokenStore) Lookup(token string) (TokenInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshLocked()
+	return s.lookupHashLocked(hashToken(token))
+}
+
+// lookupHash returns the token with the given hash, if it has not been
+// revoked. A new token under a revoked token's name does not match.
+func (s *TokenStore) lookupHash(hash string) (TokenInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshLocked()
+	return s.lookupHashLocked(hash)
+}
+
+func (s *TokenStore) lookupHashLocked(hash string) (TokenInfo, bool) {
+	for _, entry := range s.data.Tokens {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(entry.Hash)) == 1 {
+			return entry.info(), true
+		}
+	}
+	return TokenInfo{}, false
+}
+
+func (e tokenStoreEntry) info() TokenInfo {
+	return TokenInfo{Name: e.Name, Scope: e.Scope, CreatedAt: time.Unix(e.CreatedAt, 0), hash: e.Hash}
+}
+
+func (s *TokenStore) findLocked(name string) int {
+	for i, entry := range s.data.Tokens {
+		if entry.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// refreshLocked picks up changes made by the CLI. A file that cannot be read
+// leaves the tokens as they were.
+func (s *TokenStore) refreshLocked() {
+	if err := s.reloadLocked(); err != nil {
+		log.Printf("token store: %v", err)
+	}
+}
+
+func (s *TokenStore) reloadLocked() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.data.Tokens = make([]tokenStoreEntry, 0)
+			s.modTime, s.size = time.Time{}, 0
+			return nil
+		}
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	var disk tokenStoreDisk
+	if err := json.Unmarshal(raw, &disk); err != nil {
+		return fmt.Errorf("failed to decode token store: %w", err)
+	}
+	if disk.Version != tokenStoreVersion {
+		return fmt.Errorf("unsupported token store version %d", disk.Version)
+	}
+
+	s.data = disk
+	if s.data.Tokens == nil {
+		s.data.Tokens = make([]tokenStoreEntry, 0)
+	}
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+func (s *TokenStore) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create token store dir: %w", err)
+	}
+
+	body, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal token store: %w", err)
+	}
+	body = append(body, '\n')
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0600); err != nil {
+		return fmt.Errorf("failed to write token store temp file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to finalize token store file: %w", err)
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -32,6 +32,89 @@ type BaoStatus struct {
 	State      BaoState     `json:"state"`
 	FileSize   uint64       `json:"fileSize"`
 	Remaining  uint64       `json:"remaining"`
+	Strategy   string       `json:"strategy"`
+	// Byte offset of the streaming playback cursor
+	PlaybackPosition uint64 `json:"playbackPosition"`
+	// Hex public key of the verified .bao signer, empty if unsigned
+	Publisher string `json:"publisher,omitempty"`
+	// bao: link others can join the swarm with
+	URI string `json:"uri"`
+	// 0-based place in the download queue, which decides what runs first
+	QueuePosition int `json:"queuePosition"`
+	// This swarm's bandwidth caps in bytes/sec, 0 if unlimited
+	UploadLimit   uint64 `json:"uploadLimit"`
+	DownloadLimit uint64 `json:"downloadLimit"`
+}
+
+// BaoDetail is GET /api/v1/baos/{id}: a BaoStatus with the swarm's unit map,
+// outstanding requests and per-peer statistics. Bitfields are base64, unit 0
+// being the high bit of the first byte.
+type BaoDetail struct {
+	BaoStatus
+	UnitCount uint64 `json:"unitCount"`
+	UnitSize  int    `json:"unitSize"`
+	// Units we have, those we advertise to peers, and those with a cached proof
+	Have            []byte `json:"have"`
+	HaveCount       uint64 `json:"haveCount"`
+	Advertised      []byte `json:"advertised"`
+	AdvertisedCount uint64 `json:"advertisedCount"`
+	Proven          []byte `json:"proven"`
+	ProvenCount     uint64 `json:"provenCount"`
+	// Connected peers advertising each unit
+	Availability []uint32        `json:"availability"`
+	Requests     []RequestStatus `json:"requests"`
+	Peers        []PeerDetail    `json:"peers"`
+}
+
+// RequestStatus is a unit requested from a peer and not received yet.
+type RequestStatus struct {
+	Unit     uint64 `json:"unit"`
+	Peer     string `json:"peer"`
+	SentAt   int64  `json:"sentAt"` // Unix milliseconds
+	Age      int64  `json:"age"`    // milliseconds
+	Attempts int    `json:"attempts"`
+	// An endgame copy of a request also sent to another peer
+	Duplicate bool `json:"duplicate"`
+}
+
+// PeerDetail extends PeerStatus with the peer's totals and requests.
+type PeerDetail struct {
+	PeerStatus
+	// Bytes sent to and received from the peer
+	Uploaded   uint64 `json:"uploaded"`
+	Downloaded uint64 `json:"downloaded"`
+	// Units the peer advertises, and that as a fraction of the bao
+	Units      uint64  `json:"units"`
+	Completion float64 `json:"completion"`
+	// Our requests the peer has yet to answer
+	Outstanding  int   `json:"outstanding"`
+	ConnectedFor int64 `json:"connectedFor"` // milliseconds
+}
+
+// StreamEvent is one message on the /api/v1/events stream. Type is also the
+// SSE event name; fields that do not apply to it are left out.
+type StreamEvent struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Time int64  `json:"time"` // Unix milliseconds
+	// The bao's state after the change, for events that change it
+	State    BaoState     `json:"state,omitempty"`
+	Peer     string       `json:"peer,omitempty"`
+	Unit     *uint64      `json:"unit,omitempty"`
+	Tracker  string       `json:"tracker,omitempty"`
+	Peers    *int         `json:"peers,omitempty"` // Peers a tracker returned
+	Error    string       `json:"error,omitempty"`
+	Progress *BaoProgress `json:"progress,omitempty"`
+}
+
+// BaoProgress is the part of a BaoStatus that changes as data moves.
+type BaoProgress struct {
+	Downloaded uint64 `json:"downloaded"`
+	Uploaded   uint64 `json:"uploaded"`
+	Remaining  uint64 `json:"remaining"`
+	FileSize   uint64 `json:"fileSize"`
+	DownRate   uint32 `json:"downRate"` // bytes/sec
+	UpRate     uint32 `json:"upRate"`
 }
 
 type FileStatus struct {
@@ -45,6 +128,12 @@ type PeerStatus struct {
 	State    PeerState `json:"state"`
 	DownRate uint32    `json:"downRate"`
 	UpRate   uint32    `json:"upRate"`
+	// Whether we refuse the peer's requests, and it refuses ours
+	Choking bool `json:"choking"`
+	Choked  bool `json:"choked"`
+	// Whether the peer has units we want, and wants units from us
+	Interested     bool `json:"interested"`
+	PeerInterested bool `json:"peerInterested"`
 }
 
 type UploadBaoResponse struct {
@@ -59,6 +148,32 @@ type SeedConfigResponse struct {
 	RestartRequired bool     `json:"restartRequired"`
 }
 
+// ConfigResponse lists the settings in effect. Only Runtime can be changed
+// without a restart; PUT /api/v1/config takes a RuntimeConfig.
+type ConfigResponse struct {
+	ConfigFile            string        `json:"configFile"`
+	Listen                string        `json:"listen"`
+	DataDir               string        `json:"dataDir"`
+	Identity              string        `json:"identity,omitempty"`
+	TLS                   bool          `json:"tls"`
+	Nodes                 []NodeConfig  `json:"nodes"`
+	SeedRPCServers        []string      `json:"seedRpcServers"`
+	MultiClientNumClients int           `json:"multiClientNumClients"`
+	TransferUnitSize      int           `json:"transferUnitSize"`
+	Runtime               RuntimeConfig `json:"runtime"`
+}
+
+type NodeConfig struct {
+	Listen  string `json:"listen"`
+	DataDir string `json:"dataDir"`
+}
+
+type RuntimeConfig struct {
+	ActiveTransfersPerPeer int    `json:"activeTransfersPerPeer"`
+	ActiveTransfersTotal   int    `json:"activeTransfersTotal"`
+	TransferRequestTimeout string `json:"transferRequestTimeout"`
+}
+
 type SeedConfigUpdateRequest struct {
 	Seeds []string `json:"seeds"`
 }
@@ -67,6 +182,57 @@ type BaoActionRequest struct {
 	IDs []string `json:"ids"`
 }
 
+type BaoStrategyRequest struct {
+	IDs      []string `json:"ids"`
+	Strategy string   `json:"strategy"`
+	// Streaming only: playback byte offset and window size in transfer units
+	Position *uint64 `json:"position,omitempty"`
+	Window   uint64  `json:"window,omitempty"`
+}
+
+type BaoQueueRequest struct {
+	IDs []string `json:"ids"`
+	// One of top, up, down, bottom
+	Move string `json:"move"`
+}
+
+// QueueConfig is how many downloads and seeds may run at once, 0 for
+// unlimited. Further swarms are queued.
+type QueueConfig struct {
+	MaxActiveDownloads int `json:"maxActiveDownloads"`
+	MaxActiveSeeds     int `json:"maxActiveSeeds"`
+}
+
+type BaoLimitRequest struct {
+	IDs []string `json:"ids"`
+	// Bytes/sec, 0 for unlimited
+	Upload   uint64 `json:"upload"`
+	Download uint64 `json:"download"`
+}
+
+// BandwidthLimits are the client-wide limits in bytes/sec, 0 for unlimited.
+// Peer limits apply to each peer separately.
+type BandwidthLimits struct {
+	Upload       uint64               `json:"upload"`
+	Download     uint64               `json:"download"`
+	PeerUpload   uint64               `json:"peerUpload"`
+	PeerDownload uint64               `json:"peerDownload"`
+	Schedule     []LimitScheduleEntry `json:"schedule"`
+	// Client-wide limits in force now, after the schedule (read only)
+	ActiveUpload   uint64 `json:"activeUpload"`
+	ActiveDownload uint64 `json:"activeDownload"`
+}
+
+// LimitScheduleEntry replaces the client-wide limits between start and end
+// ("HH:MM" local time) on the given days (0 is Sunday), or every day.
+type LimitScheduleEntry struct {
+	Days     []int  `json:"days,omitempty"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Upload   uint64 `json:"upload"`
+	Download uint64 `json:"download"`
+}
+
 type HideBaoActionRequest struct {
 	IDs     []string `json:"ids"`
 	Passkey string   `json:"passkey"`
@@ -87,3 +253,16 @@ type BaoActionResponse struct {
 type HiddenCountResponse struct {
 	Count int `json:"count"`
 }
+
+type LoginRequest struct {
+	Token string `json:"token"`
+}
+
+// AuthStatus is returned by the /api/v1/auth endpoints. Name and Scope are
+// those of the token the caller authenticated with. Required is always true.
+type AuthStatus struct {
+	Required      bool   `json:"required"`
+	Authenticated bool   `json:"authenticated"`
+	Name          string `json:"name,omitempty"`
+	Scope         Scope  `json:"scope,omitempty"`
+}
@@ -1,13 +1,152 @@
 package config
 
-import "time"
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTransferUnitSize is the transfer unit size of baos that do not
+// record one, which is every bao made before the size became a setting.
+const DefaultTransferUnitSize = 1024 * 64
+
+// TransferUnitSize is set from the settings at startup, before any client
+// runs, and never changes afterwards.
+var TransferUnitSize int = DefaultTransferUnitSize
+
+// Requests outstanding per peer and per swarm, and how long one may go
+// unanswered. These can change at runtime; see RuntimeSettings.
+var (
+	activeTransfersPerPeer atomic.Int64
+	activeTransfersTotal   atomic.Int64
+	transferRequestTimeout atomic.Int64
+)
+
+func init() {
+	activeTransfersPerPeer.Store(32)
+	activeTransfersTotal.Store(256)
+	transferRequestTimeout.Store(int64(60 * time.Second))
+}
+
+func ActiveTransfersPerPeer() int {
+	return int(activeTransfersPerPeer.Load())
+}
+
+func ActiveTransfersTotal() int {
+	return int(activeTransfersTotal.Load())
+}
+
+func TransferRequestTimeout() time.Duration {
+	return time.Duration(transferRequestTimeout.Load())
+}
 
 const (
-	DialTimeoutMs          int32 = 10000
-	MTU                    int32 = 1024 * 16
-	ActiveTransfersPerPeer int   = 32
-	ActiveTransfersTotal   int   = 256
+	DialTimeoutMs int32 = 10000
+	MTU           int32 = 1024 * 16
+
+	// Streaming mode: units ahead of the playback cursor that are prioritized,
+	// the deadline budget per unit of distance from the cursor, and how long
+	// a request past its deadline is given before it is re-requested.
+	StreamWindowUnits  int           = 32
+	StreamUnitDeadline time.Duration = 500 * time.Millisecond
+	StreamRetryAfter   time.Duration = 5 * time.Second
+
+	// Units past the current read that the content endpoint marks urgent, so
+	// a player reading sequentially does not stall at every unit boundary.
+	ContentReadAheadUnits int = 8
+
+	// Endgame: once every missing unit is requested and at most
+	// EndgameMaxUnits remain, each is also requested from up to
+	// EndgameDuplicates more peers; the slower copies are cancelled.
+	EndgameMaxUnits   int = 16
+	EndgameDuplicates int = 2
+
+	// Requests a peer may have queued with us before further ones are
+	// rejected as overloaded, and how long a peer that rejected us as
+	// overloaded or paused is skipped when scheduling.
+	MaxQueuedUploadsPerPeer int           = 64
+	RejectBackoff           time.Duration = 5 * time.Second
 
-	TransferUnitSize       int           = 1024 * 64
-	TransferRequestTimeout time.Duration = 60 * time.Second
+	// Download queue: swarms beyond this many active downloads and active
+	// seeds are queued with no connections or announces; 0 is unlimited.
+	MaxActiveDownloads int = 5
+	MaxActiveSeeds     int = 20
+
+	// How long shutdown waits for stopped announces and open API requests.
+	ShutdownTimeout time.Duration = 10 * time.Second
+
+	// How often the client state file is rewritten for changed transfer
+	// totals; changes to the swarm list are saved at once.
+	StateSaveInterval time.Duration = 30 * time.Second
+
+	// Units completed while downloading are written to the availability
+	// store in batches: every AvailabilityFlushInterval, after
+	// AvailabilityFlushUnits units, and when the swarm completes or closes.
+	AvailabilityFlushInterval time.Duration = 5 * time.Second
+	AvailabilityFlushUnits    uint64        = 64
+
+	// Event stream (/api/v1/events): swarms that completed units get one
+	// progress event per EventProgressInterval, idle streams are kept open
+	// with a comment every EventHeartbeatInterval, and a client that falls
+	// more than EventStreamBuffer events behind misses the excess.
+	EventProgressInterval  time.Duration = time.Second
+	EventHeartbeatInterval time.Duration = 15 * time.Second
+	EventStreamBuffer      int           = 256
+
+	// API auth: how long a web UI login lasts, and how long the self-signed
+	// certificate generated for -tls is valid.
+	SessionLifetime        time.Duration = 7 * 24 * time.Hour
+	SelfSignedCertLifetime time.Duration = 5 * 365 * 24 * time.Hour
+
+	// Choking: each swarm serves at most UploadSlots interested peers at a
+	// time. All but one go to the peers uploading to us fastest (or that we
+	// upload to fastest once seeding), re-picked every ChokeInterval; the last
+	// is an optimistic unchoke rotated every OptimisticUnchokeInterval.
+	UploadSlots               int           = 4
+	ChokeInterval             time.Duration = 10 * time.Second
+	OptimisticUnchokeInterval time.Duration = 30 * time.Second
+
+	// Metadata exchange: how long one peer is given to answer a metadata
+	// request, how many peers are tried, and the largest .bao JSON accepted.
+	MetadataRequestTimeout time.Duration = 15 * time.Second
+	MetadataMaxPeers       int           = 8
+	MetadataMaxSize        int           = 16 * 1024 * 1024
+
+	// Peer exchange: how often connected peers are sent the swarm's other
+	// peers, how many are listed per message, how many learned peers are kept
+	// per swarm, and the swarm size above which learned peers are not dialed.
+	PexInterval       time.Duration = 60 * time.Second
+	PexMaxPeers       int           = 50
+	PexMaxCandidates  int           = 200
+	PexMaxConnections int           = 40
+
+	// DHT: bucket size (k) and lookup parallelism (alpha), per-query timeout,
+	// how long announced peers are stored and contacts stay fresh, storage
+	// caps, and how often a swarm's lookup is repeated on reannounce.
+	DHTBucketSize       int           = 8
+	DHTAlpha            int           = 3
+	DHTQueryTimeout     time.Duration = 10 * time.Second
+	DHTPeerTTL          time.Duration = 30 * time.Minute
+	DHTNodeStaleAfter   time.Duration = 15 * time.Minute
+	DHTMaxStoredPeers   int           = 200
+	DHTMaxInfoHashes    int           = 10000
+	DHTAnnounceInterval time.Duration = 5 * time.Minute
 )
+
+// RepairAvailabilityEnv forces a verified rescan of every swarm's data file on
+// startup, rebuilding the persisted availability store.
+const RepairAvailabilityEnv = "BAOBUN_REPAIR_AVAILABILITY"
+
+// RepairAvailabilityEnabled reports whether availability repair mode is on.
+func RepairAvailabilityEnabled() bool {
+	return os.Getenv(RepairAvailabilityEnv) == "1"
+}
+
+// DHTBootstrapEnv lists NodeKeys, comma separated, used to join the DHT in
+// addition to the nodes saved from the previous run.
+const DHTBootstrapEnv = "BAOBUN_DHT_BOOTSTRAP"
+
+// DHTBootstrapNodes returns the NodeKeys listed in DHTBootstrapEnv.
+func DHTBootstrapNodes() []string {
+	return splitList(os.Getenv(DHTBootstrapEnv))
+}
@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -153,6 +154,42 @@ func GenerateSeeds() ([]string, error) {
 	return out, nil
 }
 
+// GenerateSeed returns a single random identity seed.
+func GenerateSeed() (string, error) {
+	return generateSeed(SeedLength)
+}
+
+// LoadOrCreateSeedFile reads an identity seed from path, generating and
+// storing a new one if the file does not exist. created reports whether a new
+// seed was written.
+func LoadOrCreateSeedFile(path string) (seed string, created bool, err error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed := strings.TrimSpace(string(data))
+		if len(seed) != SeedLength {
+			return "", false, fmt.Errorf("seed in %s must be %d characters, got %d", path, SeedLength, len(seed))
+		}
+		return seed, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", false, err
+	}
+
+	seed, err = GenerateSeed()
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", false, err
+	}
+	if err := os.WriteFile(path, []byte(seed+"\n"), 0600); err != nil {
+		return "", false, err
+	}
+
+	return seed, true, nil
+}
+
 func generateSeed(length int) (string, error) {
 	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
 	max := big.NewInt(int64(len(chars)))
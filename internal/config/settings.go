@@ -0,0 +1,418 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings are read from the config file, then overridden by environment
+// variables and finally by flags.
+type Settings struct {
+	// The client: where it serves the web UI and keeps its data, and the file
+	// holding its identity seed (default <dataDir>/.baobun/identity_seed.txt)
+	Listen   string `json:"listen"`
+	DataDir  string `json:"dataDir"`
+	Identity string `json:"identity,omitempty"`
+
+	// Serve the web UI and API over HTTPS, with a self-signed certificate
+	// generated on first run in <dataDir>/.baobun/tls
+	TLS bool `json:"tls,omitempty"`
+
+	// Multi-node mode only: one client per entry, each using the next seed
+	// from seeds.json
+	Nodes []NodeSettings `json:"nodes"`
+
+	// NKN seed RPC servers and how many sub-clients each node opens
+	SeedRPCServers        []string `json:"seedRpcServers"`
+	MultiClientNumClients int      `json:"multiClientNumClients"`
+
+	// Recorded in the baos this client makes and part of their InfoHash.
+	// Baos made with another size are separate swarms and cannot be loaded.
+	TransferUnitSize int `json:"transferUnitSize"`
+
+	RuntimeSettings
+}
+
+// NodeSettings is where one client serves the web UI and keeps its data.
+type NodeSettings struct {
+	Listen  string `json:"listen"`
+	DataDir string `json:"dataDir"`
+}
+
+// RuntimeSettings are the settings that can change while running.
+type RuntimeSettings struct {
+	ActiveTransfersPerPeer int      `json:"activeTransfersPerPeer"`
+	ActiveTransfersTotal   int      `json:"activeTransfersTotal"`
+	TransferRequestTimeout Duration `json:"transferRequestTimeout"`
+}
+
+// Duration is a time.Duration written as a string such as "60s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("duration must be a string such as \"60s\"")
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Environment variables overriding the config file.
+const (
+	ListenEnv                 = "BAOBUN_LISTEN"
+	DataDirEnv                = "BAOBUN_DATA_DIR"
+	IdentityEnv               = "BAOBUN_IDENTITY"
+	TLSEnv                    = "BAOBUN_TLS"
+	SeedRPCEnv                = "BAOBUN_SEED_RPC" // Comma separated
+	NumClientsEnv             = "BAOBUN_NUM_CLIENTS"
+	TransferUnitSizeEnv       = "BAOBUN_TRANSFER_UNIT_SIZE"
+	ActiveTransfersPerPeerEnv = "BAOBUN_ACTIVE_TRANSFERS_PER_PEER"
+	ActiveTransfersTotalEnv   = "BAOBUN_ACTIVE_TRANSFERS_TOTAL"
+	TransferRequestTimeoutEnv = "BAOBUN_TRANSFER_REQUEST_TIMEOUT"
+)
+
+// DefaultSettings are used for anything the config file leaves out.
+func DefaultSettings() Settings {
+	return Settings{
+		Listen:  "127.0.0.1:8888",
+		DataDir: "downloads",
+		Nodes: []NodeSettings{
+			{Listen: "127.0.0.1:8880", DataDir: "downloads_0"},
+			{Listen: "127.0.0.1:8881", DataDir: "downloads_1"},
+			{Listen: "127.0.0.1:8882", DataDir: "downloads_2"},
+			{Listen: "127.0.0.1:8888", DataDir: "downloads"},
+		},
+		SeedRPCServers:        []string{"http://85.215.219.214:30003"},
+		MultiClientNumClients: 4,
+		TransferUnitSize:      TransferUnitSize,
+		RuntimeSettings: RuntimeSettings{
+			ActiveTransfersPerPeer: ActiveTransfersPerPeer(),
+			ActiveTransfersTotal:   ActiveTransfersTotal(),
+			TransferRequestTimeout: Duration(TransferRequestTimeout()),
+		},
+	}
+}
+
+// LoadSettings reads the config file at path over the defaults and applies
+// the environment overrides. A missing file is only an error if required.
+func LoadSettings(path string, required bool) (Settings, error) {
+	settings := DefaultSettings()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !required:
+	case err != nil:
+		return settings, fmt.Errorf("failed to read config %q: %w", path, err)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&settings); err != nil {
+			return settings, fmt.Errorf("failed to parse config %q: %w", path, err)
+		}
+	}
+
+	if err := settings.applyEnv(); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+func (s *Settings) applyEnv() error {
+	strs := []struct {
+		env    string
+		target *string
+	}{
+		{ListenEnv, &s.Listen},
+		{DataDirEnv, &s.DataDir},
+		{IdentityEnv, &s.Identity},
+	}
+	for _, field := range strs {
+		if value := os.Getenv(field.env); value != "" {
+			*field.target = value
+		}
+	}
+
+	if value := os.Getenv(SeedRPCEnv); value != "" {
+		s.SeedRPCServers = splitList(value)
+	}
+
+	if value := os.Getenv(TLSEnv); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", TLSEnv, err)
+		}
+		s.TLS = enabled
+	}
+
+	ints := []struct {
+		env    string
+		target *int
+	}{
+		{NumClientsEnv, &s.MultiClientNumClients},
+		{TransferUnitSizeEnv, &s.TransferUnitSize},
+		{ActiveTransfersPerPeerEnv, &s.ActiveTransfersPerPeer},
+		{ActiveTransfersTotalEnv, &s.ActiveTransfersTotal},
+	}
+	for _, field := range ints {
+		value := os.Getenv(field.env)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.env, err)
+		}
+		*field.target = n
+	}
+
+	if value := os.Getenv(TransferRequestTimeoutEnv); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", TransferRequestTimeoutEnv, err)
+		}
+		s.TransferRequestTimeout = Duration(timeout)
+	}
+	return nil
+}
+
+// IdentityFile is the file holding the single-node client's identity seed.
+func (s Settings) IdentityFile() string {
+	if s.Identity != "" {
+		return s.Identity
+	}
+	return filepath.Join(s.DataDir, ".baobun", "identity_seed.txt")
+}
+
+// Validate reports the first setting that cannot be used.
+func (s Settings) Validate() error {
+	if s.Listen == "" || s.DataDir == "" {
+		return fmt.Errorf("listen and dataDir are required")
+	}
+	for i, node := range s.Nodes {
+		if node.Listen == "" || node.DataDir == "" {
+			return fmt.Errorf("node %d needs a listen address and a data dir", i)
+		}
+	}
+	if len(s.SeedRPCServers) == 0 {
+		return fmt.Errorf("at least one seed RPC server is required")
+	}
+	if s.MultiClientNumClients < 1 {
+		return fmt.Errorf("multiClientNumClients must be at least 1")
+	}
+	if size := s.TransferUnitSize; size < 1024 || size > 16*1024*1024 || size&(size-1) != 0 {
+		return fmt.Errorf("transferUnitSize must be a power of two between 1KiB and 16MiB, got %d", size)
+	}
+	return s.RuntimeSettings.Validate()
+}
+
+func (r RuntimeSettings) Validate() error {
+	if r.ActiveTransfersPerPeer < 1 {
+		return fmt.Errorf("activeTransfersPerPeer must be at least 1")
+	}
+	if r.ActiveTransfersTotal < r.ActiveTransfersPerPeer {
+		return fmt.Errorf("activeTransfersTotal must be at least activeTransfersPerPeer")
+	}
+	if r.TransferRequestTimeout < Duration(time.Second) {
+		return fmt.Errorf("transferRequestTimeout must be at least 1s")
+	}
+	return nil
+}
+
+// Apply puts the settings into effect. It must run before any client starts,
+// since TransferUnitSize cannot change afterwards.
+func (s Settings) Apply() {
+	TransferUnitSize = s.TransferUnitSize
+	s.RuntimeSettings.apply()
+}
+
+func (r RuntimeSettings) apply() {
+	activeTransfersPerPeer.Store(int64(r.ActiveTransfersPerPeer))
+	activeTransfersTotal.Store(int64(r.ActiveTransfersTotal))
+	transferRequestTimeout.Store(int64(r.TransferRequestTimeout))
+}
+
+// Current returns the runtime settings in effect.
+func Current() RuntimeSettings {
+	return RuntimeSettings{
+		ActiveTransfersPerPeer: ActiveTransfersPerPeer(),
+		ActiveTransfersTotal:   ActiveTransfersTotal(),
+		TransferRequestTimeout: Duration(TransferRequestTimeout()),
+	}
+}
+
+// SettingsFlags are command line flags overriding settings.
+type SettingsFlags struct {
+	fs *flag.FlagSet
+
+	listen                 string
+	dataDir                string
+	identity               string
+	tls                    bool
+	seedRPC                string
+	numClients             int
+	transferUnitSize       int
+	activeTransfersPerPeer int
+	activeTransfersTotal   int
+	transferRequestTimeout time.Duration
+}
+
+// RegisterSettingsFlags adds the settings flags to fs. Once fs is parsed,
+// Apply copies the flags that were given onto loaded settings.
+func RegisterSettingsFlags(fs *flag.FlagSet) *SettingsFlags {
+	f := &SettingsFlags{fs: fs}
+	fs.StringVar(&f.listen, "listen", "", "web UI and API address (default \"127.0.0.1:8888\")")
+	fs.StringVar(&f.dataDir, "data-dir", "", "downloads and client state (default \"downloads\")")
+	fs.StringVar(&f.identity, "identity", "", "identity seed file, created on first run (default <data-dir>/.baobun/identity_seed.txt)")
+	fs.BoolVar(&f.tls, "tls", false, "serve the web UI and API over HTTPS with a self-signed certificate")
+	fs.StringVar(&f.seedRPC, "seed-rpc", "", "NKN seed RPC servers, comma separated")
+	fs.IntVar(&f.numClients, "num-clients", 0, "NKN sub-clients per node")
+	fs.IntVar(&f.transferUnitSize, "transfer-unit-size", 0, "transfer unit size in bytes")
+	fs.IntVar(&f.activeTransfersPerPeer, "active-transfers-per-peer", 0, "outstanding requests per peer")
+	fs.IntVar(&f.activeTransfersTotal, "active-transfers-total", 0, "outstanding requests per swarm")
+	fs.DurationVar(&f.transferRequestTimeout, "transfer-request-timeout", 0, "how long a request may go unanswered")
+	return f
+}
+
+func (f *SettingsFlags) Apply(s *Settings) {
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "listen":
+			s.Listen = f.listen
+		case "data-dir":
+			s.DataDir = f.dataDir
+		case "identity":
+			s.Identity = f.identity
+		case "tls":
+			s.TLS = f.tls
+		case "seed-rpc":
+			s.SeedRPCServers = splitList(f.seedRPC)
+		case "num-clients":
+			s.MultiClientNumClients = f.numClients
+		case "transfer-unit-size":
+			s.TransferUnitSize = f.transferUnitSize
+		case "active-transfers-per-peer":
+			s.ActiveTransfersPerPeer = f.activeTransfersPerPeer
+		case "active-transfers-total":
+			s.ActiveTransfersTotal = f.activeTransfersTotal
+		case "transfer-request-timeout":
+			s.TransferRequestTimeout = Duration(f.transferRequestTimeout)
+		}
+	})
+}
+
+// SettingsStore holds the settings in effect and saves runtime changes back
+// to the config file.
+type SettingsStore struct {
+	path string
+
+	mu       sync.Mutex
+	settings Settings
+}
+
+// NewSettingsStore applies settings, which must be valid, and keeps them.
+func NewSettingsStore(path string, settings Settings) *SettingsStore {
+	settings.Apply()
+	return &SettingsStore{path: path, settings: settings}
+}
+
+func (s *SettingsStore) Path() string {
+	return s.path
+}
+
+// Settings returns the settings in effect.
+func (s *SettingsStore) Settings() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.settings
+	settings.Nodes = append([]NodeSettings(nil), settings.Nodes...)
+	settings.SeedRPCServers = append([]string(nil), settings.SeedRPCServers...)
+	return settings
+}
+
+// SetRuntime validates and applies runtime, then records it in the config
+// file, leaving the file's other settings as they are.
+func (s *SettingsStore) SetRuntime(runtime RuntimeSettings) error {
+	if err := runtime.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runtime.apply()
+	s.settings.RuntimeSettings = runtime
+	return s.persistRuntimeLocked(runtime)
+}
+
+func (s *SettingsStore) persistRuntimeLocked(runtime RuntimeSettings) error {
+	file := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config %q: %w", s.path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse config %q: %w", s.path, err)
+		}
+	}
+
+	encoded, err := json.Marshal(runtime)
+	if err != nil {
+		return fmt.Errorf("failed to serialize runtime settings: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return fmt.Errorf("failed to serialize runtime settings: %w", err)
+	}
+	for key, value := range fields {
+		file[key] = value
+	}
+
+	data, err = json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize config: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config %q: %w", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write config %q: %w", s.path, err)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadSettingsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baobun.json")
+	file := `{"multiClientNumClients": 2, "activeTransfersPerPeer": 8, "transferRequestTimeout": "30s"}`
+	if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ActiveTransfersPerPeerEnv, "16")
+	t.Setenv(TLSEnv, "true")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterSettingsFlags(fs)
+	if err := fs.Parse([]string{"-transfer-request-timeout", "45s", "-data-dir", "/srv/baobun"}); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := LoadSettings(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags.Apply(&settings)
+
+	if settings.MultiClientNumClients != 2 {
+		t.Fatalf("expected the file to set 2 clients, got %d", settings.MultiClientNumClients)
+	}
+	if settings.ActiveTransfersPerPeer != 16 {
+		t.Fatalf("expected the environment to override the file, got %d", settings.ActiveTransfersPerPeer)
+	}
+	if settings.TransferRequestTimeout != Duration(45*time.Second) {
+		t.Fatalf("expected the flag to override the file, got %v", time.Duration(settings.TransferRequestTimeout))
+	}
+	if settings.DataDir != "/srv/baobun" || settings.Listen != "127.0.0.1:8888" {
+		t.Fatalf("expected -data-dir to override only the data dir, got %q %q", settings.DataDir, settings.Listen)
+	}
+	if !settings.TLS {
+		t.Fatalf("expected the environment to turn on TLS")
+	}
+	if settings.ActiveTransfersTotal != 256 || len(settings.Nodes) == 0 {
+		t.Fatalf("expected defaults for settings the file leaves out")
+	}
+	if err := settings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSettingsRejectsBadConfig(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadSettings(filepath.Join(dir, "missing.json"), false); err != nil {
+		t.Fatalf("a missing optional config should use the defaults: %v", err)
+	}
+	if _, err := LoadSettings(filepath.Join(dir, "missing.json"), true); err == nil {
+		t.Fatalf("expected a missing required config to fail")
+	}
+
+	path := filepath.Join(dir, "typo.json")
+	if err := os.WriteFile(path, []byte(`{"activeTransfers": 8}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSettings(path, true); err == nil {
+		t.Fatalf("expected an unknown setting to fail")
+	}
+
+	settings := DefaultSettings()
+	settings.TransferUnitSize = 1000
+	if err := settings.Validate(); err == nil {
+		t.Fatalf("expected a unit size that is not a power of two to fail")
+	}
+}
+
+func TestSetRuntimeKeepsOtherSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baobun.json")
+	if err := os.WriteFile(path, []byte(`{"multiClientNumClients": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultSettings().RuntimeSettings.apply()
+
+	store := NewSettingsStore(path, DefaultSettings())
+	err := store.SetRuntime(RuntimeSettings{ActiveTransfersPerPeer: 4, ActiveTransfersTotal: 2})
+	if err == nil {
+		t.Fatalf("expected a total below the per-peer limit to fail")
+	}
+
+	runtime := RuntimeSettings{ActiveTransfersPerPeer: 4, ActiveTransfersTotal: 64, TransferRequestTimeout: Duration(time.Minute)}
+	if err := store.SetRuntime(runtime); err != nil {
+		t.Fatal(err)
+	}
+	if ActiveTransfersPerPeer() != 4 || ActiveTransfersTotal() != 64 {
+		t.Fatalf("runtime settings were not applied")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]any
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved["multiClientNumClients"] != float64(2) || saved["activeTransfersTotal"] != float64(64) {
+		t.Fatalf("expected the file to keep its settings and gain the runtime ones, got %s", data)
+	}
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+const availabilityFileVersion = 1
+
+// ErrAvailabilityMissing is returned by AvailabilityStore.Load when no
+// availability file has been written for the swarm yet.
+var ErrAvailabilityMissing = errors.New("availability store missing")
+
+// AvailabilityStore persists which transfer units a swarm holds so startup
+// does not have to rescan the data file.
+type AvailabilityStore struct {
+	path string
+
+	// Serializes writers so concurrent saves cannot interleave on the temp file.
+	mu sync.Mutex
+}
+
+// AvailabilitySnapshot is the in-memory form of a persisted availability file.
+type AvailabilitySnapshot struct {
+	FileLength   uint64
+	TransferSize uint64
+	UnitCount    uint64
+	HaveUnits    Bitfield
+	ProvenUnits  Bitfield
+	LastUpdated  time.Time
+}
+
+type availabilityDiskFile struct {
+	Version         int    `json:"version"`
+	FileLength      uint64 `json:"file_length"`
+	TransferSize    uint64 `json:"transfer_size"`
+	UnitCount       uint64 `json:"unit_count"`
+	HaveUnits       string `json:"have_units"`
+	ProvenUnits     string `json:"proven_units"`
+	LastUpdatedUnix int64  `json:"last_updated_unix"`
+}
+
+func NewAvailabilityStore(fileLocation string, infoHash protocol.InfoHash) *AvailabilityStore {
+	return &AvailabilityStore{
+		path: filepath.Join(
+			fileLocation,
+			".baobun",
+			"availability",
+			hex.EncodeToString(infoHash[:])+".json",
+		),
+	}
+}
+
+// Path returns the location of the availability file on disk.
+func (as *AvailabilityStore) Path() string {
+	return as.path
+}
+
+// Load reads and validates the availability file against the expected file
+// geometry. A missing file yields ErrAvailabilityMissing.
+func (as *AvailabilityStore) Load(file *BaoFile) (*AvailabilitySnapshot, error) {
+	data, err := os.ReadFile(as.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrAvailabilityMissing
+		}
+		return nil, fmt.Errorf("failed to read availability file %q: %w", as.path, err)
+	}
+
+	var onDisk availabilityDiskFile
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		return nil, fmt.Errorf("failed to decode availability file %q: %w", as.path, err)
+	}
+
+	if onDisk.Version != availabilityFileVersion {
+		return nil, fmt.Errorf("unsupported availability file version %d (expected %d)", onDisk.Version, availabilityFileVersion)
+	}
+
+	unitCount := file.GetTransferUnitCount()
+	if onDisk.FileLength != file.Length {
+		return nil, fmt.Errorf("availability file length mismatch: got %d, expected %d", onDisk.FileLength, file.Length)
+	}
+	if onDisk.TransferSize != uint64(config.TransferUnitSize) {
+		return nil, fmt.Errorf("availability transfer size mismatch: got %d, expected %d", onDisk.TransferSize, config.TransferUnitSize)
+	}
+	if onDisk.UnitCount != unitCount {
+		return nil, fmt.Errorf("availability unit count mismatch: got %d, expected %d", onDisk.UnitCount, unitCount)
+	}
+
+	have, err := decodeAvailabilityBits(onDisk.HaveUnits, unitCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid have_units: %w", err)
+	}
+	proven, err := decodeAvailabilityBits(onDisk.ProvenUnits, unitCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proven_units: %w", err)
+	}
+
+	return &AvailabilitySnapshot{
+		FileLength:   onDisk.FileLength,
+		TransferSize: onDisk.TransferSize,
+		UnitCount:    onDisk.UnitCount,
+		HaveUnits:    have,
+		ProvenUnits:  proven,
+		LastUpdated:  time.Unix(onDisk.LastUpdatedUnix, 0),
+	}, nil
+}
+
+// Save atomically replaces the availability file with the given bitfields.
+func (as *AvailabilityStore) Save(file *BaoFile, have Bitfield, proven Bitfield) error {
+	unitCount := file.GetTransferUnitCount()
+	expectedLen := int((unitCount + 7) / 8)
+	if len(have.Bytes()) != expectedLen || len(proven.Bytes()) != expectedLen {
+		return fmt.Errorf("availability bitfield length mismatch: expected %d bytes", expectedLen)
+	}
+
+	onDisk := availabilityDiskFile{
+		Version:         availabilityFileVersion,
+		FileLength:      file.Length,
+		TransferSize:    uint64(config.TransferUnitSize),
+		UnitCount:       unitCount,
+		HaveUnits:       hex.EncodeToString(have.Bytes()),
+		ProvenUnits:     hex.EncodeToString(proven.Bytes()),
+		LastUpdatedUnix: time.Now().Unix(),
+	}
+
+	data, err := json.MarshalIndent(onDisk, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal availability file: %w", err)
+	}
+	data = append(data, '\n')
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(as.path), 0755); err != nil {
+		return fmt.Errorf("failed to create availability directory: %w", err)
+	}
+
+	return writeFileAtomic(as.path, data, 0644)
+}
+
+// Remove deletes the availability file, if present.
+func (as *AvailabilityStore) Remove() error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if err := os.Remove(as.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func decodeAvailabilityBits(encoded string, unitCount uint64) (Bitfield, error) {
+	raw, err := hex.DecodeString(encoded)
+	if err != nil {
+		return Bitfield{}, err
+	}
+
+	expectedLen := (unitCount + 7) / 8
+	if uint64(len(raw)) != expectedLen {
+		return Bitfield{}, fmt.Errorf("bitfield length %d, expected %d", len(raw), expectedLen)
+	}
+
+	return BitfieldFromBytes(raw), nil
+}
+
+// writeFileAtomic writes data to a temp file, syncs it and renames it over
+// target, falling back to remove+rename where rename cannot replace.
+func writeFileAtomic(target string, data []byte, perm os.FileMode) error {
+	tmp := target + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	// Best effort; some filesystems do not support fsync. A torn write is
+	// rejected on load and falls back to the verified scan.
+	_ = f.Sync()
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		// Windows does not overwrite existing files on rename.
+		_ = os.Remove(target)
+		if errRetry := os.Rename(tmp, target); errRetry != nil {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("failed to finalize %q: %w", target, errRetry)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func TestAvailabilityStoreSaveLoadRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "availability-store-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var infoHash protocol.InfoHash
+	copy(infoHash[:], mustDecodeHex32(t, "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"))
+
+	file := createTestBaoFile("avail.bin", uint64(config.TransferUnitSize)*10+123, uint64(config.TransferUnitSize))
+	unitCount := file.GetTransferUnitCount()
+
+	have := NewBitfield(unitCount)
+	proven := NewBitfield(unitCount)
+	for _, idx := range []uint64{0, 3, 7, 10} {
+		have.Set(idx)
+	}
+	proven.Set(3)
+	proven.Set(10)
+
+	store := NewAvailabilityStore(tempDir, infoHash)
+	if err := store.Save(file, have, proven); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loaded, err := store.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	if loaded.UnitCount != unitCount {
+		t.Fatalf("unit count mismatch: got %d, expected %d", loaded.UnitCount, unitCount)
+	}
+
+	for i := uint64(0); i < unitCount; i++ {
+		if loaded.HaveUnits.Has(i) != have.Has(i) {
+			t.Fatalf("have bit %d mismatch", i)
+		}
+		if loaded.ProvenUnits.Has(i) != proven.Has(i) {
+			t.Fatalf("proven bit %d mismatch", i)
+		}
+	}
+
+	if _, err := os.Stat(store.Path() + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file should not remain after save")
+	}
+}
+
+func TestAvailabilityStoreMissing(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "availability-missing-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTestBaoFile("avail.bin", 4096, uint64(config.TransferUnitSize))
+	store := NewAvailabilityStore(tempDir, protocol.InfoHash{})
+
+	if _, err := store.Load(file); !errors.Is(err, ErrAvailabilityMissing) {
+		t.Fatalf("expected ErrAvailabilityMissing, got %v", err)
+	}
+}
+
+func TestAvailabilityStoreRejectsInvalidFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "availability-invalid-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTestBaoFile("avail.bin", uint64(config.TransferUnitSize)*4, uint64(config.TransferUnitSize))
+	store := NewAvailabilityStore(tempDir, protocol.InfoHash{})
+
+	cases := map[string]string{
+		"corrupt":         "{not-json",
+		"version":         `{"version":99,"file_length":262144,"transfer_size":65536,"unit_count":4,"have_units":"00","proven_units":"00"}`,
+		"file length":     `{"version":1,"file_length":1,"transfer_size":65536,"unit_count":4,"have_units":"00","proven_units":"00"}`,
+		"transfer size":   `{"version":1,"file_length":262144,"transfer_size":1024,"unit_count":4,"have_units":"00","proven_units":"00"}`,
+		"unit count":      `{"version":1,"file_length":262144,"transfer_size":65536,"unit_count":5,"have_units":"00","proven_units":"00"}`,
+		"bitfield length": `{"version":1,"file_length":262144,"transfer_size":65536,"unit_count":4,"have_units":"0000","proven_units":"00"}`,
+		"bitfield hex":    `{"version":1,"file_length":262144,"transfer_size":65536,"unit_count":4,"have_units":"zz","proven_units":"00"}`,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(store.Path()), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(store.Path(), []byte(body), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := store.Load(file)
+			if err == nil {
+				t.Fatalf("expected load error")
+			}
+			if errors.Is(err, ErrAvailabilityMissing) {
+				t.Fatalf("invalid file should not be reported as missing")
+			}
+		})
+	}
+}
+
+func TestSwarmRestartUsesAvailabilityStore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "availability-restart-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTestBaoFile("restart.bin", uint64(config.TransferUnitSize)*8, uint64(config.TransferUnitSize))
+	file.InfoHash = protocol.InfoHash{1}
+
+	first := NewSwarm(file.InfoHash, file, tempDir)
+	if first.FileIO.GetBitfield().Count() != 0 {
+		t.Fatalf("fresh swarm should have no units")
+	}
+
+	// Zero-filled data is a legitimate unit once it has been marked complete.
+	if err := first.FileIO.WriteTransferUnit(2, make([]byte, config.TransferUnitSize)); err != nil {
+		t.Fatal(err)
+	}
+	first.MarkTransferUnitComplete(2, nil)
+	first.Close()
+
+	second := NewSwarm(file.InfoHash, file, tempDir)
+	defer second.Close()
+
+	if !second.FileIO.HasTransferUnit(2) {
+		t.Fatalf("unit 2 should be restored from the availability store")
+	}
+	if second.FileIO.GetBitfield().Count() != 1 {
+		t.Fatalf("expected exactly one unit, got %d", second.FileIO.GetBitfield().Count())
+	}
+	if second.CanServeTransferUnit(2) {
+		t.Fatalf("unit without proof must not be servable from an incomplete file")
+	}
+}
+
+func TestSwarmBatchesAvailabilityWrites(t *testing.T) {
+	tempDir := t.TempDir()
+
+	file := createTestBaoFile("batch.bin", uint64(config.TransferUnitSize)*4, uint64(config.TransferUnitSize))
+	file.InfoHash = protocol.InfoHash{4}
+
+	swarm := NewSwarm(file.InfoHash, file, tempDir)
+	if err := swarm.FileIO.WriteTransferUnit(1, make([]byte, config.TransferUnitSize)); err != nil {
+		t.Fatal(err)
+	}
+	swarm.MarkTransferUnitComplete(1, nil)
+
+	snapshot, err := swarm.AvailabilityStore.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.HaveUnits.Has(1) {
+		t.Fatalf("a single unit should not rewrite the availability store")
+	}
+
+	swarm.Close()
+	snapshot, err = swarm.AvailabilityStore.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snapshot.HaveUnits.Has(1) {
+		t.Fatalf("close should write pending units to the availability store")
+	}
+}
+
+func TestSwarmRestartIgnoresStoreForMissingData(t *testing.T) {
+	for name, damage := range map[string]func(string) error{
+		"deleted":   os.Remove,
+		"truncated": func(path string) error { return os.Truncate(path, int64(config.TransferUnitSize)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			file := createTestBaoFile("gone.bin", uint64(config.TransferUnitSize)*4, uint64(config.TransferUnitSize))
+			file.InfoHash = protocol.InfoHash{3}
+
+			first := NewSwarm(file.InfoHash, file, tempDir)
+			if err := first.FileIO.WriteTransferUnit(2, make([]byte, config.TransferUnitSize)); err != nil {
+				t.Fatal(err)
+			}
+			first.MarkTransferUnitComplete(2, nil)
+			first.Close()
+
+			if err := damage(filepath.Join(tempDir, file.Name)); err != nil {
+				t.Fatal(err)
+			}
+
+			second := NewSwarm(file.InfoHash, file, tempDir)
+			defer second.Close()
+
+			if second.FileIO.HasTransferUnit(2) {
+				t.Fatalf("unit 2 should not be restored once its data is gone")
+			}
+		})
+	}
+}
+
+func TestSwarmScanIgnoresUnprovenData(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "availability-scan-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := createTestBaoFile("scan.bin", uint64(config.TransferUnitSize)*4, uint64(config.TransferUnitSize))
+	file.InfoHash = protocol.InfoHash{2}
+
+	// Non-zero bytes on disk with no proof and no availability store.
+	data := make([]byte, file.Length)
+	for i := range data {
+		data[i] = 0xAB
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, file.Name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	swarm := NewSwarm(file.InfoHash, file, tempDir)
+	defer swarm.Close()
+
+	if swarm.FileIO.GetBitfield().Count() != 0 {
+		t.Fatalf("unverifiable data should not be marked available")
+	}
+	if _, err := os.Stat(swarm.AvailabilityStore.Path()); err != nil {
+		t.Fatalf("scan should persist the availability store: %v", err)
+	}
+}
+
+func TestSwarmScanDetectsCompleteFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "availability-complete-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	data := make([]byte, config.TransferUnitSize*3+500)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	path := filepath.Join(tempDir, "complete.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := CreateFromFile(path, []string{"tracker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swarm := NewSwarm(file.InfoHash, file, tempDir)
+	defer swarm.Close()
+
+	if !swarm.FileIO.IsComplete() {
+		t.Fatalf("file matching the root hash should be complete after scan")
+	}
+}
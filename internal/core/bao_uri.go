@@ -0,0 +1,81 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// BaoURIScheme prefixes links that identify a swarm by InfoHash alone, e.g.
+// bao:<infohash hex>?dn=<name>&tr=<tracker>&tr=<tracker>
+const BaoURIScheme = "bao"
+
+// BaoURI is enough to join a swarm without its .bao file; the metadata is
+// fetched from peers found through the tracker hints.
+type BaoURI struct {
+	InfoHash protocol.InfoHash
+	Name     string   // Display name hint, not verified
+	Trackers []string // Tracker hints
+}
+
+// IsBaoURI reports whether s looks like a bao: link rather than .bao JSON.
+func IsBaoURI(s string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), BaoURIScheme+":")
+}
+
+// ParseBaoURI parses a bao: link.
+func ParseBaoURI(raw string) (*BaoURI, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bao URI: %w", err)
+	}
+	if !strings.EqualFold(u.Scheme, BaoURIScheme) {
+		return nil, fmt.Errorf("not a %s: URI", BaoURIScheme)
+	}
+
+	decoded, err := hex.DecodeString(u.Opaque)
+	if err != nil || len(decoded) != len(protocol.InfoHash{}) {
+		return nil, fmt.Errorf("invalid InfoHash %q in bao URI", u.Opaque)
+	}
+
+	query := u.Query()
+	uri := &BaoURI{
+		InfoHash: protocol.InfoHashFromBytes(decoded),
+		Name:     query.Get("dn"),
+	}
+	for _, tracker := range query["tr"] {
+		if tracker = strings.TrimSpace(tracker); tracker != "" {
+			uri.Trackers = append(uri.Trackers, tracker)
+		}
+	}
+
+	return uri, nil
+}
+
+func (u *BaoURI) String() string {
+	query := url.Values{}
+	if u.Name != "" {
+		query.Set("dn", u.Name)
+	}
+	for _, tracker := range u.Trackers {
+		query.Add("tr", tracker)
+	}
+
+	s := BaoURIScheme + ":" + hex.EncodeToString(u.InfoHash[:])
+	if len(query) > 0 {
+		s += "?" + query.Encode()
+	}
+	return s
+}
+
+// URI returns the bao: link for this file.
+func (n *BaoFile) URI() *BaoURI {
+	return &BaoURI{
+		InfoHash: n.InfoHash,
+		Name:     n.Name,
+		Trackers: append([]string(nil), n.Trackers...),
+	}
+}
@@ -1,33 +1,54 @@
 package core
 
 import (
+	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/baoswarm/baobun/internal/config"
 	"github.com/baoswarm/baobun/pkg/protocol"
 	"github.com/zeebo/blake3"
 )
 
-// BaoFile represents a .bao swarm file using BLAKE3's native tree
+// BaoFile represents a .bao swarm file using BLAKE3's native tree.
+// A directory bao lists its files in Files; their contents are concatenated
+// in that order and hashed as one tree, and Name is the directory name.
 type BaoFile struct {
 	Name     string            `json:"name"`
 	Length   uint64            `json:"length"`
-	RootHash string            `json:"root_hash"` // BLAKE3 root hash of entire file
-	InfoHash protocol.InfoHash `json:"info_hash"` // BLAKE3 of canonical JSON representation
-	Trackers []string          `json:"trackers"`  // Tracker addresses
+	Files    []BaoFileEntry    `json:"files,omitempty"` // Ordered file list, directory baos only
+	RootHash string            `json:"root_hash"`       // BLAKE3 root hash of entire file
+	InfoHash protocol.InfoHash `json:"info_hash"`       // BLAKE3 of canonical JSON representation
+	Trackers []string          `json:"trackers"`        // Tracker addresses
+	// Transfer unit size the bao was made with, 0 for DefaultTransferUnitSize.
+	// It is part of the info hash, so each size is a separate swarm.
+	TransferSize uint64 `json:"transfer_size,omitempty"`
+
+	Publisher string `json:"publisher,omitempty"` // Hex ed25519 public key of the signer
+	Signature string `json:"signature,omitempty"` // Hex signature over the canonical form
+}
+
+// BaoFileEntry is one file of a directory bao
+type BaoFileEntry struct {
+	Path   string `json:"path"` // Slash-separated, relative to the bao directory
+	Length uint64 `json:"length"`
 }
 
 // CanonicalBaoFile is used for consistent hashing
 type CanonicalBaoFile struct {
-	Name         string   `json:"name"`
-	Length       uint64   `json:"length"`
-	TransferSize uint64   `json:"transfer_size"`
-	RootHash     string   `json:"root_hash"`
-	Trackers     []string `json:"trackers"`
+	Name         string         `json:"name"`
+	Length       uint64         `json:"length"`
+	Files        []BaoFileEntry `json:"files,omitempty"`
+	TransferSize uint64         `json:"transfer_size"`
+	RootHash     string         `json:"root_hash"`
+	Trackers     []string       `json:"trackers"`
 }
 
 // CreateFromFile creates an BaoFile from a local file using BLAKE3's tree
@@ -53,10 +74,11 @@ func CreateFromFile(filePath string, trackers []string) (*BaoFile, error) {
 	rootHashHex := hex.EncodeToString(rootHash[:])
 
 	bao := &BaoFile{
-		Name:     fi.Name(),
-		Length:   uint64(filesize),
-		Trackers: trackers,
-		RootHash: rootHashHex,
+		Name:         fi.Name(),
+		Length:       uint64(filesize),
+		Trackers:     trackers,
+		RootHash:     rootHashHex,
+		TransferSize: currentTransferSize(),
 	}
 
 	// Calculate info hash
@@ -67,21 +89,215 @@ func CreateFromFile(filePath string, trackers []string) (*BaoFile, error) {
 	return bao, nil
 }
 
-// calculateInfoHash computes the BLAKE3 hash of the canonical JSON representation
-func (n *BaoFile) calculateInfoHash() error {
+// CreateFromDirectory creates a directory BaoFile. Regular files under dirPath
+// are listed in lexical path order and hashed as one concatenated stream.
+func CreateFromDirectory(dirPath string, trackers []string) (*BaoFile, error) {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dirPath)
+	}
+
+	var entries []BaoFileEntry
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	err = filepath.WalkDir(dirPath, func(p string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			if d.Name() == ".baobun" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		files = append(files, f)
+
+		fi, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+
+		entries = append(entries, BaoFileEntry{
+			Path:   filepath.ToSlash(rel),
+			Length: uint64(fi.Size()),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("directory %s contains no files", dirPath)
+	}
+
+	var total uint64
+	spans := make(spanReader, len(files))
+	for i, f := range files {
+		spans[i] = &fileSpan{file: f, offset: total, length: entries[i].Length}
+		total += entries[i].Length
+	}
+
+	rootHash, err := ComputeMerkleRoot(spans, int64(total))
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash directory: %w", err)
+	}
+
+	bao := &BaoFile{
+		Name:         info.Name(),
+		Length:       total,
+		Files:        entries,
+		Trackers:     trackers,
+		RootHash:     hex.EncodeToString(rootHash[:]),
+		TransferSize: currentTransferSize(),
+	}
+
+	if err := bao.calculateInfoHash(); err != nil {
+		return nil, fmt.Errorf("failed to calculate info hash: %w", err)
+	}
+
+	return bao, nil
+}
+
+// currentTransferSize is the TransferSize of a bao made now.
+func currentTransferSize() uint64 {
+	if config.TransferUnitSize == config.DefaultTransferUnitSize {
+		return 0
+	}
+	return uint64(config.TransferUnitSize)
+}
+
+// UnitSize returns the transfer unit size the bao was made with.
+func (n *BaoFile) UnitSize() uint64 {
+	if n.TransferSize == 0 {
+		return config.DefaultTransferUnitSize
+	}
+	return n.TransferSize
+}
+
+// IsMultiFile reports whether the bao describes a directory.
+func (n *BaoFile) IsMultiFile() bool {
+	return len(n.Files) > 0
+}
+
+// FileEntries returns the files making up the content, in order. A single
+// file bao yields one entry named after the bao.
+func (n *BaoFile) FileEntries() []BaoFileEntry {
+	if n.IsMultiFile() {
+		return n.Files
+	}
+	return []BaoFileEntry{{Path: n.Name, Length: n.Length}}
+}
+
+// FileOffset returns where the file at relPath starts in the content.
+func (n *BaoFile) FileOffset(relPath string) (BaoFileEntry, uint64, bool) {
+	var offset uint64
+	for _, entry := range n.FileEntries() {
+		if entry.Path == relPath {
+			return entry, offset, true
+		}
+		offset += entry.Length
+	}
+	return BaoFileEntry{}, 0, false
+}
+
+// validate rejects a file list that does not add up to Length, names or
+// paths that could escape the download directory or write into the client's
+// own .baobun directory, and baos made with another transfer unit size.
+func (n *BaoFile) validate() error {
+	if n.Name == "" || n.Name != filepath.Base(n.Name) || isReservedPathPart(n.Name) {
+		return fmt.Errorf("invalid bao name %q", n.Name)
+	}
+	if n.UnitSize() != uint64(config.TransferUnitSize) {
+		return fmt.Errorf("bao uses %d byte transfer units, this client is set to %d", n.UnitSize(), config.TransferUnitSize)
+	}
+	if !n.IsMultiFile() {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(n.Files))
+	var total uint64
+	for _, entry := range n.Files {
+		if err := validateEntryPath(entry.Path); err != nil {
+			return err
+		}
+		if seen[entry.Path] {
+			return fmt.Errorf("duplicate file path %q", entry.Path)
+		}
+		seen[entry.Path] = true
+		total += entry.Length
+	}
+
+	if total != n.Length {
+		return fmt.Errorf("file lengths add up to %d, expected %d", total, n.Length)
+	}
+	return nil
+}
+
+func validateEntryPath(p string) error {
+	if p == "" || strings.Contains(p, "\\") || path.IsAbs(p) || path.Clean(p) != p {
+		return fmt.Errorf("invalid file path %q", p)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || isReservedPathPart(part) {
+			return fmt.Errorf("invalid file path %q", p)
+		}
+	}
+	if filepath.VolumeName(filepath.FromSlash(p)) != "" {
+		return errors.New("file path must not name a volume")
+	}
+	return nil
+}
+
+// isReservedPathPart reports whether part names the directory itself, its
+// parent, or the client's state directory.
+func isReservedPathPart(part string) bool {
+	return part == "." || part == ".." || strings.EqualFold(part, ".baobun")
+}
+
+// canonicalBytes returns the canonical JSON the info hash and publisher
+// signature are computed over.
+func (n *BaoFile) canonicalBytes() ([]byte, error) {
 	// Create canonical representation
 	canonical := CanonicalBaoFile{
-		Name:     n.Name,
-		Length:   n.Length,
-		RootHash: n.RootHash,
-		Trackers: n.Trackers,
+		Name:         n.Name,
+		Length:       n.Length,
+		Files:        n.Files,
+		TransferSize: n.TransferSize,
+		RootHash:     n.RootHash,
+		Trackers:     append([]string(nil), n.Trackers...),
 	}
 
 	// Sort for consistency
 	sort.Strings(canonical.Trackers)
 
 	// Marshal with sorted keys
-	data, err := json.Marshal(canonical)
+	return json.Marshal(canonical)
+}
+
+// calculateInfoHash computes the BLAKE3 hash of the canonical JSON representation
+func (n *BaoFile) calculateInfoHash() error {
+	data, err := n.canonicalBytes()
 	if err != nil {
 		return fmt.Errorf("failed to marshal for hashing: %w", err)
 	}
@@ -92,6 +308,54 @@ func (n *BaoFile) calculateInfoHash() error {
 	return nil
 }
 
+// Sign records the publisher key and signs the canonical form. The info hash
+// does not cover the signature, so signing does not change the swarm.
+func (n *BaoFile) Sign(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid publisher key length %d", len(key))
+	}
+
+	data, err := n.canonicalBytes()
+	if err != nil {
+		return fmt.Errorf("failed to marshal for signing: %w", err)
+	}
+
+	n.Publisher = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	n.Signature = hex.EncodeToString(ed25519.Sign(key, data))
+	return nil
+}
+
+// IsSigned reports whether the bao carries a publisher signature.
+func (n *BaoFile) IsSigned() bool {
+	return n.Publisher != "" || n.Signature != ""
+}
+
+// VerifySignature checks the publisher signature. Unsigned baos pass; a
+// signature that is present but does not match is an error.
+func (n *BaoFile) VerifySignature() error {
+	if !n.IsSigned() {
+		return nil
+	}
+
+	pub, err := hex.DecodeString(n.Publisher)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid publisher key %q", n.Publisher)
+	}
+	sig, err := hex.DecodeString(n.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("invalid publisher signature encoding")
+	}
+
+	data, err := n.canonicalBytes()
+	if err != nil {
+		return fmt.Errorf("failed to marshal for verification: %w", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), data, sig) {
+		return fmt.Errorf("signature does not match publisher %s", n.Publisher)
+	}
+	return nil
+}
+
 // GetTransferUnitCount returns the number of transfer units
 func (n *BaoFile) GetTransferUnitCount() uint64 {
 	return (n.Length + uint64(config.TransferUnitSize-1)) / uint64(config.TransferUnitSize)
@@ -149,6 +413,14 @@ func Load(filePath string) (*BaoFile, error) {
 		return nil, fmt.Errorf("failed to decode JSON: %w", err)
 	}
 
+	if err := bao.validate(); err != nil {
+		return nil, fmt.Errorf("invalid .bao file: %w", err)
+	}
+
+	if err := bao.VerifySignature(); err != nil {
+		return nil, fmt.Errorf("invalid .bao signature: %w", err)
+	}
+
 	// Recalculate info hash to ensure consistency
 	if err := bao.calculateInfoHash(); err != nil {
 		return nil, fmt.Errorf("failed to recalculate info hash: %w", err)
@@ -164,6 +436,14 @@ func LoadFromBytes(data []byte) (*BaoFile, error) {
 		return nil, fmt.Errorf("failed to decode JSON: %w", err)
 	}
 
+	if err := bao.validate(); err != nil {
+		return nil, fmt.Errorf("invalid .bao file: %w", err)
+	}
+
+	if err := bao.VerifySignature(); err != nil {
+		return nil, fmt.Errorf("invalid .bao signature: %w", err)
+	}
+
 	// Recalculate info hash to ensure consistency
 	if err := bao.calculateInfoHash(); err != nil {
 		return nil, fmt.Errorf("failed to recalculate info hash: %w", err)
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/baoswarm/baobun/internal/config"
+)
+
+func TestBaoFileSignatureRoundTrip(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bao := &BaoFile{
+		Name:     "video.mp4",
+		Length:   1234,
+		RootHash: "00",
+		Trackers: []string{"bao.b", "bao.a"},
+	}
+	if err := bao.calculateInfoHash(); err != nil {
+		t.Fatal(err)
+	}
+	unsigned := bao.InfoHash
+
+	if err := bao.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if bao.Publisher != hex.EncodeToString(key.Public().(ed25519.PublicKey)) {
+		t.Fatalf("publisher is not the signing key")
+	}
+
+	data, _ := json.Marshal(bao)
+	loaded, err := LoadFromBytes(data)
+	if err != nil {
+		t.Fatalf("signed bao failed to load: %v", err)
+	}
+	if loaded.Publisher != bao.Publisher {
+		t.Fatalf("publisher lost across load")
+	}
+	if loaded.InfoHash != unsigned {
+		t.Fatalf("signing must not change the info hash")
+	}
+}
+
+func TestBaoFileRejectsForgedSignature(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	_, other, _ := ed25519.GenerateKey(nil)
+
+	bao := &BaoFile{Name: "a", Length: 10, RootHash: "00", Trackers: []string{"bao.a"}}
+	if err := bao.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *bao
+	tampered.RootHash = "01"
+	data, _ := json.Marshal(&tampered)
+	if _, err := LoadFromBytes(data); err == nil {
+		t.Fatalf("tampered content should fail verification")
+	}
+
+	impersonated := *bao
+	impersonated.Publisher = hex.EncodeToString(other.Public().(ed25519.PublicKey))
+	data, _ = json.Marshal(&impersonated)
+	if _, err := LoadFromBytes(data); err == nil {
+		t.Fatalf("signature from another key should fail verification")
+	}
+
+	stripped := *bao
+	stripped.Signature = ""
+	data, _ = json.Marshal(&stripped)
+	if _, err := LoadFromBytes(data); err == nil {
+		t.Fatalf("publisher without signature should fail verification")
+	}
+}
+
+func TestBaoFileRecordsTransferUnitSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, make([]byte, 5000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	standard, err := CreateFromFile(path, []string{"bao.a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if standard.TransferSize != 0 {
+		t.Fatalf("default unit size should not be recorded, got %d", standard.TransferSize)
+	}
+
+	defer func(size int) { config.TransferUnitSize = size }(config.TransferUnitSize)
+	config.TransferUnitSize = 1024
+
+	small, err := CreateFromFile(path, []string{"bao.a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if small.TransferSize != 1024 {
+		t.Fatalf("expected transfer size 1024, got %d", small.TransferSize)
+	}
+	if small.InfoHash == standard.InfoHash {
+		t.Fatalf("unit size should be part of the info hash")
+	}
+
+	smallData, _ := json.Marshal(small)
+	if _, err := LoadFromBytes(smallData); err != nil {
+		t.Fatalf("bao should load with its own unit size: %v", err)
+	}
+	standardData, _ := json.Marshal(standard)
+	if _, err := LoadFromBytes(standardData); err == nil {
+		t.Fatalf("bao made with the default unit size should not load")
+	}
+
+	config.TransferUnitSize = config.DefaultTransferUnitSize
+	if _, err := LoadFromBytes(smallData); err == nil {
+		t.Fatalf("bao made with 1024 byte units should not load")
+	}
+}
@@ -47,7 +47,7 @@ func hashParent(left, right [32]byte) [32]byte {
 // Disk hashing helpers
 // ----------------------------
 
-func readLeaf(f *os.File, leaf int64) ([32]byte, error) {
+func readLeaf(f io.ReaderAt, leaf int64) ([32]byte, error) {
 	buf := make([]byte, LeafSize)
 	n, err := f.ReadAt(buf, leaf*LeafSize)
 	if err != nil && err != io.EOF {
@@ -64,7 +64,7 @@ func readLeaf(f *os.File, leaf int64) ([32]byte, error) {
 }
 
 // Hash a full subtree rooted at (start, size)
-func hashSubtree(f *os.File, start, size, totalLeaves int64) ([32]byte, error) {
+func hashSubtree(f io.ReaderAt, start, size, totalLeaves int64) ([32]byte, error) {
 	if size == 1 {
 		if start >= totalLeaves {
 			// Empty leaf
@@ -95,10 +95,16 @@ func ComputeMerkleRootOnDisk(f *os.File) ([32]byte, error) {
 		return [32]byte{}, err
 	}
 
-	totalLeaves := (info.Size() + LeafSize - 1) / LeafSize
+	return ComputeMerkleRoot(f, info.Size())
+}
+
+// ComputeMerkleRoot hashes size bytes of content read through r, e.g. a
+// multi-file FileIO presenting its files as one stream.
+func ComputeMerkleRoot(r io.ReaderAt, size int64) ([32]byte, error) {
+	totalLeaves := (size + LeafSize - 1) / LeafSize
 	treeLeaves := nextPow2(totalLeaves)
 
-	return hashSubtree(f, 0, treeLeaves, totalLeaves)
+	return hashSubtree(r, 0, treeLeaves, totalLeaves)
 }
 
 // ----------------------------
@@ -111,10 +117,16 @@ func GenerateProofOnDisk(f *os.File, offset, length int64) (*protocol.Proof, [32
 		return nil, [32]byte{}, err
 	}
 
+	return GenerateProof(f, info.Size(), offset, length)
+}
+
+// GenerateProof builds the proof for [offset, offset+length) of size bytes of
+// content read through f.
+func GenerateProof(f io.ReaderAt, size, offset, length int64) (*protocol.Proof, [32]byte, error) {
 	startLeaf := offset / LeafSize
 	endLeaf := (offset + length + LeafSize - 1) / LeafSize
 
-	totalLeaves := (info.Size() + LeafSize - 1) / LeafSize
+	totalLeaves := (size + LeafSize - 1) / LeafSize
 	treeLeaves := nextPow2(totalLeaves)
 
 	proof := &protocol.Proof{
@@ -45,6 +45,14 @@ func (b Bitfield) Bytes() []byte {
 	return b.bits
 }
 
+// Clone returns a copy of b that does not share its storage.
+func (b Bitfield) Clone() Bitfield {
+	if b.bits == nil {
+		return Bitfield{}
+	}
+	return Bitfield{bits: append([]byte(nil), b.bits...)}
+}
+
 func BitfieldFromBytes(data []byte) Bitfield {
 	return Bitfield{bits: data}
 }
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// ChokeState is the choking and interest in both directions of one peer
+// connection. Connections start choked both ways.
+type ChokeState struct {
+	AmChoking      bool // we do not serve the peer's requests
+	PeerChoking    bool // the peer does not serve ours
+	AmInterested   bool // the peer has units we are missing
+	PeerInterested bool // the peer wants units from us
+}
+
+func (ph *PeerHandler) ChokeState() ChokeState {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+
+	return ChokeState{
+		AmChoking:      ph.amChoking,
+		PeerChoking:    ph.peerChoking,
+		AmInterested:   ph.amInterested,
+		PeerInterested: ph.peerInterested,
+	}
+}
+
+func (ph *PeerHandler) chokingUs() bool {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	return ph.peerChoking
+}
+
+// chokeLoop re-picks the swarm's upload slots every ChokeInterval.
+func (s *Swarm) chokeLoop() {
+	ticker := time.NewTicker(config.ChokeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.rechoke(time.Now())
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// rechoke unchokes the UploadSlots-1 interested peers with the best rate plus
+// one optimistic unchoke, and chokes everyone else. While downloading the rate
+// is how fast a peer uploads to us, so peers that never upload only get a
+// regular slot when too few others want one.
+func (s *Swarm) rechoke(now time.Time) {
+	handlers := s.connectedHandlers()
+	for _, handler := range handlers {
+		handler.updateInterest()
+	}
+
+	unchoke := s.pickUnchoked(handlers, now)
+	for _, handler := range handlers {
+		handler.setChoking(!unchoke[handler.Peer])
+	}
+}
+
+func (s *Swarm) pickUnchoked(handlers []*PeerHandler, now time.Time) map[protocol.NodeKey]bool {
+	s.chokeMu.Lock()
+	defer s.chokeMu.Unlock()
+
+	seeding := s.FileIO.IsComplete()
+
+	type candidate struct {
+		peer    protocol.NodeKey
+		rate    uint32
+		regular bool
+	}
+
+	var interested []candidate
+	for _, handler := range handlers {
+		state := handler.ChokeState()
+		if !state.PeerInterested {
+			continue
+		}
+
+		rate := handler.DownloadRate()
+		if seeding {
+			rate = handler.UploadRate()
+		}
+		regular := !state.AmChoking && handler.Peer != s.optimistic
+		interested = append(interested, candidate{peer: handler.Peer, rate: rate, regular: regular})
+	}
+
+	// Random order first so ties do not always favour the same peers, then
+	// keep peers already holding a regular slot ahead of equally fast ones.
+	rand.Shuffle(len(interested), func(i, j int) {
+		interested[i], interested[j] = interested[j], interested[i]
+	})
+	sort.SliceStable(interested, func(i, j int) bool {
+		if interested[i].rate != interested[j].rate {
+			return interested[i].rate > interested[j].rate
+		}
+		return interested[i].regular && !interested[j].regular
+	})
+
+	unchoke := make(map[protocol.NodeKey]bool)
+	for _, c := range interested {
+		if len(unchoke) >= config.UploadSlots-1 {
+			break
+		}
+		unchoke[c.peer] = true
+	}
+
+	// Keep the optimistic unchoke for its full interval unless it left, lost
+	// interest or earned a regular slot, then move it to another peer.
+	var others []protocol.NodeKey
+	current := false
+	for _, c := range interested {
+		switch {
+		case unchoke[c.peer]:
+		case c.peer == s.optimistic:
+			current = true
+		default:
+			others = append(others, c.peer)
+		}
+	}
+	if !current || now.Sub(s.optimisticAt) >= config.OptimisticUnchokeInterval {
+		if len(others) > 0 {
+			s.optimistic = others[rand.Intn(len(others))]
+		} else if !current {
+			s.optimistic = ""
+		}
+		s.optimisticAt = now
+	}
+	if s.optimistic != "" {
+		unchoke[s.optimistic] = true
+	}
+
+	return unchoke
+}
+
+// unchokeIfSlotFree gives a newly interested peer an idle upload slot at once
+// rather than making it wait for the next rechoke.
+func (s *Swarm) unchokeIfSlotFree(ph *PeerHandler) {
+	unchoked := 0
+	for _, handler := range s.connectedHandlers() {
+		if !handler.ChokeState().AmChoking {
+			unchoked++
+		}
+	}
+	if unchoked < config.UploadSlots {
+		ph.setChoking(false)
+	}
+}
+
+// wants reports whether bf has a unit we are missing.
+func (s *Swarm) wants(bf Bitfield) bool {
+	if bf.bits == nil || s.FileIO.IsComplete() {
+		return false
+	}
+
+	for i := uint64(0); i < s.FileIO.unitCount; i++ {
+		if bf.Has(i) && !s.FileIO.HasTransferUnit(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Swarm) connectedHandlers() []*PeerHandler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	handlers := make([]*PeerHandler, 0, len(s.Peers))
+	for _, handler := range s.Peers {
+		if handler.GetState() == protocol.StateConnected {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers
+}
+
+// setChoking sends a choke or unchoke if it changes our side. Requests still
+// queued from a peer we choke are rejected so it can ask someone else.
+func (ph *PeerHandler) setChoking(choke bool) {
+	ph.signalMu.Lock()
+	defer ph.signalMu.Unlock()
+
+	ph.mu.Lock()
+	changed := ph.amChoking != choke
+	ph.amChoking = choke
+	ph.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	msgType := protocol.MsgUnchoke
+	if choke {
+		msgType = protocol.MsgChoke
+	}
+	if err := ph.sendSignal(msgType); err != nil {
+		log.Printf("Failed to send %s to %s: %v", msgType, ph.Peer, err)
+	}
+
+	if choke {
+		for _, index := range ph.drainUploads() {
+			ph.reject(index, protocol.RejectChoked)
+		}
+	}
+}
+
+// setInterested sends interested or not interested if it changes our side.
+func (ph *PeerHandler) setInterested(interested bool) {
+	ph.signalMu.Lock()
+	defer ph.signalMu.Unlock()
+
+	ph.mu.Lock()
+	changed := ph.amInterested != interested
+	ph.amInterested = interested
+	ph.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	msgType := protocol.MsgNotInterested
+	if interested {
+		msgType = protocol.MsgInterested
+	}
+	if err := ph.sendSignal(msgType); err != nil {
+		log.Printf("Failed to send %s to %s: %v", msgType, ph.Peer, err)
+	}
+}
+
+// updateInterest recomputes whether the peer has anything we are missing.
+func (ph *PeerHandler) updateInterest() {
+	ph.setInterested(ph.Swarm.wants(ph.PeerBitfield()))
+}
+
+func (ph *PeerHandler) sendSignal(msgType protocol.PeerMessageType) error {
+	return ph.Send(protocol.PeerMessage{
+		InfoHash: ph.Swarm.InfoHash,
+		Type:     msgType,
+	})
+}
+
+// handlePeerChoke records the peer choking or unchoking us. Requests it had
+// queued come back rejected as choked, so only an unchoke needs acting on.
+func (ph *PeerHandler) handlePeerChoke(choked bool) {
+	ph.mu.Lock()
+	ph.peerChoking = choked
+	ph.mu.Unlock()
+
+	if !choked {
+		ph.Swarm.TransferUnitManager.scheduleDownloads()
+	}
+}
+
+func (ph *PeerHandler) handlePeerInterest(interested bool) {
+	ph.mu.Lock()
+	ph.peerInterested = interested
+	ph.mu.Unlock()
+
+	if interested {
+		ph.Swarm.unchokeIfSlotFree(ph)
+	} else {
+		ph.setChoking(true)
+	}
+}
+
+// drainUploads empties the upload queue, returning what was in it.
+func (ph *PeerHandler) drainUploads() []uint64 {
+	ph.uploadMu.Lock()
+	defer ph.uploadMu.Unlock()
+
+	queued := ph.uploadQueue
+	ph.uploadQueue = nil
+	return queued
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// newChokeTestPeers attaches n interested, choked peers to swarm.
+func newChokeTestPeers(t *testing.T, swarm *Swarm, n int) []*PeerHandler {
+	t.Helper()
+
+	handlers := make([]*PeerHandler, n)
+	for i := range handlers {
+		ph, _ := newTestPeer(t, swarm, protocol.NodeKey(fmt.Sprintf("peer-%d", i)), NewBitfield(swarm.FileIO.unitCount))
+		ph.amChoking = true
+		ph.peerInterested = true
+		handlers[i] = ph
+	}
+	return handlers
+}
+
+func unchokedPeers(handlers []*PeerHandler) map[protocol.NodeKey]bool {
+	out := make(map[protocol.NodeKey]bool)
+	for _, ph := range handlers {
+		if !ph.ChokeState().AmChoking {
+			out[ph.Peer] = true
+		}
+	}
+	return out
+}
+
+func TestRechokeFavoursPeersThatUpload(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	handlers := newChokeTestPeers(t, swarm, 7)
+
+	regular := config.UploadSlots - 1
+	for i := 0; i < regular; i++ {
+		handlers[i].recordDownload((i + 1) * config.TransferUnitSize)
+	}
+
+	swarm.rechoke(time.Now())
+
+	unchoked := unchokedPeers(handlers)
+	if len(unchoked) != config.UploadSlots {
+		t.Fatalf("expected %d unchoked peers, got %d", config.UploadSlots, len(unchoked))
+	}
+	for i := 0; i < regular; i++ {
+		if !unchoked[handlers[i].Peer] {
+			t.Fatalf("%s uploads to us and should be unchoked", handlers[i].Peer)
+		}
+	}
+	if !unchoked[swarm.optimistic] || swarm.optimistic == "" {
+		t.Fatalf("optimistic unchoke %q should be unchoked", swarm.optimistic)
+	}
+}
+
+func TestOptimisticUnchokeRotates(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	handlers := newChokeTestPeers(t, swarm, config.UploadSlots+1)
+
+	now := time.Now()
+	swarm.rechoke(now)
+	first := swarm.optimistic
+
+	swarm.rechoke(now.Add(config.ChokeInterval))
+	if swarm.optimistic != first {
+		t.Fatalf("optimistic unchoke changed before its interval")
+	}
+
+	swarm.rechoke(now.Add(config.OptimisticUnchokeInterval))
+	if swarm.optimistic == first {
+		t.Fatalf("optimistic unchoke did not rotate")
+	}
+	if len(unchokedPeers(handlers)) != config.UploadSlots {
+		t.Fatalf("rotation should keep %d peers unchoked", config.UploadSlots)
+	}
+}
+
+func TestChokeRejectsQueuedRequests(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	ph, msgs := newTestPeer(t, swarm, "leecher", NewBitfield(4))
+	ph.uploadQueue = []uint64{1, 2}
+
+	ph.setChoking(true)
+
+	if msg := <-msgs; msg.Type != protocol.MsgChoke {
+		t.Fatalf("expected a choke, got %s", msg.Type)
+	}
+	serializer := NewProtobufSerializer()
+	for _, want := range []uint64{1, 2} {
+		msg := <-msgs
+		var reject protocol.RejectPayload
+		if msg.Type != protocol.MsgReject || serializer.UnmarshalRejectPayload(msg.Payload, &reject) != nil {
+			t.Fatalf("expected a reject, got %s", msg.Type)
+		}
+		if reject.UnitIndex != want || reject.Reason != protocol.RejectChoked {
+			t.Fatalf("expected reject %d/%s, got %d/%s", want, protocol.RejectChoked, reject.UnitIndex, reject.Reason)
+		}
+	}
+
+	payload, _ := serializer.MarshalTransferRequestPayload(&protocol.TransferRequestPayload{UnitIndex: 3})
+	ph.HandleMessage(protocol.PeerMessage{InfoHash: swarm.InfoHash, Type: protocol.MsgRequest, Payload: payload})
+	if msg := <-msgs; msg.Type != protocol.MsgReject {
+		t.Fatalf("a choked peer's request should be rejected, got %s", msg.Type)
+	}
+}
+
+func TestSchedulerWaitsForUnchoke(t *testing.T) {
+	swarm := newTestSwarm(t, 2)
+	ph, msgs := newTestPeer(t, swarm, "seeder", bitfieldOf(2, 0, 1))
+	ph.peerChoking = true
+
+	swarm.TransferUnitManager.scheduleDownloads()
+	if primaryFor(swarm.TransferUnitManager, 0) != "" {
+		t.Fatalf("nothing should be requested from a peer that chokes us")
+	}
+
+	ph.HandleMessage(protocol.PeerMessage{InfoHash: swarm.InfoHash, Type: protocol.MsgUnchoke})
+	expectUnits(t, ph.Peer, msgs, protocol.MsgRequest, 0, 1)
+}
@@ -2,8 +2,10 @@ package core
 
 import (
 	"context"
+	"log"
 	"sync"
 
+	"github.com/baoswarm/baobun/internal/config"
 	"github.com/baoswarm/baobun/pkg/protocol"
 )
 
@@ -17,10 +19,32 @@ type Client struct {
 	Transport TrackerTransport
 	Sessions  *SessionManager
 
-	Swarms map[protocol.InfoHash]*Swarm
+	Swarms *SwarmRegistry
+
+	// Serializes addSwarm, so a swarm is only ever started once
+	addMu sync.Mutex
 
 	pauseMu sync.RWMutex
 	paused  map[protocol.InfoHash]bool
+
+	// Announced to for every swarm alongside its trackers, e.g. the DHT
+	discoveryMu sync.RWMutex
+	discovery   map[string]TrackerTransport
+
+	// Client-wide bandwidth limits, shared with every swarm
+	bandwidth *clientBandwidth
+
+	// Download queue: every swarm in priority order, the ones held back by
+	// the limits on active downloads and seeds, and those limits
+	queueMu      sync.Mutex
+	queueOrder   []protocol.InfoHash
+	queued       map[protocol.InfoHash]bool
+	maxDownloads int
+	maxSeeds     int
+
+	// Where the swarm list is persisted, once RestoreState has run
+	stateMu sync.Mutex
+	state   *StateStore
 }
 
 type TrackerTransport interface {
@@ -33,6 +57,12 @@ type TrackerTransport interface {
 	Close()
 }
 
+// PeerObserver is implemented by discovery sources that learn from the peers
+// we connect to, such as the DHT.
+type PeerObserver interface {
+	ObservePeer(peer protocol.NodeKey)
+}
+
 func NewClient(
 	nodeKey string,
 	transport TrackerTransport,
@@ -43,8 +73,55 @@ func NewClient(
 		NodeKey:   nodeKey,
 		Transport: transport,
 		Sessions:  sessions,
-		Swarms:    make(map[protocol.InfoHash]*Swarm),
+		Swarms:    NewSwarmRegistry(),
 		paused:    make(map[protocol.InfoHash]bool),
+		discovery: make(map[string]TrackerTransport),
+		bandwidth: newClientBandwidth(),
+
+		queued:       make(map[protocol.InfoHash]bool),
+		maxDownloads: config.MaxActiveDownloads,
+		maxSeeds:     config.MaxActiveSeeds,
+	}
+}
+
+// AddDiscovery registers a peer source that is announced to for every swarm,
+// the same way as its trackers. name is passed as the tracker key.
+func (c *Client) AddDiscovery(name string, source TrackerTransport) {
+	c.discoveryMu.Lock()
+	defer c.discoveryMu.Unlock()
+
+	c.discovery[name] = source
+}
+
+type announceTarget struct {
+	transport TrackerTransport
+	key       string
+}
+
+// announceTargets lists the trackers followed by every discovery source.
+func (c *Client) announceTargets(trackers []string) []announceTarget {
+	c.discoveryMu.RLock()
+	defer c.discoveryMu.RUnlock()
+
+	targets := make([]announceTarget, 0, len(trackers)+len(c.discovery))
+	for _, tracker := range trackers {
+		targets = append(targets, announceTarget{transport: c.Transport, key: tracker})
+	}
+	for name, source := range c.discovery {
+		targets = append(targets, announceTarget{transport: source, key: name})
+	}
+	return targets
+}
+
+// observePeer tells discovery sources about a peer we connected to.
+func (c *Client) observePeer(peer protocol.NodeKey) {
+	c.discoveryMu.RLock()
+	defer c.discoveryMu.RUnlock()
+
+	for _, source := range c.discovery {
+		if observer, ok := source.(PeerObserver); ok {
+			observer.ObservePeer(peer)
+		}
 	}
 }
 
@@ -54,37 +131,129 @@ func (c *Client) IsPaused(ih protocol.InfoHash) bool {
 	return c.paused[ih]
 }
 
+// PauseSwarm stops the swarm: its requests are dropped, peers disconnected
+// and trackers told it stopped.
 func (c *Client) PauseSwarm(ih protocol.InfoHash) bool {
-	swarm, ok := c.Swarms[ih]
+	swarm, ok := c.Swarms.Get(ih)
 	if !ok {
 		return false
 	}
 
+	wasIdle := c.isIdle(ih)
+
 	c.pauseMu.Lock()
 	c.paused[ih] = true
 	c.pauseMu.Unlock()
 
-	if swarm != nil {
-		swarm.DisconnectAll(c.Sessions)
+	c.queueMu.Lock()
+	delete(c.queued, ih)
+	c.queueMu.Unlock()
+
+	swarm.SetPaused(true)
+	swarm.DisconnectAll(c.Sessions)
+
+	// A queued swarm already announced it stopped
+	if !wasIdle {
+		go c.announceStopped(context.Background(), swarm)
 	}
+	swarm.emit(SwarmEvent{Kind: SwarmPaused})
+
+	// The freed slot may start a queued swarm
+	c.rebalanceQueue()
 
 	return true
 }
 
-func (c *Client) UnpauseSwarm(ih protocol.InfoHash) {
+// ResumeSwarm undoes PauseSwarm. The swarm announces it started and connects
+// to the peers it gets back, or is queued if there is no slot for it.
+func (c *Client) ResumeSwarm(ih protocol.InfoHash) bool {
+	swarm, ok := c.Swarms.Get(ih)
+	if !ok {
+		return false
+	}
+	if !c.IsPaused(ih) {
+		return true
+	}
+
 	c.pauseMu.Lock()
 	delete(c.paused, ih)
 	c.pauseMu.Unlock()
+
+	c.queueMu.Lock()
+	c.queued[ih] = true
+	c.queueMu.Unlock()
+
+	c.rebalance(ih)
+	if !c.isIdle(ih) {
+		go c.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+	}
+	swarm.emit(SwarmEvent{Kind: SwarmResumed})
+
+	return true
 }
 
+// RemoveSwarm stops the swarm and forgets it: trackers are told it stopped,
+// peers disconnected, its goroutines stopped and its files closed. The
+// returned swarm may only be used for its metadata and location.
 func (c *Client) RemoveSwarm(ih protocol.InfoHash) (*Swarm, bool) {
-	swarm, ok := c.Swarms[ih]
+	wasIdle := c.isIdle(ih)
+
+	swarm, ok := c.Swarms.Remove(ih)
 	if !ok {
 		return nil, false
 	}
 
-	delete(c.Swarms, ih)
-	c.UnpauseSwarm(ih)
+	if !wasIdle {
+		go c.announceStopped(context.Background(), swarm)
+	}
+	c.closeSwarm(swarm)
+
+	c.pauseMu.Lock()
+	delete(c.paused, ih)
+	c.pauseMu.Unlock()
+
+	c.dequeueSwarm(ih)
 
 	return swarm, true
 }
+
+// closeSwarm stops routing messages to the swarm, disconnects its peers and
+// closes it, which waits for its goroutines to finish.
+func (c *Client) closeSwarm(swarm *Swarm) {
+	if c.Sessions != nil {
+		c.Sessions.UnregisterSwarm(swarm.InfoHash)
+	}
+	swarm.DisconnectAll(c.Sessions)
+	if err := swarm.Close(); err != nil {
+		log.Printf("failed to close swarm %s: %v", swarm.InfoHash, err)
+	}
+}
+
+// Close shuts the client down: the state is saved, every running swarm
+// announces it stopped (until ctx expires), peers are disconnected, files
+// closed, and finally the transport is closed.
+func (c *Client) Close(ctx context.Context) {
+	c.SaveState()
+
+	var wg sync.WaitGroup
+	swarms := c.Swarms.All()
+	for _, swarm := range swarms {
+		if c.isIdle(swarm.InfoHash) {
+			continue
+		}
+		wg.Add(1)
+		go func(swarm *Swarm) {
+			defer wg.Done()
+			c.announceStopped(ctx, swarm)
+		}(swarm)
+	}
+	wg.Wait()
+
+	for _, swarm := range swarms {
+		c.closeSwarm(swarm)
+	}
+
+	if c.Transport != nil {
+		c.Transport.Close()
+	}
+}
@@ -10,7 +10,7 @@ import (
 )
 
 func (c *Client) ConnectPeer(swarm *Swarm, peerKey protocol.NodeKey) {
-	if c.IsPaused(swarm.InfoHash) {
+	if c.isIdle(swarm.InfoHash) {
 		return
 	}
 
@@ -22,6 +22,7 @@ func (c *Client) ConnectPeer(swarm *Swarm, peerKey protocol.NodeKey) {
 	}
 
 	log.Printf("Successfully connected to peer %s for swarm %s", peerKey, swarm.InfoHash)
+	c.observePeer(peerKey)
 }
 
 func (c *Client) AnnounceSwarm(
@@ -29,20 +30,20 @@ func (c *Client) AnnounceSwarm(
 	ih protocol.InfoHash,
 	event protocol.AnnounceEvent,
 ) {
-	swarm, ok := c.Swarms[ih]
+	swarm, ok := c.Swarms.Get(ih)
 	if !ok {
 		log.Printf("swarm not found: %s", ih)
 		return
 	}
-	if c.IsPaused(ih) {
+	if c.isIdle(ih) {
 		return
 	}
 
 	req := protocol.AnnounceRequest{
 		InfoHash:   ih,
 		Event:      event,
-		Uploaded:   swarm.Uploaded,
-		Downloaded: swarm.Downloaded,
+		Uploaded:   swarm.Uploaded.Load(),
+		Downloaded: swarm.Downloaded.Load(),
 		Left:       swarm.CalcLeft(),
 		Timestamp:  uint64(time.Now().Unix()),
 	}
@@ -50,10 +51,9 @@ func (c *Client) AnnounceSwarm(
 	// Track successful connections for logging
 	successfulConnections := 0
 
-	for _, tracker := range swarm.File.Trackers {
-		resp, err := c.Transport.Announce(ctx, tracker, req)
+	for _, target := range c.announceTargets(swarm.File.Trackers) {
+		resp, err := c.announceTo(ctx, swarm, target, req)
 		if err != nil {
-			log.Printf("announce failed (%s): %v", tracker, err)
 			continue
 		}
 
@@ -72,15 +72,13 @@ func (c *Client) AnnounceSwarm(
 			}
 
 			// Connect in background with proper synchronization
-			go func(p protocol.NodeKey) {
-				c.ConnectPeer(swarm, p)
-				successfulConnections++
-			}(peer.NodeKey)
+			go c.ConnectPeer(swarm, peer.NodeKey)
+			successfulConnections++
 		}
 
 		log.Printf(
 			"announced to %s → %d new peers",
-			tracker,
+			target.key,
 			len(resp.Peers),
 		)
 	}
@@ -92,24 +90,23 @@ func (c *Client) AnnounceSwarm(
 func (c *Client) ReannounceAllSwarms(
 	ctx context.Context,
 ) {
-	for _, swarm := range c.Swarms {
-		if c.IsPaused(swarm.InfoHash) {
+	for _, swarm := range c.Swarms.All() {
+		if c.isIdle(swarm.InfoHash) {
 			continue
 		}
 
 		req := protocol.AnnounceRequest{
 			InfoHash:   swarm.InfoHash,
 			Event:      "",
-			Uploaded:   swarm.Uploaded,
-			Downloaded: swarm.Downloaded,
+			Uploaded:   swarm.Uploaded.Load(),
+			Downloaded: swarm.Downloaded.Load(),
 			Left:       swarm.CalcLeft(),
 			Timestamp:  uint64(time.Now().Unix()),
 		}
 
-		for _, tracker := range swarm.File.Trackers {
-			resp, err := c.Transport.Announce(ctx, tracker, req)
+		for _, target := range c.announceTargets(swarm.File.Trackers) {
+			resp, err := c.announceTo(ctx, swarm, target, req)
 			if err != nil {
-				log.Printf("announce failed (%s): %v", tracker, err)
 				continue
 			}
 			for _, peer := range resp.Peers {
@@ -122,7 +119,7 @@ func (c *Client) ReannounceAllSwarms(
 				ph, exists := swarm.Peers[peer.NodeKey]
 				swarm.mu.RUnlock()
 
-				if exists && ph.state != protocol.StateClosed {
+				if exists && ph.GetState() != protocol.StateClosed {
 					continue
 				}
 
@@ -134,9 +131,30 @@ func (c *Client) ReannounceAllSwarms(
 
 			log.Printf(
 				"announced to %s → %d new peers",
-				tracker,
+				target.key,
 				len(resp.Peers),
 			)
 		}
 	}
 }
+
+// announceTo sends one announce and publishes its outcome on the swarm.
+func (c *Client) announceTo(
+	ctx context.Context,
+	swarm *Swarm,
+	target announceTarget,
+	req protocol.AnnounceRequest,
+) (protocol.AnnounceResponse, error) {
+	resp, err := target.transport.Announce(ctx, target.key, req)
+	if err != nil {
+		log.Printf("announce failed (%s): %v", target.key, err)
+	}
+
+	swarm.emit(SwarmEvent{
+		Kind:    SwarmAnnounced,
+		Tracker: target.key,
+		Peers:   len(resp.Peers),
+		Err:     err,
+	})
+	return resp, err
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/baoswarm/baobun/internal/config"
+)
+
+// ContentReader reads a swarm's file as it downloads. Reads of units that
+// have not been verified yet bump them to the front of the download queue
+// and block until they arrive, so it can back an HTTP range response. The
+// units stay urgent until the reader seeks away or its context ends.
+type ContentReader struct {
+	swarm *Swarm
+	ctx   context.Context
+
+	// Window of the content being read, e.g. one file of a directory bao
+	base   int64
+	length int64
+
+	offset int64
+
+	// Units this reader marked urgent, released on Seek or when ctx is done
+	urgentMu    sync.Mutex
+	urgent      bool
+	urgentStart uint64
+	urgentEnd   uint64
+}
+
+func (s *Swarm) NewContentReader(ctx context.Context) *ContentReader {
+	return s.newContentReader(ctx, 0, int64(s.File.Length))
+}
+
+// NewFileContentReader reads a single file of the bao by its relative path.
+func (s *Swarm) NewFileContentReader(ctx context.Context, relPath string) (*ContentReader, error) {
+	entry, offset, ok := s.File.FileOffset(relPath)
+	if !ok {
+		return nil, fmt.Errorf("no file %q in bao", relPath)
+	}
+	return s.newContentReader(ctx, int64(offset), int64(entry.Length)), nil
+}
+
+func (s *Swarm) newContentReader(ctx context.Context, base, length int64) *ContentReader {
+	cr := &ContentReader{swarm: s, ctx: ctx, base: base, length: length}
+	context.AfterFunc(ctx, cr.releaseUrgent)
+	return cr
+}
+
+func (cr *ContentReader) Read(p []byte) (int, error) {
+	if cr.offset >= cr.length {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Position in the concatenated content
+	pos := cr.base + cr.offset
+	length := cr.base + cr.length
+
+	unitSize := int64(config.TransferUnitSize)
+	first := uint64(pos / unitSize)
+
+	// Playback follows the reader, so the streaming window slides with it.
+	cr.swarm.TransferUnitManager.SetPlaybackPosition(uint64(pos))
+
+	if !cr.swarm.FileIO.HasTransferUnit(first) {
+		cr.markUrgent(first, first+uint64(config.ContentReadAheadUnits))
+
+		if err := cr.swarm.WaitForTransferUnit(cr.ctx, first); err != nil {
+			return 0, err
+		}
+	}
+
+	// Read through every contiguous verified unit, up to len(p).
+	end := pos + int64(len(p))
+	if end > length {
+		end = length
+	}
+	readable := (int64(first) + 1) * unitSize
+	for readable < end && cr.swarm.FileIO.HasTransferUnit(uint64(readable/unitSize)) {
+		readable += unitSize
+	}
+	if end > readable {
+		end = readable
+	}
+
+	data, err := cr.swarm.FileIO.ReadRange(uint64(pos), uint64(end-pos))
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(p, data)
+	cr.offset += int64(n)
+	return n, nil
+}
+
+func (cr *ContentReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = cr.offset + offset
+	case io.SeekEnd:
+		abs = cr.length + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	// A player that seeks away no longer needs what it was waiting for.
+	if abs != cr.offset {
+		cr.releaseUrgent()
+	}
+
+	cr.offset = abs
+	return abs, nil
+}
+
+// markUrgent prioritizes units [start, end] for this reader, releasing the
+// range it marked before.
+func (cr *ContentReader) markUrgent(start, end uint64) {
+	cr.urgentMu.Lock()
+	defer cr.urgentMu.Unlock()
+
+	if cr.urgent && cr.urgentStart == start && cr.urgentEnd == end {
+		return
+	}
+	// Once ctx is done releaseUrgent has run or is about to; marking now
+	// would leave units urgent for a reader that is gone.
+	if cr.ctx.Err() != nil {
+		return
+	}
+
+	pm := cr.swarm.TransferUnitManager
+	if cr.urgent {
+		pm.Release(cr.urgentStart, cr.urgentEnd)
+	}
+	pm.Prioritize(start, end)
+	cr.urgent, cr.urgentStart, cr.urgentEnd = true, start, end
+}
+
+func (cr *ContentReader) releaseUrgent() {
+	cr.urgentMu.Lock()
+	defer cr.urgentMu.Unlock()
+
+	if cr.urgent {
+		cr.swarm.TransferUnitManager.Release(cr.urgentStart, cr.urgentEnd)
+		cr.urgent = false
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+)
+
+func TestContentReaderBlocksUntilUnitVerified(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	unitSize := config.TransferUnitSize
+
+	unit2 := bytes.Repeat([]byte{2}, unitSize)
+	reader := swarm.NewContentReader(context.Background())
+	if _, err := reader.Seek(int64(unitSize)*2+100, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	buf := make([]byte, unitSize)
+	go func() {
+		n, err := reader.Read(buf)
+		done <- result{n, err}
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("read returned before the unit was available")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	swarm.TransferUnitManager.mu.RLock()
+	_, urgent := swarm.TransferUnitManager.urgent[2]
+	swarm.TransferUnitManager.mu.RUnlock()
+	if !urgent {
+		t.Fatalf("blocked unit should be prioritized")
+	}
+	if got := swarm.TransferUnitManager.PlaybackPosition(); got != uint64(unitSize)*2 {
+		t.Fatalf("read should move the playback cursor to unit 2, got offset %d", got)
+	}
+
+	if err := swarm.FileIO.WriteTransferUnit(2, unit2); err != nil {
+		t.Fatalf("write unit: %v", err)
+	}
+	swarm.MarkTransferUnitComplete(2, unit2)
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("read: %v", res.err)
+		}
+		// Unit 3 is still missing, so the read stops at the unit boundary.
+		if res.n != unitSize-100 {
+			t.Fatalf("expected %d bytes, got %d", unitSize-100, res.n)
+		}
+		if !bytes.Equal(buf[:res.n], unit2[100:]) {
+			t.Fatalf("read returned wrong data")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("read did not wake after the unit arrived")
+	}
+}
+
+func TestContentReaderCancel(t *testing.T) {
+	swarm := newTestSwarm(t, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := swarm.NewContentReader(ctx)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := reader.Read(make([]byte, 16)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func urgentUnits(pm *TransferUnitManager) int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return len(pm.urgent)
+}
+
+func TestContentReaderReleasesUrgentOnCancel(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	pm := swarm.TransferUnitManager
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := swarm.NewContentReader(ctx)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := reader.Read(make([]byte, 16))
+		done <- err
+	}()
+
+	if !waitFor(t, 2*time.Second, func() bool { return urgentUnits(pm) > 0 }) {
+		t.Fatalf("blocked read should mark units urgent")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if !waitFor(t, 2*time.Second, func() bool { return urgentUnits(pm) == 0 }) {
+		t.Fatalf("an abandoned read should release its urgent units")
+	}
+}
+
+func TestContentReaderReleasesUrgentOnSeek(t *testing.T) {
+	swarm := newTestSwarm(t, 8)
+	pm := swarm.TransferUnitManager
+
+	a := swarm.NewContentReader(context.Background())
+	b := swarm.NewContentReader(context.Background())
+	a.markUrgent(2, 4)
+	b.markUrgent(4, 5)
+
+	if _, err := a.Seek(int64(config.TransferUnitSize)*6, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	pm.mu.RLock()
+	_, kept := pm.urgent[4]
+	_, released := pm.urgent[2]
+	count := len(pm.urgent)
+	pm.mu.RUnlock()
+	if released || !kept || count != 2 {
+		t.Fatalf("seek should release only the seeking reader's marks, urgent=%d unit2=%v unit4=%v", count, released, kept)
+	}
+
+	// A later read moves the reader's mark instead of adding to it.
+	b.markUrgent(6, 7)
+	if got := urgentUnits(pm); got != 2 {
+		t.Fatalf("reader should hold only its latest range, got %d urgent units", got)
+	}
+}
+
+func TestUrgentUnitsScheduledFirst(t *testing.T) {
+	swarm := newTestSwarm(t, 8)
+	pm := swarm.TransferUnitManager
+
+	pm.UpdatePeerBitfield("a", bitfieldOf(8, 0, 1, 2, 3, 4, 5, 6, 7))
+	pm.Prioritize(6, 7)
+
+	pm.mu.Lock()
+	pm.strategy = StrategySequential
+	candidates := pm.candidatesLocked()
+	pm.mu.Unlock()
+
+	if len(candidates) != 8 || candidates[0] != 6 || candidates[1] != 7 || candidates[2] != 0 {
+		t.Fatalf("urgent units should lead the candidates, got %v", candidates)
+	}
+}
@@ -0,0 +1,464 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// DHT is a Kademlia-style table of which nodes are in which swarm, spoken
+// over the same peer sessions as swarm traffic. Node IDs and InfoHashes share
+// one keyspace; a swarm's peers are stored on the nodes closest to its
+// InfoHash. It satisfies TrackerTransport so the Client announces to it like
+// any tracker.
+type DHT struct {
+	self       protocol.NodeKey
+	sessions   *SessionManager
+	table      *routingTable
+	store      *dhtPeerStore
+	serializer Serializer
+
+	nextTxID atomic.Uint64
+
+	mu        sync.Mutex
+	pending   map[uint64]dhtPending
+	announced map[protocol.InfoHash]dhtAnnounce
+	observed  map[protocol.NodeKey]time.Time
+}
+
+type dhtPending struct {
+	peer protocol.NodeKey
+	ch   chan protocol.DHTPayload
+}
+
+// dhtAnnounce caches a swarm's last lookup so frequent reannounces do not
+// each walk the network.
+type dhtAnnounce struct {
+	at    time.Time
+	peers []protocol.Peer
+}
+
+var errDHTEmpty = errors.New("dht routing table is empty")
+
+// NewDHT creates the DHT for the node self and starts answering DHT queries
+// arriving on sessions.
+func NewDHT(self protocol.NodeKey, sessions *SessionManager) *DHT {
+	d := &DHT{
+		self:       self,
+		sessions:   sessions,
+		table:      newRoutingTable(self),
+		store:      newDHTPeerStore(),
+		serializer: NewProtobufSerializer(),
+		pending:    make(map[uint64]dhtPending),
+		announced:  make(map[protocol.InfoHash]dhtAnnounce),
+		observed:   make(map[protocol.NodeKey]time.Time),
+	}
+
+	sessions.mu.Lock()
+	sessions.dht = d
+	sessions.mu.Unlock()
+
+	return d
+}
+
+// Announce looks up the peers stored for the InfoHash, stores us on the
+// closest nodes and returns the peers found. The tracker key is ignored.
+func (d *DHT) Announce(
+	ctx context.Context,
+	_ string,
+	req protocol.AnnounceRequest,
+) (protocol.AnnounceResponse, error) {
+	resp := protocol.AnnounceResponse{
+		Interval: int(config.DHTAnnounceInterval / time.Second),
+		Peers:    make([]protocol.Peer, 0),
+	}
+
+	if req.Event == protocol.EventStopped {
+		// Entries on remote nodes expire on their own
+		d.store.remove(req.InfoHash, d.self)
+		d.mu.Lock()
+		delete(d.announced, req.InfoHash)
+		d.mu.Unlock()
+		return resp, nil
+	}
+
+	now := time.Now()
+	d.store.add(req.InfoHash, d.self, req.Left == 0, now)
+
+	d.mu.Lock()
+	last, cached := d.announced[req.InfoHash]
+	d.mu.Unlock()
+	if cached && req.Event == "" && now.Sub(last.at) < config.DHTAnnounceInterval {
+		resp.Peers = d.mergePeers(last.peers, d.store.get(req.InfoHash, now))
+		return resp, nil
+	}
+
+	if d.table.size() == 0 {
+		return resp, errDHTEmpty
+	}
+
+	target := dhtID(req.InfoHash)
+	closest, peers := d.lookup(ctx, target, true)
+
+	var wg sync.WaitGroup
+	for _, node := range closest {
+		wg.Add(1)
+		go func(node protocol.NodeKey) {
+			defer wg.Done()
+			_, err := d.query(ctx, node, protocol.DHTPayload{
+				Method: protocol.DHTAnnouncePeer,
+				Target: target[:],
+				Seeder: req.Left == 0,
+			})
+			if err != nil {
+				log.Printf("dht announce to %s failed: %v", node, err)
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	d.announced[req.InfoHash] = dhtAnnounce{at: now, peers: peers}
+	d.mu.Unlock()
+
+	resp.Peers = d.mergePeers(peers, d.store.get(req.InfoHash, now))
+	return resp, nil
+}
+
+func (d *DHT) Close() {}
+
+// mergePeers combines peer lists, dropping duplicates and ourselves.
+func (d *DHT) mergePeers(lists ...[]protocol.Peer) []protocol.Peer {
+	seen := make(map[protocol.NodeKey]bool)
+	out := make([]protocol.Peer, 0)
+	for _, list := range lists {
+		for _, p := range list {
+			if p.NodeKey == d.self || seen[p.NodeKey] {
+				continue
+			}
+			seen[p.NodeKey] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Bootstrap pings the given nodes and then looks up our own ID, which fills
+// the routing table with the nodes around us. It returns the table size.
+func (d *DHT) Bootstrap(ctx context.Context, nodes []protocol.NodeKey) int {
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		if node == d.self {
+			continue
+		}
+		wg.Add(1)
+		go func(node protocol.NodeKey) {
+			defer wg.Done()
+			d.ping(ctx, node)
+		}(node)
+	}
+	wg.Wait()
+
+	if d.table.size() > 0 {
+		d.lookup(ctx, nodeIDOf(d.self), false)
+	}
+
+	size := d.table.size()
+	log.Printf("DHT bootstrapped with %d nodes", size)
+	return size
+}
+
+// ObservePeer pings a peer we connected to for a swarm, adding it to the
+// routing table if it runs the DHT. Each peer is tried once per
+// DHTNodeStaleAfter.
+func (d *DHT) ObservePeer(peer protocol.NodeKey) {
+	now := time.Now()
+
+	d.mu.Lock()
+	last, tried := d.observed[peer]
+	if tried && now.Sub(last) < config.DHTNodeStaleAfter {
+		d.mu.Unlock()
+		return
+	}
+	d.observed[peer] = now
+	d.mu.Unlock()
+
+	go d.ping(context.Background(), peer)
+}
+
+func (d *DHT) ping(ctx context.Context, node protocol.NodeKey) bool {
+	_, err := d.query(ctx, node, protocol.DHTPayload{Method: protocol.DHTPing})
+	return err == nil
+}
+
+// Nodes returns every contact in the routing table.
+func (d *DHT) Nodes() []protocol.NodeKey {
+	return d.table.closest(nodeIDOf(d.self), d.table.size(), "")
+}
+
+type dhtNodesFile struct {
+	Nodes []protocol.NodeKey `json:"nodes"`
+}
+
+// SaveNodes writes the routing table contacts to path, so the next start can
+// bootstrap from them.
+func (d *DHT) SaveNodes(path string) error {
+	data, err := json.MarshalIndent(dhtNodesFile{Nodes: d.Nodes()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode dht nodes: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create dht directory: %w", err)
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// LoadDHTNodes reads contacts saved by SaveNodes. A missing file yields none.
+func LoadDHTNodes(path string) ([]protocol.NodeKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dht nodes: %w", err)
+	}
+
+	var file dhtNodesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode dht nodes: %w", err)
+	}
+	return file.Nodes, nil
+}
+
+// lookup walks towards target, querying DHTAlpha nodes at a time, until the
+// DHTBucketSize closest nodes seen have all answered. With getPeers it also
+// collects the peers those nodes store for target.
+func (d *DHT) lookup(ctx context.Context, target dhtID, getPeers bool) ([]protocol.NodeKey, []protocol.Peer) {
+	method := protocol.DHTFindNode
+	if getPeers {
+		method = protocol.DHTGetPeers
+	}
+
+	type result struct {
+		node protocol.NodeKey
+		resp protocol.DHTPayload
+		err  error
+	}
+
+	candidates := d.table.closest(target, config.DHTBucketSize, "")
+	known := make(map[protocol.NodeKey]bool)
+	for _, node := range candidates {
+		known[node] = true
+	}
+	queried := make(map[protocol.NodeKey]bool)
+	responded := make(map[protocol.NodeKey]bool)
+	var peers []protocol.Peer
+
+	for ctx.Err() == nil {
+		sort.Slice(candidates, func(i, j int) bool {
+			return closerTo(target, nodeIDOf(candidates[i]), nodeIDOf(candidates[j]))
+		})
+
+		// Query the closest unqueried nodes among the current best k
+		batch := make([]protocol.NodeKey, 0, config.DHTAlpha)
+		considered := 0
+		for _, node := range candidates {
+			if considered == config.DHTBucketSize || len(batch) == config.DHTAlpha {
+				break
+			}
+			if queried[node] && !responded[node] {
+				continue // failed nodes do not count towards the k closest
+			}
+			considered++
+			if !queried[node] {
+				batch = append(batch, node)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		results := make(chan result, len(batch))
+		for _, node := range batch {
+			queried[node] = true
+			go func(node protocol.NodeKey) {
+				resp, err := d.query(ctx, node, protocol.DHTPayload{Method: method, Target: target[:]})
+				results <- result{node: node, resp: resp, err: err}
+			}(node)
+		}
+
+		for range batch {
+			r := <-results
+			if r.err != nil {
+				continue
+			}
+			responded[r.node] = true
+			peers = append(peers, r.resp.Peers...)
+
+			for i, node := range r.resp.Nodes {
+				if i == config.DHTBucketSize {
+					break
+				}
+				if node == "" || node == d.self || known[node] {
+					continue
+				}
+				known[node] = true
+				candidates = append(candidates, node)
+			}
+		}
+	}
+
+	closest := make([]protocol.NodeKey, 0, config.DHTBucketSize)
+	for _, node := range candidates {
+		if responded[node] {
+			closest = append(closest, node)
+			if len(closest) == config.DHTBucketSize {
+				break
+			}
+		}
+	}
+
+	return closest, d.mergePeers(peers)
+}
+
+// query sends one DHT query and waits for the answer. Nodes that answer are
+// added to the routing table, nodes that do not are dropped from it.
+func (d *DHT) query(ctx context.Context, node protocol.NodeKey, payload protocol.DHTPayload) (protocol.DHTPayload, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.DHTQueryTimeout)
+	defer cancel()
+
+	payload.TransactionID = d.nextTxID.Add(1)
+	ch := make(chan protocol.DHTPayload, 1)
+
+	d.mu.Lock()
+	d.pending[payload.TransactionID] = dhtPending{peer: node, ch: ch}
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, payload.TransactionID)
+		d.mu.Unlock()
+	}()
+
+	// The session is held until the answer arrives
+	sess, err := d.sessions.GetSession(node)
+	if err != nil {
+		d.table.remove(node)
+		return protocol.DHTPayload{}, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer d.sessions.Release(node)
+
+	if err := d.send(sess, protocol.MsgDHTQuery, &payload); err != nil {
+		d.table.remove(node)
+		return protocol.DHTPayload{}, err
+	}
+
+	select {
+	case resp := <-ch:
+		d.table.seen(node, time.Now())
+		if resp.Error != "" {
+			return resp, fmt.Errorf("dht %s to %s: %s", payload.Method, node, resp.Error)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		d.table.remove(node)
+		return protocol.DHTPayload{}, ctx.Err()
+	}
+}
+
+func (d *DHT) send(sess *Session, typ protocol.PeerMessageType, payload *protocol.DHTPayload) error {
+	data, err := d.serializer.MarshalDHTPayload(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dht payload: %w", err)
+	}
+
+	return sess.Send(d.serializer, protocol.PeerMessage{
+		Type:    typ,
+		Payload: data,
+	})
+}
+
+func (d *DHT) handleQuery(sess *Session, msg protocol.PeerMessage) {
+	var query protocol.DHTPayload
+	if err := d.serializer.UnmarshalDHTPayload(msg.Payload, &query); err != nil {
+		log.Printf("Failed to unmarshal dht query from %s: %v", sess.peer, err)
+		return
+	}
+
+	now := time.Now()
+	d.table.seen(sess.peer, now)
+
+	resp := protocol.DHTPayload{
+		TransactionID: query.TransactionID,
+		Method:        query.Method,
+	}
+
+	var target dhtID
+	if query.Method != protocol.DHTPing {
+		if len(query.Target) != len(target) {
+			resp.Error = "invalid target"
+			d.reply(sess, &resp)
+			return
+		}
+		copy(target[:], query.Target)
+	}
+
+	switch query.Method {
+	case protocol.DHTPing:
+	case protocol.DHTFindNode:
+		resp.Nodes = d.table.closest(target, config.DHTBucketSize, sess.peer)
+	case protocol.DHTGetPeers:
+		resp.Nodes = d.table.closest(target, config.DHTBucketSize, sess.peer)
+		resp.Peers = d.store.get(protocol.InfoHash(target), now)
+	case protocol.DHTAnnouncePeer:
+		// The sender can only announce itself, and only where the transport
+		// verified who it is; otherwise anyone could announce any address.
+		if sess.claimed {
+			resp.Error = "announce needs an authenticated session"
+			break
+		}
+		d.store.add(protocol.InfoHash(target), sess.peer, query.Seeder, now)
+	default:
+		resp.Error = "unknown method"
+	}
+
+	d.reply(sess, &resp)
+}
+
+func (d *DHT) reply(sess *Session, resp *protocol.DHTPayload) {
+	if err := d.send(sess, protocol.MsgDHTResponse, resp); err != nil {
+		log.Printf("Failed to send dht response to %s: %v", sess.peer, err)
+	}
+}
+
+func (d *DHT) handleResponse(peer protocol.NodeKey, msg protocol.PeerMessage) {
+	var resp protocol.DHTPayload
+	if err := d.serializer.UnmarshalDHTPayload(msg.Payload, &resp); err != nil {
+		log.Printf("Failed to unmarshal dht response from %s: %v", peer, err)
+		return
+	}
+
+	d.mu.Lock()
+	pending, ok := d.pending[resp.TransactionID]
+	if ok && pending.peer == peer {
+		delete(d.pending, resp.TransactionID)
+	}
+	d.mu.Unlock()
+
+	if !ok || pending.peer != peer {
+		log.Printf("Unexpected dht response from %s", peer)
+		return
+	}
+	pending.ch <- resp
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"bytes"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+	"github.com/zeebo/blake3"
+)
+
+// dhtID places nodes and InfoHashes in the same 256-bit keyspace.
+type dhtID [32]byte
+
+func nodeIDOf(key protocol.NodeKey) dhtID {
+	return blake3.Sum256([]byte(key))
+}
+
+func (id dhtID) xor(other dhtID) dhtID {
+	var out dhtID
+	for i := range id {
+		out[i] = id[i] ^ other[i]
+	}
+	return out
+}
+
+// bucketIndex is the length of the prefix id shares with self; 256 for self.
+func (id dhtID) bucketIndex(self dhtID) int {
+	d := id.xor(self)
+	for i, b := range d {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return len(d) * 8
+}
+
+// closerTo reports whether a is closer to target than b.
+func closerTo(target, a, b dhtID) bool {
+	da, db := a.xor(target), b.xor(target)
+	return bytes.Compare(da[:], db[:]) < 0
+}
+
+type dhtContact struct {
+	key      protocol.NodeKey
+	id       dhtID
+	lastSeen time.Time
+}
+
+// routingTable keeps up to DHTBucketSize contacts per shared-prefix length.
+// A full bucket only admits a new contact by evicting a stale one, which
+// favours long-lived nodes as Kademlia intends.
+type routingTable struct {
+	self    dhtID
+	mu      sync.Mutex
+	buckets [257][]dhtContact
+}
+
+func newRoutingTable(self protocol.NodeKey) *routingTable {
+	return &routingTable{self: nodeIDOf(self)}
+}
+
+// seen adds key or refreshes it. It returns false if the bucket was full of
+// fresh contacts.
+func (rt *routingTable) seen(key protocol.NodeKey, now time.Time) bool {
+	id := nodeIDOf(key)
+	if id == rt.self {
+		return false
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	idx := id.bucketIndex(rt.self)
+	bucket := rt.buckets[idx]
+	for i := range bucket {
+		if bucket[i].key == key {
+			bucket[i].lastSeen = now
+			return true
+		}
+	}
+
+	contact := dhtContact{key: key, id: id, lastSeen: now}
+	if len(bucket) < config.DHTBucketSize {
+		rt.buckets[idx] = append(bucket, contact)
+		return true
+	}
+
+	oldest := 0
+	for i := range bucket {
+		if bucket[i].lastSeen.Before(bucket[oldest].lastSeen) {
+			oldest = i
+		}
+	}
+	if now.Sub(bucket[oldest].lastSeen) < config.DHTNodeStaleAfter {
+		return false
+	}
+	bucket[oldest] = contact
+	return true
+}
+
+func (rt *routingTable) remove(key protocol.NodeKey) {
+	id := nodeIDOf(key)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	idx := id.bucketIndex(rt.self)
+	bucket := rt.buckets[idx]
+	for i := range bucket {
+		if bucket[i].key == key {
+			rt.buckets[idx] = append(bucket[:i], bucket[i+1:]...)
+			return
+		}
+	}
+}
+
+// closest returns up to n known contacts nearest to target, excluding skip.
+func (rt *routingTable) closest(target dhtID, n int, skip protocol.NodeKey) []protocol.NodeKey {
+	rt.mu.Lock()
+	all := make([]dhtContact, 0, 64)
+	for _, bucket := range rt.buckets {
+		for _, c := range bucket {
+			if c.key != skip {
+				all = append(all, c)
+			}
+		}
+	}
+	rt.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return closerTo(target, all[i].id, all[j].id)
+	})
+	if len(all) > n {
+		all = all[:n]
+	}
+
+	out := make([]protocol.NodeKey, len(all))
+	for i, c := range all {
+		out[i] = c.key
+	}
+	return out
+}
+
+func (rt *routingTable) size() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	n := 0
+	for _, bucket := range rt.buckets {
+		n += len(bucket)
+	}
+	return n
+}
+
+type dhtStoredPeer struct {
+	seeder  bool
+	expires time.Time
+}
+
+// dhtPeerStore holds the peers announced to us for InfoHashes we are close to.
+type dhtPeerStore struct {
+	mu    sync.Mutex
+	peers map[protocol.InfoHash]map[protocol.NodeKey]dhtStoredPeer
+}
+
+func newDHTPeerStore() *dhtPeerStore {
+	return &dhtPeerStore{peers: make(map[protocol.InfoHash]map[protocol.NodeKey]dhtStoredPeer)}
+}
+
+// add stores an announced peer. When a cap is reached, expired entries are
+// dropped before the peer is refused, so stale announces cannot fill it.
+func (ps *dhtPeerStore) add(ih protocol.InfoHash, peer protocol.NodeKey, seeder bool, now time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	stored, ok := ps.peers[ih]
+	if !ok {
+		if len(ps.peers) >= config.DHTMaxInfoHashes {
+			for other := range ps.peers {
+				ps.expireLocked(other, now)
+			}
+			if len(ps.peers) >= config.DHTMaxInfoHashes {
+				return
+			}
+		}
+		stored = make(map[protocol.NodeKey]dhtStoredPeer)
+		ps.peers[ih] = stored
+	}
+	if _, exists := stored[peer]; !exists && len(stored) >= config.DHTMaxStoredPeers {
+		ps.expireLocked(ih, now)
+		if len(stored) >= config.DHTMaxStoredPeers {
+			return
+		}
+		ps.peers[ih] = stored // Dropped if every peer had expired
+	}
+	stored[peer] = dhtStoredPeer{seeder: seeder, expires: now.Add(config.DHTPeerTTL)}
+}
+
+// expireLocked drops the expired peers of ih, and ih itself once none are left.
+func (ps *dhtPeerStore) expireLocked(ih protocol.InfoHash, now time.Time) {
+	stored := ps.peers[ih]
+	for key, p := range stored {
+		if now.After(p.expires) {
+			delete(stored, key)
+		}
+	}
+	if stored != nil && len(stored) == 0 {
+		delete(ps.peers, ih)
+	}
+}
+
+func (ps *dhtPeerStore) remove(ih protocol.InfoHash, peer protocol.NodeKey) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if stored, ok := ps.peers[ih]; ok {
+		delete(stored, peer)
+		if len(stored) == 0 {
+			delete(ps.peers, ih)
+		}
+	}
+}
+
+// get returns unexpired peers for ih, dropping expired ones as it goes.
+func (ps *dhtPeerStore) get(ih protocol.InfoHash, now time.Time) []protocol.Peer {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.expireLocked(ih, now)
+	stored := ps.peers[ih]
+	out := make([]protocol.Peer, 0, len(stored))
+	for key, p := range stored {
+		out = append(out, protocol.Peer{NodeKey: key, IsSeeder: p.seeder})
+	}
+	return out
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func TestRoutingTableClosestAndEviction(t *testing.T) {
+	rt := newRoutingTable("self")
+	now := time.Now()
+
+	if rt.seen("self", now) {
+		t.Fatalf("a node must not add itself")
+	}
+
+	for i := 0; i < 200; i++ {
+		rt.seen(protocol.NodeKey(fmt.Sprintf("node-%d", i)), now)
+	}
+
+	// Many buckets overflowed, so only look for a contact that was kept
+	member := rt.closest(rt.self, 1, "")[0]
+	target := nodeIDOf(member)
+	closest := rt.closest(target, config.DHTBucketSize, "")
+	if len(closest) != config.DHTBucketSize || closest[0] != member {
+		t.Fatalf("expected %s first, got %v", member, closest)
+	}
+	for i := 1; i < len(closest); i++ {
+		if closerTo(target, nodeIDOf(closest[i]), nodeIDOf(closest[i-1])) {
+			t.Fatalf("closest is not sorted by distance: %v", closest)
+		}
+	}
+
+	// Half of all IDs share no prefix with self, so bucket 0 fills up
+	var full int
+	for idx, bucket := range rt.buckets {
+		if len(bucket) == config.DHTBucketSize {
+			full = idx
+			break
+		}
+	}
+	newcomer := protocol.NodeKey("")
+	for i := 0; ; i++ {
+		key := protocol.NodeKey(fmt.Sprintf("late-%d", i))
+		if nodeIDOf(key).bucketIndex(rt.self) == full {
+			newcomer = key
+			break
+		}
+	}
+
+	if rt.seen(newcomer, now) {
+		t.Fatalf("full bucket of fresh contacts should not admit a newcomer")
+	}
+	if !rt.seen(newcomer, now.Add(config.DHTNodeStaleAfter+time.Second)) {
+		t.Fatalf("a stale contact should be evicted for a newcomer")
+	}
+}
+
+func TestDHTPeerStoreCapsAndExpiry(t *testing.T) {
+	ps := newDHTPeerStore()
+	now := time.Now()
+	ih := protocol.InfoHash{3}
+
+	for i := 0; i < config.DHTMaxStoredPeers+5; i++ {
+		ps.add(ih, protocol.NodeKey(fmt.Sprintf("p%d", i)), false, now)
+	}
+	if got := len(ps.get(ih, now)); got != config.DHTMaxStoredPeers {
+		t.Fatalf("expected %d stored peers, got %d", config.DHTMaxStoredPeers, got)
+	}
+	if got := len(ps.get(ih, now.Add(config.DHTPeerTTL+time.Second))); got != 0 {
+		t.Fatalf("expected peers to expire, %d left", got)
+	}
+}
+
+func TestDHTPeerStoreSweepsExpiredWhenFull(t *testing.T) {
+	ps := newDHTPeerStore()
+	now := time.Now()
+
+	for i := 0; i < config.DHTMaxInfoHashes; i++ {
+		ps.add(protocol.InfoHash{byte(i), byte(i >> 8)}, "old", false, now)
+	}
+	fresh := protocol.InfoHash{0xff, 0xff, 0xff}
+	ps.add(fresh, "new", false, now)
+	if got := len(ps.get(fresh, now)); got != 0 {
+		t.Fatalf("a full store should refuse new InfoHashes, got %d peers", got)
+	}
+
+	later := now.Add(config.DHTPeerTTL + time.Second)
+	ps.add(fresh, "new", false, later)
+	if got := len(ps.get(fresh, later)); got != 1 {
+		t.Fatalf("expired InfoHashes should make room, got %d peers", got)
+	}
+	if len(ps.peers) != 1 {
+		t.Fatalf("expected the expired InfoHashes to be dropped, %d left", len(ps.peers))
+	}
+
+	ih := protocol.InfoHash{3}
+	for i := 0; i < config.DHTMaxStoredPeers; i++ {
+		ps.add(ih, protocol.NodeKey(fmt.Sprintf("p%d", i)), false, now)
+	}
+	ps.add(ih, "late", false, later)
+	if got := len(ps.get(ih, later)); got != 1 {
+		t.Fatalf("expired peers should make room for a new one, got %d", got)
+	}
+}
+
+func TestDHTRefusesAnnouncesFromClaimedIdentities(t *testing.T) {
+	network := pipetransport.NewNetwork()
+	node := newTestNode(t, network, tracker.NewDirectory(), "store", t.TempDir())
+	dht := NewDHT("store", node.client.Sessions)
+
+	remote, err := network.Listen("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	conn, err := remote.Dial("store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ih := protocol.InfoHash{5}
+	payload, err := dht.serializer.MarshalDHTPayload(&protocol.DHTPayload{
+		TransactionID: 1,
+		Method:        protocol.DHTAnnouncePeer,
+		Target:        ih[:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := protocol.PeerMessage{Type: protocol.MsgDHTQuery, Payload: payload}
+
+	dht.handleQuery(&Session{conn: conn, peer: "someone-else", claimed: true}, msg)
+	if got := dht.store.get(ih, time.Now()); len(got) != 0 {
+		t.Fatalf("announce over an unverified session was stored: %v", got)
+	}
+
+	dht.handleQuery(&Session{conn: conn, peer: "remote"}, msg)
+	if got := dht.store.get(ih, time.Now()); len(got) != 1 || got[0].NodeKey != "remote" {
+		t.Fatalf("expected the verified announce to be stored, got %v", got)
+	}
+}
+
+func TestSwarmTransferDiscoveredThroughDHT(t *testing.T) {
+	root, err := os.MkdirTemp("", "swarm-dht-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	network := pipetransport.NewNetwork()
+	directory := tracker.NewDirectory() // no trackers registered
+
+	// A handful of DHT-only nodes, each bootstrapped from the first
+	var dhts []*DHT
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("dht-%d", i)
+		node := newTestNode(t, network, directory, name, filepath.Join(root, name))
+		dht := NewDHT(protocol.NodeKey(name), node.client.Sessions)
+		dhts = append(dhts, dht)
+		if i > 0 {
+			dht.Bootstrap(context.Background(), []protocol.NodeKey{"dht-0"})
+		}
+	}
+
+	seedDir := filepath.Join(root, "seed")
+	leechDir := filepath.Join(root, "leech")
+	if err := os.MkdirAll(seedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := createSeedFile(t, seedDir, "dht.bin", config.TransferUnitSize*3)
+
+	seeder := newTestNode(t, network, directory, "seeder", seedDir)
+	leecher := newTestNode(t, network, directory, "leecher", leechDir)
+
+	for _, node := range []*testNode{seeder, leecher} {
+		dht := NewDHT(protocol.NodeKey(node.client.NodeKey), node.client.Sessions)
+		if dht.Bootstrap(context.Background(), []protocol.NodeKey{"dht-3"}) == 0 {
+			t.Fatalf("%s failed to bootstrap", node.client.NodeKey)
+		}
+		node.client.AddDiscovery("dht", dht)
+	}
+
+	ih, err := seeder.client.ImportBaoFile(file, seedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeder.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	leechFile := *file
+	if _, err := leecher.client.ImportBaoFile(&leechFile, leechDir); err != nil {
+		t.Fatal(err)
+	}
+	leecher.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	swarm := swarmOf(t, leecher.client, ih)
+	if !waitFor(t, 15*time.Second, swarm.FileIO.IsComplete) {
+		t.Fatalf("leecher did not complete using DHT discovery")
+	}
+}
@@ -0,0 +1,259 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+)
+
+// DownloadStrategy decides the order in which missing units are requested.
+type DownloadStrategy string
+
+const (
+	StrategyRandom      DownloadStrategy = "random"
+	StrategyRarestFirst DownloadStrategy = "rarest-first"
+	StrategySequential  DownloadStrategy = "sequential"
+	// StrategyStreaming requests a window ahead of the playback cursor in
+	// order, with per-unit deadlines, and rarest first everywhere else.
+	StrategyStreaming DownloadStrategy = "streaming"
+)
+
+const DefaultDownloadStrategy = StrategyRarestFirst
+
+func ParseDownloadStrategy(value string) (DownloadStrategy, error) {
+	switch s := DownloadStrategy(strings.ToLower(strings.TrimSpace(value))); s {
+	case StrategyRandom, StrategyRarestFirst, StrategySequential, StrategyStreaming:
+		return s, nil
+	case "":
+		return DefaultDownloadStrategy, nil
+	default:
+		return "", fmt.Errorf("unknown download strategy %q", value)
+	}
+}
+
+// SetStrategy switches the download strategy and reschedules.
+func (pm *TransferUnitManager) SetStrategy(strategy DownloadStrategy) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.strategy = strategy
+	pm.refreshDeadlinesLocked(time.Now())
+	pm.scheduleLocked(config.ActiveTransfersTotal())
+}
+
+func (pm *TransferUnitManager) Strategy() DownloadStrategy {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return pm.strategy
+}
+
+// SetPlaybackPosition moves the streaming cursor to the unit holding the
+// given byte offset. Requests that enter the window get a deadline counted
+// from now; requests already in it keep theirs.
+func (pm *TransferUnitManager) SetPlaybackPosition(offset uint64) {
+	unit := offset / uint64(config.TransferUnitSize)
+	if pm.transferUnitCount > 0 && unit >= pm.transferUnitCount {
+		unit = pm.transferUnitCount - 1
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if unit == pm.cursor {
+		return
+	}
+
+	pm.cursor = unit
+	pm.refreshDeadlinesLocked(time.Now())
+	pm.scheduleLocked(config.ActiveTransfersTotal())
+}
+
+// PlaybackPosition returns the byte offset of the streaming cursor.
+func (pm *TransferUnitManager) PlaybackPosition() uint64 {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return pm.cursor * uint64(config.TransferUnitSize)
+}
+
+// SetStreamWindow sets how many units ahead of the cursor are prioritized.
+func (pm *TransferUnitManager) SetStreamWindow(units uint64) {
+	if units == 0 {
+		units = uint64(config.StreamWindowUnits)
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.streamWindow = units
+	pm.refreshDeadlinesLocked(time.Now())
+}
+
+// Prioritize marks units [start, end] as urgent so they are requested ahead
+// of the strategy order, then reschedules. Used when a local reader blocks
+// on data that has not been verified yet; the reader calls Release with the
+// same range once it no longer needs it.
+func (pm *TransferUnitManager) Prioritize(start, end uint64) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	added := false
+	for idx := start; idx <= end && idx < pm.transferUnitCount; idx++ {
+		pm.urgent[idx]++
+		if pm.urgent[idx] == 1 && pm.transferUnits[idx].State != TransferUnitStateComplete {
+			added = true
+		}
+	}
+
+	if added {
+		pm.scheduleLocked(config.ActiveTransfersTotal())
+	}
+}
+
+// Release drops one urgent mark from units [start, end]. Units nobody else
+// marked go back to the strategy order.
+func (pm *TransferUnitManager) Release(start, end uint64) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for idx := start; idx <= end && idx < pm.transferUnitCount; idx++ {
+		if pm.urgent[idx] <= 1 {
+			delete(pm.urgent, idx)
+		} else {
+			pm.urgent[idx]--
+		}
+	}
+}
+
+// candidatesLocked returns schedulable units in the order the current
+// strategy wants them requested, with urgent units first.
+func (pm *TransferUnitManager) candidatesLocked() []uint64 {
+	candidates := pm.strategyCandidatesLocked()
+	if len(pm.urgent) == 0 {
+		return candidates
+	}
+
+	var urgent, rest []uint64
+	for _, idx := range candidates {
+		if _, ok := pm.urgent[idx]; ok {
+			urgent = append(urgent, idx)
+		} else {
+			rest = append(rest, idx)
+		}
+	}
+	sort.Slice(urgent, func(i, j int) bool { return urgent[i] < urgent[j] })
+	return append(urgent, rest...)
+}
+
+func (pm *TransferUnitManager) strategyCandidatesLocked() []uint64 {
+	candidates := pm.missingCandidatesLocked()
+
+	switch pm.strategy {
+	case StrategyRandom:
+		shuffleUnits(candidates)
+	case StrategySequential:
+		// already in index order
+	case StrategyStreaming:
+		var window, rest []uint64
+		for _, idx := range candidates {
+			if pm.inStreamWindowLocked(idx) {
+				window = append(window, idx)
+			} else {
+				rest = append(rest, idx)
+			}
+		}
+		pm.sortRarestFirstLocked(rest)
+		candidates = append(window, rest...)
+	default:
+		pm.sortRarestFirstLocked(candidates)
+	}
+
+	return candidates
+}
+
+// missingCandidatesLocked returns, in index order, the missing units that
+// are not already requested and that at least one peer has.
+func (pm *TransferUnitManager) missingCandidatesLocked() []uint64 {
+	var candidates []uint64
+	for unitIdx := uint64(0); unitIdx < pm.transferUnitCount; unitIdx++ {
+		unit := pm.transferUnits[unitIdx]
+
+		if unit.State != TransferUnitStateMissing {
+			continue
+		}
+
+		if _, active := pm.activeRequests[unitIdx]; active {
+			continue
+		}
+
+		if pm.availability[unitIdx] == 0 {
+			continue
+		}
+
+		candidates = append(candidates, unitIdx)
+	}
+
+	return candidates
+}
+
+// sortRarestFirstLocked orders units least replicated first. Ties are broken
+// randomly so peers downloading the same swarm spread out over equally rare
+// units.
+func (pm *TransferUnitManager) sortRarestFirstLocked(units []uint64) {
+	shuffleUnits(units)
+	sort.SliceStable(units, func(i, j int) bool {
+		return pm.availability[units[i]] < pm.availability[units[j]]
+	})
+}
+
+func (pm *TransferUnitManager) inStreamWindowLocked(index uint64) bool {
+	return index >= pm.cursor && index < pm.cursor+pm.streamWindow
+}
+
+// streamDeadlineLocked returns when a unit in the streaming window is needed,
+// counting from the given time. Units further from the cursor get
+// proportionally more time.
+func (pm *TransferUnitManager) streamDeadlineLocked(index uint64, from time.Time) (time.Time, bool) {
+	if pm.strategy != StrategyStreaming || !pm.inStreamWindowLocked(index) {
+		return time.Time{}, false
+	}
+
+	distance := index - pm.cursor + 1
+	return from.Add(time.Duration(distance) * config.StreamUnitDeadline), true
+}
+
+// refreshDeadlinesLocked is called when the window moves. Requests that
+// entered it start their deadline now, and requests that left it lose it.
+func (pm *TransferUnitManager) refreshDeadlinesLocked(now time.Time) {
+	for idx, req := range pm.activeRequests {
+		deadline, ok := pm.streamDeadlineLocked(idx, now)
+		if !ok {
+			req.Deadline = time.Time{}
+		} else if req.Deadline.IsZero() {
+			req.Deadline = deadline
+		}
+	}
+}
+
+// requestExpiredLocked reports whether an active request should be given up
+// on: either the regular timeout elapsed, or it is a streaming unit past its
+// deadline that has had StreamRetryAfter to arrive.
+func (pm *TransferUnitManager) requestExpiredLocked(req *transferUnitRequest, now time.Time) bool {
+	age := now.Sub(req.SentAt)
+	if age > config.TransferRequestTimeout() {
+		return true
+	}
+
+	return !req.Deadline.IsZero() && now.After(req.Deadline) && age > config.StreamRetryAfter
+}
+
+func shuffleUnits(units []uint64) {
+	rand.Shuffle(len(units), func(i, j int) {
+		units[i], units[j] = units[j], units[i]
+	})
+}
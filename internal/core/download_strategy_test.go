@@ -0,0 +1,176 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func TestParseDownloadStrategy(t *testing.T) {
+	cases := map[string]DownloadStrategy{
+		"":             DefaultDownloadStrategy,
+		"random":       StrategyRandom,
+		"Rarest-First": StrategyRarestFirst,
+		" sequential ": StrategySequential,
+		"streaming":    StrategyStreaming,
+	}
+	for input, want := range cases {
+		got, err := ParseDownloadStrategy(input)
+		if err != nil || got != want {
+			t.Fatalf("ParseDownloadStrategy(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+
+	if _, err := ParseDownloadStrategy("fastest"); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+}
+
+func TestSequentialStrategyOrder(t *testing.T) {
+	swarm := newTestSwarm(t, 6)
+	pm := swarm.TransferUnitManager
+
+	pm.UpdatePeerBitfield("a", bitfieldOf(6, 0, 1, 2, 3, 4, 5))
+	pm.UpdatePeerBitfield("b", bitfieldOf(6, 0, 1, 2))
+
+	pm.mu.Lock()
+	pm.strategy = StrategySequential
+	candidates := pm.candidatesLocked()
+	pm.mu.Unlock()
+
+	for i, idx := range candidates {
+		if idx != uint64(i) {
+			t.Fatalf("sequential order expected, got %v", candidates)
+		}
+	}
+}
+
+func TestStreamingStrategyWindowFirst(t *testing.T) {
+	swarm := newTestSwarm(t, 10)
+	pm := swarm.TransferUnitManager
+
+	pm.UpdatePeerBitfield("a", bitfieldOf(10, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9))
+	pm.UpdatePeerBitfield("b", bitfieldOf(10, 0, 1, 2, 3, 4, 5, 6, 7))
+
+	pm.SetStreamWindow(3)
+	pm.SetPlaybackPosition(uint64(config.TransferUnitSize)*4 + 10)
+
+	pm.mu.Lock()
+	pm.strategy = StrategyStreaming
+	candidates := pm.candidatesLocked()
+	pm.mu.Unlock()
+
+	if len(candidates) < 5 {
+		t.Fatalf("expected all units as candidates, got %v", candidates)
+	}
+	for i, want := range []uint64{4, 5, 6} {
+		if candidates[i] != want {
+			t.Fatalf("window units 4,5,6 should come first in order, got %v", candidates)
+		}
+	}
+	// Outside the window, the rarer units 8 and 9 come before the rest.
+	rest := candidates[3:5]
+	if !((rest[0] == 8 && rest[1] == 9) || (rest[0] == 9 && rest[1] == 8)) {
+		t.Fatalf("rarest units should follow the window, got %v", candidates)
+	}
+
+	if got := pm.PlaybackPosition(); got != uint64(config.TransferUnitSize)*4 {
+		t.Fatalf("playback position should snap to unit start, got %d", got)
+	}
+}
+
+func TestStreamingDeadlineExpiresRequest(t *testing.T) {
+	swarm := newTestSwarm(t, 10)
+	pm := swarm.TransferUnitManager
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.strategy = StrategyStreaming
+	pm.cursor = 2
+	pm.streamWindow = 4
+
+	now := time.Now()
+	old := now.Add(-config.StreamRetryAfter - time.Second)
+	stale := pm.newRequestLocked(3, "a", old)
+	fresh := pm.newRequestLocked(3, "a", now)
+	outside := pm.newRequestLocked(8, "a", old)
+
+	if !pm.requestExpiredLocked(stale, now) {
+		t.Fatalf("window request past its deadline should expire")
+	}
+	if pm.requestExpiredLocked(fresh, now.Add(config.StreamRetryAfter/2)) {
+		t.Fatalf("fresh request should get StreamRetryAfter before expiring")
+	}
+	if pm.requestExpiredLocked(outside, now) {
+		t.Fatalf("request outside the window should use the regular timeout")
+	}
+}
+
+func TestStreamingDeadlineStartsWhenUnitEntersWindow(t *testing.T) {
+	swarm := newTestSwarm(t, 10)
+	pm := swarm.TransferUnitManager
+	unitSize := uint64(config.TransferUnitSize)
+
+	pm.SetStrategy(StrategyStreaming)
+	pm.SetStreamWindow(2)
+
+	// Unit 5 was requested long ago, outside the window.
+	pm.mu.Lock()
+	req := pm.newRequestLocked(5, "a", time.Now().Add(-config.StreamRetryAfter-time.Second))
+	pm.activeRequests[5] = req
+	pm.mu.Unlock()
+	if !req.Deadline.IsZero() {
+		t.Fatalf("request outside the window should have no deadline")
+	}
+
+	pm.SetPlaybackPosition(unitSize * 4)
+	entered := time.Now()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if req.Deadline.Before(entered.Add(config.StreamUnitDeadline)) {
+		t.Fatalf("deadline should count from when the unit entered the window, got %v", req.Deadline)
+	}
+	if pm.requestExpiredLocked(req, entered) {
+		t.Fatalf("unit that just entered the window should not expire at once")
+	}
+	if !pm.requestExpiredLocked(req, req.Deadline.Add(time.Millisecond)) {
+		t.Fatalf("unit should expire once its window deadline passes")
+	}
+
+	// Moving the cursor on does not restart a deadline already running.
+	deadline := req.Deadline
+	pm.cursor = 5
+	pm.refreshDeadlinesLocked(time.Now().Add(time.Minute))
+	if !req.Deadline.Equal(deadline) {
+		t.Fatalf("deadline should be kept while the unit stays in the window")
+	}
+}
+
+func TestStreamingExpiryCancelsRequest(t *testing.T) {
+	units := uint64(config.EndgameMaxUnits + 4)
+	swarm := newTestSwarm(t, units)
+	pm := swarm.TransferUnitManager
+	pm.SetStrategy(StrategyStreaming)
+
+	all := NewBitfield(units)
+	for idx := uint64(0); idx < units; idx++ {
+		all.Set(idx)
+	}
+	_, msgs := newTestPeer(t, swarm, "a", all)
+
+	pm.scheduleDownloads()
+	expectUnits(t, "a", msgs, protocol.MsgRequest, 0)
+
+	pm.mu.Lock()
+	req := pm.activeRequests[0]
+	req.SentAt = time.Now().Add(-config.StreamRetryAfter - time.Second)
+	req.Deadline = time.Now().Add(-time.Second)
+	pm.mu.Unlock()
+
+	pm.checkTimeouts()
+	expectUnits(t, "a", msgs, protocol.MsgCancel, 0)
+}
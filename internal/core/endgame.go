@@ -0,0 +1,158 @@
+package core
+
+import (
+	"log"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// inEndgameLocked reports whether the download is down to its last few units
+// and every one that can be requested already is. At that point a single slow
+// peer would otherwise hold the whole download until its request times out.
+func (pm *TransferUnitManager) inEndgameLocked() bool {
+	missing := 0
+	for idx, unit := range pm.transferUnits {
+		if unit.State == TransferUnitStateComplete {
+			continue
+		}
+
+		missing++
+		if missing > config.EndgameMaxUnits {
+			return false
+		}
+
+		_, active := pm.activeRequests[uint64(idx)]
+		if !active && pm.availability[idx] > 0 {
+			return false
+		}
+	}
+
+	return missing > 0
+}
+
+// scheduleEndgameLocked requests every outstanding unit from up to
+// EndgameDuplicates additional peers while in endgame.
+func (pm *TransferUnitManager) scheduleEndgameLocked() {
+	if pm.paused || !pm.inEndgameLocked() {
+		return
+	}
+
+	for idx, req := range pm.activeRequests {
+		for len(pm.duplicates[idx]) < config.EndgameDuplicates {
+			peer := pm.selectEndgamePeerLocked(idx, req.From)
+			if peer == "" || !pm.sendDuplicateRequestLocked(idx, peer) {
+				break
+			}
+		}
+	}
+}
+
+// selectEndgamePeerLocked picks the least loaded connected peer that has the
+// unit and has not been asked for it yet.
+func (pm *TransferUnitManager) selectEndgamePeerLocked(index uint64, primary protocol.NodeKey) protocol.NodeKey {
+	pm.swarm.mu.RLock()
+	defer pm.swarm.mu.RUnlock()
+
+	var best protocol.NodeKey
+	minLoad := config.ActiveTransfersPerPeer()
+	now := time.Now()
+
+	for peer, handler := range pm.swarm.Peers {
+		if peer == primary || pm.backedOffLocked(peer, now) || handler.chokingUs() {
+			continue
+		}
+		if handler.downloadThrottled(now) {
+			pm.throttled = true
+			continue
+		}
+		if _, asked := pm.duplicates[index][peer]; asked {
+			continue
+		}
+		if handler.GetState() != protocol.StateConnected || !handler.peerHas(index) {
+			continue
+		}
+
+		if load := len(pm.peerRequests[peer]); load < minLoad {
+			minLoad = load
+			best = peer
+		}
+	}
+
+	return best
+}
+
+func (pm *TransferUnitManager) sendDuplicateRequestLocked(index uint64, peer protocol.NodeKey) bool {
+	pm.swarm.mu.RLock()
+	handler, exists := pm.swarm.Peers[peer]
+	pm.swarm.mu.RUnlock()
+
+	if !exists || !handler.takeDownloadBandwidth(time.Now()) {
+		return false
+	}
+
+	if err := handler.SendTransferUnitRequest(index); err != nil {
+		log.Printf("Failed to send endgame request for transferUnit %d to %s: %v", index, peer, err)
+		return false
+	}
+
+	dups, ok := pm.duplicates[index]
+	if !ok {
+		dups = make(map[protocol.NodeKey]time.Time)
+		pm.duplicates[index] = dups
+	}
+	dups[peer] = time.Now()
+	pm.peerRequests[peer] = append(pm.peerRequests[peer], index)
+
+	log.Printf("Endgame: also requested transferUnit %d from %s", index, peer)
+	return true
+}
+
+// dropDuplicatesLocked forgets the endgame requests for a unit and returns
+// the peers they were sent to.
+func (pm *TransferUnitManager) dropDuplicatesLocked(index uint64) []protocol.NodeKey {
+	dups := pm.duplicates[index]
+	delete(pm.duplicates, index)
+
+	peers := make([]protocol.NodeKey, 0, len(dups))
+	for peer := range dups {
+		pm.removePeerRequestLocked(index, peer)
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// CancelOutstanding is called when a verified copy of a unit arrives from
+// deliveredBy. Every other peer the unit was requested from is sent a
+// MsgCancel so it stops serving it.
+func (pm *TransferUnitManager) CancelOutstanding(index uint64, deliveredBy protocol.NodeKey) {
+	pm.mu.Lock()
+	losers := pm.dropDuplicatesLocked(index)
+	if req, exists := pm.activeRequests[index]; exists {
+		pm.cleanupRequest(index, req.From)
+		losers = append(losers, req.From)
+	}
+	pm.mu.Unlock()
+
+	cancel := losers[:0]
+	for _, peer := range losers {
+		if peer != deliveredBy {
+			cancel = append(cancel, peer)
+		}
+	}
+	pm.sendCancels(index, cancel)
+}
+
+// sendCancels sends MsgCancel for a unit to each peer still connected.
+func (pm *TransferUnitManager) sendCancels(index uint64, peers []protocol.NodeKey) {
+	for _, peer := range peers {
+		pm.swarm.mu.RLock()
+		handler, exists := pm.swarm.Peers[peer]
+		pm.swarm.mu.RUnlock()
+
+		if exists {
+			pm.swarm.spawn(func() { handler.SendCancel(index) })
+		}
+	}
+}
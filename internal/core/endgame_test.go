@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// newTestPeer attaches a connected peer to swarm whose outgoing messages are
+// decoded onto the returned channel.
+func newTestPeer(t *testing.T, swarm *Swarm, key protocol.NodeKey, bf Bitfield) (*PeerHandler, <-chan protocol.PeerMessage) {
+	t.Helper()
+
+	local, remote := net.Pipe()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+
+	ph := &PeerHandler{
+		Peer:              key,
+		Swarm:             swarm,
+		Session:           &Session{conn: local, peer: key, created: time.Now()},
+		bitfield:          bf,
+		serializer:        NewProtobufSerializer(),
+		state:             protocol.StateConnected,
+		handshakeReceived: make(chan struct{}),
+		connected:         make(chan struct{}),
+		uploadSignal:      make(chan struct{}, 1),
+		closed:            make(chan struct{}),
+	}
+
+	swarm.mu.Lock()
+	swarm.Peers[key] = ph
+	swarm.mu.Unlock()
+	swarm.TransferUnitManager.UpdatePeerBitfield(key, bf)
+
+	out := make(chan protocol.PeerMessage, 64)
+	go func() {
+		serializer := NewProtobufSerializer()
+		reader := bufio.NewReader(remote)
+		for {
+			var length uint32
+			if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+				return
+			}
+			buf := make([]byte, length)
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return
+			}
+			var msg protocol.PeerMessage
+			if err := serializer.UnmarshalPeerMessage(buf, &msg); err == nil {
+				out <- msg
+			}
+		}
+	}()
+
+	return ph, out
+}
+
+func expectUnits(t *testing.T, peer protocol.NodeKey, msgs <-chan protocol.PeerMessage, typ protocol.PeerMessageType, want ...uint64) {
+	t.Helper()
+
+	serializer := NewProtobufSerializer()
+	wanted := make(map[uint64]bool)
+	for _, idx := range want {
+		wanted[idx] = true
+	}
+	got := make(map[uint64]bool)
+	deadline := time.After(2 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case msg := <-msgs:
+			if msg.Type != typ {
+				continue
+			}
+			var idx uint64
+			switch typ {
+			case protocol.MsgRequest:
+				var p protocol.TransferRequestPayload
+				_ = serializer.UnmarshalTransferRequestPayload(msg.Payload, &p)
+				idx = p.UnitIndex
+			case protocol.MsgCancel:
+				var p protocol.CancelPayload
+				_ = serializer.UnmarshalCancelPayload(msg.Payload, &p)
+				idx = p.UnitIndex
+			}
+			if wanted[idx] {
+				got[idx] = true
+			}
+		case <-deadline:
+			t.Fatalf("peer %s: expected %s for units %v, got %v", peer, typ, want, got)
+		}
+	}
+}
+
+func TestEndgameDuplicatesAndCancels(t *testing.T) {
+	swarm := newTestSwarm(t, 2)
+	pm := swarm.TransferUnitManager
+
+	all := bitfieldOf(2, 0, 1)
+	peers := map[protocol.NodeKey]<-chan protocol.PeerMessage{}
+	for _, key := range []protocol.NodeKey{"a", "b", "c"} {
+		_, msgs := newTestPeer(t, swarm, key, all)
+		peers[key] = msgs
+	}
+
+	pm.scheduleDownloads()
+
+	// Two units left: each goes to its primary peer plus EndgameDuplicates more.
+	for key, msgs := range peers {
+		expectUnits(t, key, msgs, protocol.MsgRequest, 0, 1)
+	}
+
+	pm.CancelOutstanding(0, "a")
+
+	expectUnits(t, "b", peers["b"], protocol.MsgCancel, 0)
+	expectUnits(t, "c", peers["c"], protocol.MsgCancel, 0)
+
+	pm.mu.RLock()
+	_, active := pm.activeRequests[0]
+	dups := len(pm.duplicates[0])
+	pm.mu.RUnlock()
+	if active || dups != 0 {
+		t.Fatalf("unit 0 requests should be cleared, active=%v duplicates=%d", active, dups)
+	}
+
+	select {
+	case msg := <-peers["a"]:
+		if msg.Type == protocol.MsgCancel {
+			t.Fatalf("the delivering peer should not be cancelled")
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNoEndgameWithManyUnitsLeft(t *testing.T) {
+	units := uint64(config.EndgameMaxUnits + 4)
+	swarm := newTestSwarm(t, units)
+	pm := swarm.TransferUnitManager
+
+	all := NewBitfield(units)
+	for i := uint64(0); i < units; i++ {
+		all.Set(i)
+	}
+	newTestPeer(t, swarm, "a", all)
+	newTestPeer(t, swarm, "b", all)
+
+	pm.scheduleDownloads()
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if len(pm.duplicates) != 0 {
+		t.Fatalf("no duplicate requests expected outside endgame, got %d", len(pm.duplicates))
+	}
+	if uint64(len(pm.activeRequests)) != units {
+		t.Fatalf("all units should be requested once, got %d", len(pm.activeRequests))
+	}
+}
+
+func TestCancelUploadDropsQueuedRequest(t *testing.T) {
+	ph := &PeerHandler{uploadQueue: []uint64{1, 2, 3}}
+
+	ph.cancelUpload(2)
+	ph.cancelUpload(7) // unknown units are ignored
+
+	if len(ph.uploadQueue) != 2 || ph.uploadQueue[0] != 1 || ph.uploadQueue[1] != 3 {
+		t.Fatalf("unexpected queue after cancel: %v", ph.uploadQueue)
+	}
+}
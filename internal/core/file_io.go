@@ -12,19 +12,35 @@ import (
 	"github.com/baoswarm/baobun/internal/config"
 )
 
-// FileIO handles range-based file storage for BaoFile
+// FileIO handles range-based file storage for BaoFile. A multi-file bao is
+// addressed as one concatenated byte range split across its files.
 type FileIO struct {
-	npf  *BaoFile
-	file *os.File
+	npf   *BaoFile
+	spans []*fileSpan
 
 	// Transfer-unit tracking
 	unitCount uint64
 	haveUnits Bitfield
 
+	// created is set when the data file did not exist (or was empty) before
+	// this FileIO opened it, so there is nothing on disk worth scanning.
+	created bool
+	// resized is set when a data file was missing or had the wrong size and
+	// was truncated to its expected length, so its previous contents are
+	// no longer what was recorded.
+	resized bool
+
 	// Synchronization for shared metadata (not file writes)
 	mu sync.RWMutex
 }
 
+// fileSpan is one file's slice of the concatenated content.
+type fileSpan struct {
+	file   *os.File
+	offset uint64
+	length uint64
+}
+
 // NewFileIO creates and prepares a file for ranged IO
 func NewFileIO(npf *BaoFile, fileLocation string) (*FileIO, error) {
 	if npf == nil {
@@ -39,19 +55,49 @@ func NewFileIO(npf *BaoFile, fileLocation string) (*FileIO, error) {
 		haveUnits: NewBitfield(tuCount),
 	}
 
-	if err := f.initializeFile(fileLocation); err != nil {
+	if err := f.initializeFiles(fileLocation); err != nil {
+		f.Close()
 		return nil, err
 	}
 
 	return f, nil
 }
 
-func (f *FileIO) initializeFile(dir string) error {
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+func (f *FileIO) initializeFiles(dir string) error {
+	root := dir
+	if f.npf.IsMultiFile() {
+		root = filepath.Join(dir, f.npf.Name)
+	}
+
+	allEmpty := true
+	var offset uint64
+	for _, entry := range f.npf.FileEntries() {
+		file, size, err := openSized(filepath.Join(root, filepath.FromSlash(entry.Path)), entry.Length)
+		if err != nil {
+			return err
+		}
+		if size > 0 {
+			allEmpty = false
+		}
+		if size != int64(entry.Length) {
+			f.resized = true
+		}
+
+		f.spans = append(f.spans, &fileSpan{file: file, offset: offset, length: entry.Length})
+		offset += entry.Length
 	}
 
-	fullPath := filepath.Join(dir, f.npf.Name)
+	f.created = allEmpty && f.npf.Length > 0
+
+	return nil
+}
+
+// openSized opens (creating if needed) a data file and truncates it to
+// length. It returns the size the file had before.
+func openSized(fullPath string, length uint64) (*os.File, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return nil, 0, err
+	}
 
 	file, err := os.OpenFile(
 		fullPath,
@@ -59,23 +105,23 @@ func (f *FileIO) initializeFile(dir string) error {
 		0644,
 	)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	f.file = file
-
 	info, err := file.Stat()
 	if err != nil {
-		return err
+		file.Close()
+		return nil, 0, err
 	}
 
-	if info.Size() != int64(f.npf.Length) {
-		if err := file.Truncate(int64(f.npf.Length)); err != nil {
-			return err
+	if info.Size() != int64(length) {
+		if err := file.Truncate(int64(length)); err != nil {
+			file.Close()
+			return nil, 0, err
 		}
 	}
 
-	return nil
+	return file, info.Size(), nil
 }
 
 // ReadRange reads an arbitrary byte range (concurrency-safe)
@@ -85,7 +131,7 @@ func (f *FileIO) ReadRange(start, length uint64) ([]byte, error) {
 	}
 
 	buf := make([]byte, length)
-	n, err := f.file.ReadAt(buf, int64(start))
+	n, err := f.ReadAt(buf, int64(start))
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return nil, err
 	}
@@ -93,18 +139,87 @@ func (f *FileIO) ReadRange(start, length uint64) ([]byte, error) {
 	return buf[:n], nil
 }
 
+// ReadAt reads from the concatenated content, crossing file boundaries as
+// needed. It follows io.ReaderAt, so the bao tree can hash through it.
+func (f *FileIO) ReadAt(p []byte, off int64) (int, error) {
+	return spanReader(f.spans).ReadAt(p, off)
+}
+
+// spanReader reads a list of consecutive file spans as one stream.
+type spanReader []*fileSpan
+
+func (sr spanReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+
+	read := 0
+	for _, span := range sr {
+		if read == len(p) {
+			break
+		}
+
+		pos := uint64(off) + uint64(read)
+		if span.length == 0 || pos >= span.offset+span.length || pos < span.offset {
+			continue
+		}
+
+		chunk := p[read:]
+		if remaining := span.offset + span.length - pos; uint64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		n, err := span.file.ReadAt(chunk, int64(pos-span.offset))
+		read += n
+		if err != nil && err != io.EOF {
+			return read, err
+		}
+		if n < len(chunk) {
+			// Short file on disk; report what we have.
+			return read, io.EOF
+		}
+	}
+
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
 // WriteRange writes data at an arbitrary byte offset (concurrency-safe)
 func (f *FileIO) WriteRange(start uint64, data []byte) error {
 	if start+uint64(len(data)) > f.npf.Length {
 		return fmt.Errorf("range out of bounds")
 	}
 
-	// Safe to write concurrently using WriteAt
-	n, err := f.file.WriteAt(data, int64(start))
-	if err != nil {
-		return err
+	written := 0
+	for _, span := range f.spans {
+		if written == len(data) {
+			break
+		}
+
+		pos := start + uint64(written)
+		if span.length == 0 || pos >= span.offset+span.length || pos < span.offset {
+			continue
+		}
+
+		chunk := data[written:]
+		if remaining := span.offset + span.length - pos; uint64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		// Safe to write concurrently using WriteAt
+		n, err := span.file.WriteAt(chunk, int64(pos-span.offset))
+		if err != nil {
+			return err
+		}
+		if n != len(chunk) {
+			return io.ErrShortWrite
+		}
+		written += n
 	}
-	if n != len(data) {
+
+	if written != len(data) {
 		return io.ErrShortWrite
 	}
 
@@ -161,7 +276,28 @@ func (f *FileIO) HasTransferUnit(index uint64) bool {
 func (f *FileIO) GetBitfield() Bitfield {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
-	return BitfieldFromBytes(f.haveUnits.Bytes())
+
+	return f.haveUnits.Clone()
+}
+
+// markHave records a unit as present without writing it.
+func (f *FileIO) markHave(index uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.haveUnits.Set(index)
+}
+
+// SetBitfield replaces the have-units bitfield with a copy of bf
+func (f *FileIO) SetBitfield(bf Bitfield) error {
+	expected := (f.unitCount + 7) / 8
+	if uint64(len(bf.Bytes())) != expected {
+		return fmt.Errorf("bitfield length mismatch: got %d, expected %d", len(bf.Bytes()), expected)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copy(f.haveUnits.bits, bf.Bytes())
+	return nil
 }
 
 // IsComplete returns true if all units are present
@@ -173,7 +309,12 @@ func (f *FileIO) IsComplete() bool {
 
 // Sync flushes all file changes to disk
 func (f *FileIO) Sync() error {
-	return f.file.Sync()
+	for _, span := range f.spans {
+		if err := span.file.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Switch to read only
@@ -181,30 +322,36 @@ func (f *FileIO) SwitchToReadOnly() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	originalPath := f.file.Name()
+	for _, span := range f.spans {
+		originalPath := span.file.Name()
 
-	err := f.Close()
-	if err != nil {
-		return err
-	}
+		if err := span.file.Close(); err != nil {
+			return err
+		}
 
-	file, err := os.Open(originalPath)
-	if err != nil {
-		return err
+		file, err := os.Open(originalPath)
+		if err != nil {
+			return err
+		}
+		span.file = file
 	}
-	f.file = file
 
 	return nil
 }
 
-// Close closes the underlying file
+// Close closes the underlying files
 func (f *FileIO) Close() error {
-	if f.file == nil {
-		return nil
+	var firstErr error
+	for _, span := range f.spans {
+		if span.file == nil {
+			continue
+		}
+		if err := span.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		span.file = nil
 	}
-	err := f.file.Close()
-	f.file = nil
-	return err
+	return firstErr
 }
 
 // GetFileInfo returns information about the underlying BaoFile
@@ -193,7 +193,7 @@ func TestFileIO_BasicReadWrite(t *testing.T) {
 		}
 
 		// Read entire file through OS to verify
-		fileData, err := ioutil.ReadFile(fileIO2.file.Name())
+		fileData, err := ioutil.ReadFile(fileIO2.spans[0].file.Name())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -280,7 +280,7 @@ func TestFileIO_EdgeCases(t *testing.T) {
 			}
 
 			// Verify complete file
-			fileData, err := ioutil.ReadFile(fileIO.file.Name())
+			fileData, err := ioutil.ReadFile(fileIO.spans[0].file.Name())
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -461,7 +461,7 @@ func TestFileIO_Concurrent(t *testing.T) {
 	}
 
 	// Final verification: read entire file
-	fileData, err := ioutil.ReadFile(fileIO.file.Name())
+	fileData, err := ioutil.ReadFile(fileIO.spans[0].file.Name())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -650,7 +650,7 @@ func TestFileIO_RealisticScenario(t *testing.T) {
 	}
 
 	// Final verification: compare with original
-	downloadedData, err := ioutil.ReadFile(fileIO.file.Name())
+	downloadedData, err := ioutil.ReadFile(fileIO.spans[0].file.Name())
 	if err != nil {
 		t.Fatal(err)
 	}
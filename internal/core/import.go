@@ -8,25 +8,11 @@ func (c *Client) ImportBao(path string, fileLocation string) (protocol.InfoHash,
 		return protocol.InfoHash{}, err
 	}
 
-	ih := protocol.InfoHash(file.InfoHash)
-
-	swarm := NewSwarm(ih, file, fileLocation)
-
-	c.Swarms[ih] = swarm
-	c.Sessions.RegisterSwarm(swarm)
-
-	return ih, nil
+	return c.addSwarm(file, fileLocation), nil
 }
 
 func (c *Client) ImportBaoFile(file *BaoFile, fileLocation string) (protocol.InfoHash, error) {
-	ih := protocol.InfoHash(file.InfoHash)
-
-	swarm := NewSwarm(ih, file, fileLocation)
-
-	c.Swarms[ih] = swarm
-	c.Sessions.RegisterSwarm(swarm)
-
-	return ih, nil
+	return c.addSwarm(file, fileLocation), nil
 }
 
 func (c *Client) ImportBaoData(data []byte, fileLocation string) (protocol.InfoHash, error) {
@@ -35,12 +21,26 @@ func (c *Client) ImportBaoData(data []byte, fileLocation string) (protocol.InfoH
 		return protocol.InfoHash{}, err
 	}
 
+	return c.addSwarm(file, fileLocation), nil
+}
+
+// addSwarm starts a swarm for file, unless the client already has one.
+func (c *Client) addSwarm(file *BaoFile, fileLocation string) protocol.InfoHash {
+	c.addMu.Lock()
+	defer c.addMu.Unlock()
+
 	ih := protocol.InfoHash(file.InfoHash)
+	if _, ok := c.Swarms.Get(ih); ok {
+		return ih
+	}
 
 	swarm := NewSwarm(ih, file, fileLocation)
+	swarm.bandwidth = c.bandwidth
+	swarm.onComplete = c.rebalanceQueue
 
-	c.Swarms[ih] = swarm
+	c.Swarms.Add(swarm)
 	c.Sessions.RegisterSwarm(swarm)
+	c.enqueueSwarm(ih)
 
-	return ih, nil
+	return ih
 }
@@ -59,3 +59,43 @@ func (j *JSONSerializer) MarshalTransferPayload(p *protocol.TransferPayload) ([]
 func (j *JSONSerializer) UnmarshalTransferPayload(data []byte, p *protocol.TransferPayload) error {
 	return json.Unmarshal(data, p)
 }
+
+func (j *JSONSerializer) MarshalRejectPayload(p *protocol.RejectPayload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (j *JSONSerializer) UnmarshalRejectPayload(data []byte, p *protocol.RejectPayload) error {
+	return json.Unmarshal(data, p)
+}
+
+func (j *JSONSerializer) MarshalCancelPayload(p *protocol.CancelPayload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (j *JSONSerializer) UnmarshalCancelPayload(data []byte, p *protocol.CancelPayload) error {
+	return json.Unmarshal(data, p)
+}
+
+func (j *JSONSerializer) MarshalMetadataPayload(p *protocol.MetadataPayload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (j *JSONSerializer) UnmarshalMetadataPayload(data []byte, p *protocol.MetadataPayload) error {
+	return json.Unmarshal(data, p)
+}
+
+func (j *JSONSerializer) MarshalPexPayload(p *protocol.PexPayload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (j *JSONSerializer) UnmarshalPexPayload(data []byte, p *protocol.PexPayload) error {
+	return json.Unmarshal(data, p)
+}
+
+func (j *JSONSerializer) MarshalDHTPayload(p *protocol.DHTPayload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (j *JSONSerializer) UnmarshalDHTPayload(data []byte, p *protocol.DHTPayload) error {
+	return json.Unmarshal(data, p)
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+type metadataKey struct {
+	peer     protocol.NodeKey
+	infoHash protocol.InfoHash
+}
+
+// errMetadataUnavailable is returned when a peer answers that it does not
+// have the requested .bao.
+var errMetadataUnavailable = errors.New("peer does not have the metadata")
+
+// RequestMetadata asks peer for the .bao JSON of infoHash. It only needs a
+// session, not a swarm, so it works before the .bao is known.
+func (sm *SessionManager) RequestMetadata(ctx context.Context, peer protocol.NodeKey, infoHash protocol.InfoHash) ([]byte, error) {
+	key := metadataKey{peer: peer, infoHash: infoHash}
+	ch := make(chan []byte, 1)
+
+	sm.mu.Lock()
+	if _, pending := sm.metadataWaiters[key]; pending {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("metadata request to %s already pending", peer)
+	}
+	sm.metadataWaiters[key] = ch
+	sm.mu.Unlock()
+
+	defer func() {
+		sm.mu.Lock()
+		delete(sm.metadataWaiters, key)
+		sm.mu.Unlock()
+	}()
+
+	sess, err := sm.GetSession(peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer sm.Release(peer)
+
+	err = sess.Send(NewProtobufSerializer(), protocol.PeerMessage{
+		InfoHash: infoHash,
+		Type:     protocol.MsgMetadataRequest,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send metadata request: %w", err)
+	}
+
+	select {
+	case data := <-ch:
+		if len(data) == 0 {
+			return nil, errMetadataUnavailable
+		}
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (sm *SessionManager) handleMetadataRequest(sess *Session, infoHash protocol.InfoHash, serializer Serializer) {
+	sm.mu.Lock()
+	swarm, exists := sm.swarms[infoHash]
+	sm.mu.Unlock()
+
+	var payload protocol.MetadataPayload
+	if exists {
+		data, err := json.Marshal(swarm.File)
+		if err != nil {
+			log.Printf("Failed to encode metadata for %s: %v", infoHash, err)
+		} else {
+			payload.Data = data
+		}
+	}
+
+	encoded, err := serializer.MarshalMetadataPayload(&payload)
+	if err != nil {
+		log.Printf("Failed to marshal metadata payload: %v", err)
+		return
+	}
+
+	err = sess.Send(serializer, protocol.PeerMessage{
+		InfoHash: infoHash,
+		Type:     protocol.MsgMetadata,
+		Payload:  encoded,
+	})
+	if err != nil {
+		log.Printf("Failed to send metadata to %s: %v", sess.peer, err)
+	}
+}
+
+func (sm *SessionManager) handleMetadata(peer protocol.NodeKey, msg protocol.PeerMessage, serializer Serializer) {
+	var payload protocol.MetadataPayload
+	if err := serializer.UnmarshalMetadataPayload(msg.Payload, &payload); err != nil {
+		log.Printf("Failed to unmarshal metadata from %s: %v", peer, err)
+		return
+	}
+
+	key := metadataKey{peer: peer, infoHash: msg.InfoHash}
+	sm.mu.Lock()
+	ch, pending := sm.metadataWaiters[key]
+	delete(sm.metadataWaiters, key)
+	sm.mu.Unlock()
+
+	if !pending {
+		log.Printf("Unsolicited metadata from %s for %s", peer, msg.InfoHash)
+		return
+	}
+	ch <- payload.Data
+}
+
+// FetchMetadata announces uri's InfoHash to its trackers and the discovery
+// sources and downloads the .bao from the first peer that has it. A .bao is
+// only accepted if its recomputed InfoHash matches the URI. Without tracker
+// hints the default trackers are used.
+func (c *Client) FetchMetadata(ctx context.Context, uri *BaoURI) (*BaoFile, error) {
+	trackers := uri.Trackers
+	if len(trackers) == 0 {
+		trackers = config.DefaultTrackers
+	}
+
+	req := protocol.AnnounceRequest{
+		InfoHash: uri.InfoHash,
+		Event:    protocol.EventStarted,
+		Left:     ^uint64(0), // unknown until the metadata arrives
+	}
+
+	seen := make(map[protocol.NodeKey]bool)
+	var peers []protocol.NodeKey
+	targets := c.announceTargets(trackers)
+	for _, target := range targets {
+		resp, err := target.transport.Announce(ctx, target.key, req)
+		if err != nil {
+			log.Printf("announce failed (%s): %v", target.key, err)
+			continue
+		}
+		for _, peer := range resp.Peers {
+			if peer.NodeKey == protocol.NodeKey(c.NodeKey) || seen[peer.NodeKey] {
+				continue
+			}
+			seen[peer.NodeKey] = true
+			peers = append(peers, peer.NodeKey)
+		}
+	}
+
+	if len(peers) > config.MetadataMaxPeers {
+		peers = peers[:config.MetadataMaxPeers]
+	}
+
+	for _, peer := range peers {
+		file, err := c.fetchMetadataFrom(ctx, peer, uri.InfoHash)
+		if err == nil {
+			return file, nil
+		}
+		log.Printf("metadata from %s for %s: %v", peer, uri.InfoHash, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// Leave the trackers so peers are not pointed at a node without the swarm
+	req.Event = protocol.EventStopped
+	for _, target := range targets {
+		if _, err := target.transport.Announce(context.Background(), target.key, req); err != nil {
+			log.Printf("announce failed (%s): %v", target.key, err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no peer provided metadata for %x (%d peers tried)", uri.InfoHash, len(peers))
+}
+
+func (c *Client) fetchMetadataFrom(ctx context.Context, peer protocol.NodeKey, infoHash protocol.InfoHash) (*BaoFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.MetadataRequestTimeout)
+	defer cancel()
+
+	data, err := c.Sessions.RequestMetadata(ctx, peer, infoHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > config.MetadataMaxSize {
+		return nil, fmt.Errorf("metadata is %d bytes, limit is %d", len(data), config.MetadataMaxSize)
+	}
+
+	file, err := LoadFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if file.InfoHash != infoHash {
+		return nil, fmt.Errorf("metadata hashes to %x, not the requested InfoHash", file.InfoHash)
+	}
+
+	return file, nil
+}
+
+// ImportBaoURI joins the swarm a bao: link points to, fetching its .bao from
+// peers first unless the swarm is already known.
+func (c *Client) ImportBaoURI(ctx context.Context, uri *BaoURI, fileLocation string) (protocol.InfoHash, error) {
+	if _, exists := c.Swarms.Get(uri.InfoHash); exists {
+		return uri.InfoHash, nil
+	}
+
+	file, err := c.FetchMetadata(ctx, uri)
+	if err != nil {
+		return protocol.InfoHash{}, fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+
+	return c.ImportBaoFile(file, fileLocation)
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func TestBaoURIRoundTrip(t *testing.T) {
+	file := &BaoFile{Name: "my video.mp4", Length: 10, RootHash: "00", Trackers: []string{"bao.a", "bao.b"}}
+	if err := file.calculateInfoHash(); err != nil {
+		t.Fatal(err)
+	}
+
+	link := file.URI().String()
+	if !IsBaoURI(link) {
+		t.Fatalf("%q not recognised as a bao URI", link)
+	}
+
+	uri, err := ParseBaoURI(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.InfoHash != file.InfoHash || uri.Name != file.Name {
+		t.Fatalf("round trip changed the link: %+v", uri)
+	}
+	if len(uri.Trackers) != 2 || uri.Trackers[0] != "bao.a" || uri.Trackers[1] != "bao.b" {
+		t.Fatalf("unexpected trackers %v", uri.Trackers)
+	}
+
+	for _, bad := range []string{"bao:xyz", "bao:00ff", "http://example.com", "{\"name\":\"x\"}"} {
+		if _, err := ParseBaoURI(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestImportBaoURIFetchesMetadataFromPeers(t *testing.T) {
+	root, err := os.MkdirTemp("", "swarm-metadata-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	network := pipetransport.NewNetwork()
+	directory := tracker.NewDirectory()
+	directory.Register("bao.tracker", tracker.New(tracker.Config{}))
+
+	seedDir := filepath.Join(root, "seed")
+	leechDir := filepath.Join(root, "leech")
+	if err := os.MkdirAll(seedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	file, content := createSeedFile(t, seedDir, "linked.bin", config.TransferUnitSize*2+99)
+
+	seeder := newTestNode(t, network, directory, "seeder", seedDir)
+	leecher := newTestNode(t, network, directory, "leecher", leechDir)
+
+	ih, err := seeder.client.ImportBaoFile(file, seedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeder.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	uri, err := ParseBaoURI(file.URI().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	got, err := leecher.client.ImportBaoURI(ctx, uri, leechDir)
+	if err != nil {
+		t.Fatalf("import by URI failed: %v", err)
+	}
+	if got != ih {
+		t.Fatalf("imported %x, want %x", got, ih)
+	}
+	leecher.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	swarm := swarmOf(t, leecher.client, ih)
+	if !waitFor(t, 15*time.Second, swarm.FileIO.IsComplete) {
+		t.Fatalf("leecher did not complete")
+	}
+
+	data, err := os.ReadFile(filepath.Join(leechDir, "linked.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("downloaded content does not match")
+	}
+}
+
+func TestFetchMetadataFailsWithoutPeers(t *testing.T) {
+	network := pipetransport.NewNetwork()
+	directory := tracker.NewDirectory()
+	directory.Register("bao.tracker", tracker.New(tracker.Config{}))
+
+	node := newTestNode(t, network, directory, "lonely", t.TempDir())
+
+	uri := &BaoURI{InfoHash: protocol.InfoHash{1}, Trackers: []string{"bao.tracker"}}
+	if _, err := node.client.FetchMetadata(context.Background(), uri); err == nil {
+		t.Fatalf("expected fetch to fail with no peers")
+	}
+	if _, exists := node.client.Swarms.Get(uri.InfoHash); exists {
+		t.Fatalf("no swarm should be created without metadata")
+	}
+}
+
+func TestRequestMetadataFromPeerWithoutSwarm(t *testing.T) {
+	network := pipetransport.NewNetwork()
+	directory := tracker.NewDirectory()
+
+	a := newTestNode(t, network, directory, "a", t.TempDir())
+	newTestNode(t, network, directory, "b", t.TempDir())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := a.client.Sessions.RequestMetadata(ctx, "b", protocol.InfoHash{2}); err != errMetadataUnavailable {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+}
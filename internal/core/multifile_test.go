@@ -0,0 +1,228 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// createSeedDirectory writes files of the given sizes under dir/name and
+// returns the directory BaoFile and the concatenated content.
+func createSeedDirectory(t *testing.T, dir string, name string, sizes map[string]int) (*BaoFile, []byte) {
+	t.Helper()
+
+	rng := rand.New(rand.NewSource(7))
+	for rel, size := range sizes {
+		data := make([]byte, size)
+		rng.Read(data)
+
+		path := filepath.Join(dir, name, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := CreateFromDirectory(filepath.Join(dir, name), []string{"bao.tracker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var content []byte
+	for _, entry := range file.Files {
+		data, err := os.ReadFile(filepath.Join(dir, name, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, data...)
+	}
+	return file, content
+}
+
+func TestCreateFromDirectory(t *testing.T) {
+	root, err := os.MkdirTemp("", "bao-dir-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	file, content := createSeedDirectory(t, root, "project", map[string]int{
+		"a.txt":     1500,
+		"empty.txt": 0,
+		"sub/b.bin": config.TransferUnitSize + 300,
+	})
+
+	want := []BaoFileEntry{{"a.txt", 1500}, {"empty.txt", 0}, {"sub/b.bin", uint64(config.TransferUnitSize + 300)}}
+	if len(file.Files) != len(want) {
+		t.Fatalf("unexpected file list %v", file.Files)
+	}
+	for i, entry := range want {
+		if file.Files[i] != entry {
+			t.Fatalf("entry %d: got %v, want %v", i, file.Files[i], entry)
+		}
+	}
+	if file.Name != "project" || file.Length != uint64(len(content)) {
+		t.Fatalf("unexpected name/length %q/%d", file.Name, file.Length)
+	}
+
+	// The root is the tree over the concatenation, same as a single file.
+	concat := filepath.Join(root, "concat.bin")
+	if err := os.WriteFile(concat, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	single, err := CreateFromFile(concat, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.RootHash != file.RootHash {
+		t.Fatalf("directory root %s differs from concatenated root %s", file.RootHash, single.RootHash)
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.InfoHash != file.InfoHash {
+		t.Fatalf("info hash changed across save/load")
+	}
+}
+
+func TestBaoFileValidateRejectsBadFileLists(t *testing.T) {
+	cases := map[string]BaoFile{
+		"escaping path":   {Name: "d", Length: 1, Files: []BaoFileEntry{{"../x", 1}}},
+		"absolute path":   {Name: "d", Length: 1, Files: []BaoFileEntry{{"/etc/x", 1}}},
+		"length mismatch": {Name: "d", Length: 5, Files: []BaoFileEntry{{"x", 1}}},
+		"duplicate path":  {Name: "d", Length: 2, Files: []BaoFileEntry{{"x", 1}, {"x", 1}}},
+		"nested name":     {Name: "a/b", Length: 1, Files: []BaoFileEntry{{"x", 1}}},
+		"dot name":        {Name: ".", Length: 1, Files: []BaoFileEntry{{"x", 1}}},
+		"state dir name":  {Name: ".baobun", Length: 1, Files: []BaoFileEntry{{"x", 1}}},
+		"state dir path":  {Name: "d", Length: 1, Files: []BaoFileEntry{{".baobun/tokens.json", 1}}},
+		"nested state":    {Name: "d", Length: 1, Files: []BaoFileEntry{{"a/.BaoBun/x", 1}}},
+		"single dot name": {Name: ".", Length: 1},
+	}
+	for name, bao := range cases {
+		data, _ := json.Marshal(bao)
+		if _, err := LoadFromBytes(data); err == nil {
+			t.Fatalf("%s: expected load to fail", name)
+		}
+	}
+}
+
+func TestFileIOSpansFileBoundaries(t *testing.T) {
+	root, err := os.MkdirTemp("", "bao-dir-io-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	unit := config.TransferUnitSize
+	bao := &BaoFile{
+		Name:   "project",
+		Length: uint64(unit + 10),
+		Files:  []BaoFileEntry{{"a.bin", 100}, {"empty", 0}, {"dir/b.bin", uint64(unit - 90)}},
+	}
+
+	fileIO, err := NewFileIO(bao, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileIO.Close()
+
+	data := make([]byte, unit)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := fileIO.WriteTransferUnit(0, data); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := os.ReadFile(filepath.Join(root, "project", "a.bin"))
+	b, _ := os.ReadFile(filepath.Join(root, "project", "dir", "b.bin"))
+	if !bytes.Equal(a, data[:100]) {
+		t.Fatalf("first file holds the wrong bytes")
+	}
+	if !bytes.Equal(b[:unit-100], data[100:]) {
+		t.Fatalf("second file holds the wrong bytes")
+	}
+	if info, err := os.Stat(filepath.Join(root, "project", "empty")); err != nil || info.Size() != 0 {
+		t.Fatalf("empty file should exist with size 0: %v", err)
+	}
+
+	got, err := fileIO.ReadRange(50, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[50:150]) {
+		t.Fatalf("read across the file boundary returned wrong data")
+	}
+}
+
+func TestDirectorySwarmTransferOverPipeTransport(t *testing.T) {
+	root, err := os.MkdirTemp("", "swarm-dir-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	network := pipetransport.NewNetwork()
+	directory := tracker.NewDirectory()
+	directory.Register("bao.tracker", tracker.New(tracker.Config{}))
+
+	seedDir := filepath.Join(root, "seed")
+	leechDir := filepath.Join(root, "leech")
+
+	file, content := createSeedDirectory(t, seedDir, "project", map[string]int{
+		"readme.md":      700,
+		"assets/big.bin": config.TransferUnitSize*3 + 11,
+		"assets/zero":    0,
+	})
+
+	seeder := newTestNode(t, network, directory, "seeder", seedDir)
+	leecher := newTestNode(t, network, directory, "leecher", leechDir)
+
+	ih, err := seeder.client.ImportBaoFile(file, seedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !swarmOf(t, seeder.client, ih).FileIO.IsComplete() {
+		t.Fatalf("seeder should detect its complete directory")
+	}
+	seeder.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	leechFile := *file
+	if _, err := leecher.client.ImportBaoFile(&leechFile, leechDir); err != nil {
+		t.Fatal(err)
+	}
+	leecher.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	swarm := swarmOf(t, leecher.client, ih)
+	if !waitFor(t, 15*time.Second, swarm.FileIO.IsComplete) {
+		t.Fatalf("leecher did not complete: %d/%d units", swarm.FileIO.GetBitfield().Count(), swarm.FileIO.unitCount)
+	}
+
+	var offset int
+	for _, entry := range file.Files {
+		got, err := os.ReadFile(filepath.Join(leechDir, "project", filepath.FromSlash(entry.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content[offset:offset+int(entry.Length)]) {
+			t.Fatalf("%s does not match the seeded file", entry.Path)
+		}
+		offset += int(entry.Length)
+	}
+}
@@ -1,7 +1,6 @@
 package core
 
 import (
-	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"log"
@@ -14,10 +13,13 @@ import (
 )
 
 type PeerHandler struct {
-	Peer     protocol.NodeKey
-	Swarm    *Swarm
-	Session  *Session
-	Bitfield Bitfield
+	Peer    protocol.NodeKey
+	Swarm   *Swarm
+	Session *Session
+
+	// Units the peer has announced; bits stay nil until it sends any
+	bitfield   Bitfield
+	bitfieldMu sync.RWMutex
 
 	// Serializer for message encoding/decoding
 	serializer Serializer
@@ -35,6 +37,32 @@ type PeerHandler struct {
 	// For synchronization
 	mu sync.Mutex
 
+	// Requests waiting to be served, in arrival order. A MsgCancel removes its
+	// unit before it is read from disk and sent.
+	uploadQueue  []uint64
+	uploadMu     sync.Mutex
+	uploadSignal chan struct{}
+	uploadOnce   sync.Once
+	closed       chan struct{}
+	closeOnce    sync.Once
+
+	// Choking and interest in both directions, guarded by mu. signalMu keeps
+	// the messages announcing changes in the order the changes were made.
+	amChoking      bool
+	peerChoking    bool
+	amInterested   bool
+	peerInterested bool
+	signalMu       sync.Mutex
+
+	// Per-peer bandwidth buckets, created on first use
+	uploadLimit   *RateLimiter
+	downloadLimit *RateLimiter
+	limitersOnce  sync.Once
+
+	// Last peer exchange sent to and received from this peer
+	pexSent     time.Time
+	pexReceived time.Time
+
 	// Tracking bandwidth
 	uploadedTotal   uint64
 	uploadSamples   []bandwidthSample
@@ -68,6 +96,10 @@ func BaoHandler(
 		state:             protocol.StateConnecting,
 		handshakeReceived: make(chan struct{}),
 		connected:         make(chan struct{}),
+		uploadSignal:      make(chan struct{}, 1),
+		closed:            make(chan struct{}),
+		amChoking:         true,
+		peerChoking:       true,
 	}
 
 	// Register handler before any message processing
@@ -78,6 +110,73 @@ func BaoHandler(
 	return ph, nil
 }
 
+// PeerBitfield returns a copy of the units the peer has announced. Its bits
+// are nil until the peer sends a bitfield or HAVE.
+func (ph *PeerHandler) PeerBitfield() Bitfield {
+	ph.bitfieldMu.RLock()
+	defer ph.bitfieldMu.RUnlock()
+	return ph.bitfield.Clone()
+}
+
+// peerHas reports whether the peer announced the unit.
+func (ph *PeerHandler) peerHas(index uint64) bool {
+	ph.bitfieldMu.RLock()
+	defer ph.bitfieldMu.RUnlock()
+	return ph.bitfield.bits != nil && ph.bitfield.Has(index)
+}
+
+// peerIsSeeder reports whether the peer announced every unit.
+func (ph *PeerHandler) peerIsSeeder() bool {
+	ph.bitfieldMu.RLock()
+	defer ph.bitfieldMu.RUnlock()
+	return ph.bitfield.bits != nil && ph.bitfield.AllSet(ph.Swarm.FileIO.unitCount)
+}
+
+func (ph *PeerHandler) setPeerBitfield(bf Bitfield) {
+	ph.bitfieldMu.Lock()
+	defer ph.bitfieldMu.Unlock()
+	ph.bitfield = bf
+}
+
+// mergePeerBitfield replaces the peer's bitfield with received, keeping any
+// units it announced via HAVE before the bitfield arrived, and returns a copy.
+func (ph *PeerHandler) mergePeerBitfield(received Bitfield) Bitfield {
+	ph.bitfieldMu.Lock()
+	defer ph.bitfieldMu.Unlock()
+
+	if ph.bitfield.bits != nil {
+		for i := uint64(0); i < ph.Swarm.FileIO.unitCount; i++ {
+			if ph.bitfield.Has(i) {
+				received.Set(i)
+			}
+		}
+	}
+	ph.bitfield = received
+	return received.Clone()
+}
+
+// peerHave records a HAVE. One arriving before the bitfield is merged in
+// once that lands.
+func (ph *PeerHandler) peerHave(index uint64) {
+	ph.bitfieldMu.Lock()
+	defer ph.bitfieldMu.Unlock()
+
+	if ph.bitfield.bits == nil {
+		ph.bitfield = NewBitfield(ph.Swarm.FileIO.unitCount)
+	}
+	ph.bitfield.Set(index)
+}
+
+// peerLacks drops a unit the peer turned out not to be able to serve.
+func (ph *PeerHandler) peerLacks(index uint64) {
+	ph.bitfieldMu.Lock()
+	defer ph.bitfieldMu.Unlock()
+
+	if ph.bitfield.bits != nil {
+		ph.bitfield.Clear(index)
+	}
+}
+
 func (ph *PeerHandler) WaitForHandshake(timeout time.Duration) bool {
 	select {
 	case <-ph.handshakeReceived:
@@ -119,6 +218,13 @@ func (ph *PeerHandler) SetState(state protocol.ConnectionState) {
 			close(ph.connected)
 		}
 	}
+
+	switch {
+	case oldState != protocol.StateConnected && state == protocol.StateConnected:
+		ph.Swarm.emit(SwarmEvent{Kind: SwarmPeerConnected, Peer: ph.Peer})
+	case oldState == protocol.StateConnected && state == protocol.StateClosed:
+		ph.Swarm.emit(SwarmEvent{Kind: SwarmPeerDisconnected, Peer: ph.Peer})
+	}
 }
 
 func (ph *PeerHandler) GetState() protocol.ConnectionState {
@@ -128,25 +234,7 @@ func (ph *PeerHandler) GetState() protocol.ConnectionState {
 }
 
 func (ph *PeerHandler) Send(msg protocol.PeerMessage) error {
-	ph.Session.writeMu.Lock()
-	defer ph.Session.writeMu.Unlock()
-
-	data, err := ph.serializer.MarshalPeerMessage(&msg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-
-	// 1. Write length prefix (uint32, big-endian)
-	if err := binary.Write(ph.Session.conn, binary.BigEndian, uint32(len(data))); err != nil {
-		return fmt.Errorf("failed to write length: %w", err)
-	}
-
-	// 2. Write protobuf payload
-	if _, err := ph.Session.conn.Write(data); err != nil {
-		return fmt.Errorf("failed to write payload: %w", err)
-	}
-
-	return nil
+	return ph.Session.Send(ph.serializer, msg)
 }
 
 func (ph *PeerHandler) SendHandshake(peerID protocol.NodeKey) error {
@@ -215,14 +303,22 @@ func (ph *PeerHandler) HandleMessage(msg protocol.PeerMessage) {
 			log.Printf("Failed to unmarshal bitfield from %s: %v", ph.Peer, err)
 			return
 		}
-		ph.Bitfield = BitfieldFromBytes(bf.Bits)
+
+		unitCount := ph.Swarm.FileIO.unitCount
+		if uint64(len(bf.Bits)) != (unitCount+7)/8 {
+			log.Printf("Invalid bitfield length %d from %s", len(bf.Bits), ph.Peer)
+			return
+		}
+
+		received := ph.mergePeerBitfield(BitfieldFromBytes(bf.Bits))
 
 		log.Printf("Received bitfield:")
-		log.Println(ph.Bitfield.ToString(ph.Swarm.FileIO.unitCount))
+		log.Println(received.ToString(unitCount))
 
 		// Notify swarm about updated bitfield
-		ph.Swarm.UpdatePeerBitfield(ph.Peer, ph.Bitfield)
+		ph.Swarm.TransferUnitManager.UpdatePeerBitfield(ph.Peer, received)
 		ph.Swarm.TransferUnitManager.scheduleDownloads()
+		ph.updateInterest()
 
 	case protocol.MsgHave:
 		var have protocol.HavePayload
@@ -231,14 +327,25 @@ func (ph *PeerHandler) HandleMessage(msg protocol.PeerMessage) {
 			return
 		}
 
-		if ph.Bitfield.bits == nil {
-			//TODO: we should init the bitfield if its null, and when we eventually do receive the full initial bitfield state from the peer
-			//we should then AND the initial bitfied state with the one initialized here so we ensure we have both the full init and all the additional HAVE msg bits
-			log.Println("Read TODO: BITFIELD SHOULDNT BE NIL!")
+		if have.UnitIndex >= ph.Swarm.FileIO.unitCount {
+			log.Printf("Invalid have index %d from %s", have.UnitIndex, ph.Peer)
+			return
 		}
 
 		// Update bitfield
-		ph.Bitfield.Set(have.UnitIndex)
+		ph.peerHave(have.UnitIndex)
+		ph.Swarm.TransferUnitManager.PeerHave(ph.Peer, have.UnitIndex)
+
+		if !ph.Swarm.FileIO.HasTransferUnit(have.UnitIndex) {
+			ph.setInterested(true)
+			ph.Swarm.TransferUnitManager.scheduleDownloads()
+		}
+
+	case protocol.MsgChoke, protocol.MsgUnchoke:
+		ph.handlePeerChoke(msg.Type == protocol.MsgChoke)
+
+	case protocol.MsgInterested, protocol.MsgNotInterested:
+		ph.handlePeerInterest(msg.Type == protocol.MsgInterested)
 
 	case protocol.MsgRequest:
 		var req protocol.TransferRequestPayload
@@ -247,10 +354,43 @@ func (ph *PeerHandler) HandleMessage(msg protocol.PeerMessage) {
 			return
 		}
 
-		debugs.NumTransferRequestReceived++
+		debugs.NumTransferRequestReceived.Add(1)
+
+		// Served from the upload queue so a later cancel can still withdraw it
+		ph.enqueueUpload(req.UnitIndex)
+
+	case protocol.MsgPex:
+		var pex protocol.PexPayload
+		if err := ph.serializer.UnmarshalPexPayload(msg.Payload, &pex); err != nil {
+			log.Printf("Failed to unmarshal pex from %s: %v", ph.Peer, err)
+			return
+		}
+
+		ph.handlePex(pex)
+
+	case protocol.MsgCancel:
+		var cancel protocol.CancelPayload
+		if err := ph.serializer.UnmarshalCancelPayload(msg.Payload, &cancel); err != nil {
+			log.Printf("Failed to unmarshal cancel from %s: %v", ph.Peer, err)
+			return
+		}
+
+		ph.cancelUpload(cancel.UnitIndex)
 
-		// Handle incoming transferUnit request (if we have the transferUnit)
-		ph.handleIncomingRequest(req.UnitIndex)
+	case protocol.MsgReject:
+		var reject protocol.RejectPayload
+		if err := ph.serializer.UnmarshalRejectPayload(msg.Payload, &reject); err != nil {
+			log.Printf("Failed to unmarshal reject from %s: %v", ph.Peer, err)
+			return
+		}
+
+		if reject.UnitIndex >= ph.Swarm.FileIO.unitCount {
+			log.Printf("Invalid reject index %d from %s", reject.UnitIndex, ph.Peer)
+			return
+		}
+
+		debugs.NumTransferRejectReceived.Add(1)
+		ph.Swarm.TransferUnitManager.HandleReject(ph.Peer, reject.UnitIndex, reject.Reason)
 
 	case protocol.MsgTransfer:
 		var transferUnit protocol.TransferPayload
@@ -259,6 +399,12 @@ func (ph *PeerHandler) HandleMessage(msg protocol.PeerMessage) {
 			return
 		}
 
+		if ph.Swarm.FileIO.HasTransferUnit(transferUnit.UnitIndex) {
+			// Endgame duplicate that lost the race.
+			debugs.NumTransferDuplicateReceived.Add(1)
+			return
+		}
+
 		// Verify the proof if included
 		if transferUnit.Proof != nil {
 			baoProof := transferUnit.Proof
@@ -285,32 +431,107 @@ func (ph *PeerHandler) HandleMessage(msg protocol.PeerMessage) {
 
 		writeErr := ph.Swarm.FileIO.WriteTransferUnit(transferUnit.UnitIndex, transferUnit.Data)
 		if writeErr == nil {
+			ph.Swarm.TransferUnitManager.CancelOutstanding(transferUnit.UnitIndex, ph.Peer)
+
 			if err := ph.Swarm.SaveProof(transferUnit.UnitIndex, transferUnit.Proof); err != nil {
-				log.Printf("failed to persist proof for unit %d: %v", transferUnit.UnitIndex, err)
+				ph.Swarm.reportError(fmt.Errorf("failed to persist proof for unit %d: %w", transferUnit.UnitIndex, err))
 			}
 
 			// Notify swarm about completed transferUnit
 			ph.Swarm.MarkTransferUnitComplete(transferUnit.UnitIndex, transferUnit.Data)
 
 			// Clean up our request tracking
-			ph.Swarm.TransferUnitManager.transferUnitCompleteChan <- transferUnitCompleteEvent{
+			ph.Swarm.TransferUnitManager.notifyComplete(transferUnitCompleteEvent{
 				transferUnit: transferUnit.UnitIndex,
 				data:         transferUnit.Data,
-			}
+			})
 
 			//TODO: Set readonly as soon as we fully downloaded the file
 			//ph.Swarm.FileIO.SwitchToReadOnly()
 
 		} else {
-			fmt.Println("Failed to write transfer unit to disk: " + writeErr.Error())
+			ph.Swarm.reportError(fmt.Errorf("failed to write transfer unit %d to disk: %w", transferUnit.UnitIndex, writeErr))
+		}
+	}
+}
+
+func (ph *PeerHandler) enqueueUpload(transferUnitIndex uint64) {
+	if ph.Swarm.IsPaused() {
+		ph.reject(transferUnitIndex, protocol.RejectPaused)
+		return
+	}
+	if ph.ChokeState().AmChoking {
+		ph.reject(transferUnitIndex, protocol.RejectChoked)
+		return
+	}
+
+	ph.uploadOnce.Do(func() { ph.Swarm.spawn(ph.uploadLoop) })
+
+	ph.uploadMu.Lock()
+	if len(ph.uploadQueue) >= config.MaxQueuedUploadsPerPeer {
+		ph.uploadMu.Unlock()
+		ph.reject(transferUnitIndex, protocol.RejectOverloaded)
+		return
+	}
+	ph.uploadQueue = append(ph.uploadQueue, transferUnitIndex)
+	ph.uploadMu.Unlock()
+
+	select {
+	case ph.uploadSignal <- struct{}{}:
+	default:
+	}
+}
+
+// cancelUpload drops a queued request that has not been served yet.
+func (ph *PeerHandler) cancelUpload(transferUnitIndex uint64) {
+	ph.uploadMu.Lock()
+	defer ph.uploadMu.Unlock()
+
+	for i, idx := range ph.uploadQueue {
+		if idx == transferUnitIndex {
+			ph.uploadQueue = append(ph.uploadQueue[:i], ph.uploadQueue[i+1:]...)
+			debugs.NumTransferRequestCancelled.Add(1)
+			return
+		}
+	}
+}
+
+func (ph *PeerHandler) uploadLoop() {
+	for {
+		ph.uploadMu.Lock()
+		if len(ph.uploadQueue) == 0 {
+			ph.uploadMu.Unlock()
+
+			select {
+			case <-ph.uploadSignal:
+				continue
+			case <-ph.closed:
+				return
+			case <-ph.Swarm.ctx.Done():
+				return
+			}
 		}
+		transferUnitIndex := ph.uploadQueue[0]
+		ph.uploadQueue = ph.uploadQueue[1:]
+		ph.uploadMu.Unlock()
+
+		ph.handleIncomingRequest(transferUnitIndex)
 	}
 }
 
 func (ph *PeerHandler) handleIncomingRequest(transferUnitIndex uint64) {
+	if ph.Swarm.IsPaused() {
+		ph.reject(transferUnitIndex, protocol.RejectPaused)
+		return
+	}
+
 	// Only serve units that we can prove.
+	if !ph.Swarm.FileIO.HasTransferUnit(transferUnitIndex) {
+		ph.reject(transferUnitIndex, protocol.RejectNotHave)
+		return
+	}
 	if !ph.Swarm.CanServeTransferUnit(transferUnitIndex) {
-		// Don't have it
+		ph.reject(transferUnitIndex, protocol.RejectNoProof)
 		return
 	}
 
@@ -320,24 +541,44 @@ func (ph *PeerHandler) handleIncomingRequest(transferUnitIndex uint64) {
 		//log.Panicf("Failed to read transferUnitdata for transferUnitIndex %d.", transferUnitIndex)
 
 		log.Printf("INVESTIGATE!!!!: Failed to read transferUnitdata for transferUnitIndex %d.", transferUnitIndex)
+		ph.reject(transferUnitIndex, protocol.RejectNotHave)
+		return
+	}
+
+	if !ph.waitUploadBandwidth(len(transferUnitData)) {
+		return
 	}
 
 	// Send the transferUnit
 	if err := ph.SendTransferUnit(transferUnitIndex, transferUnitData); err != nil {
 		log.Printf("Failed to send transferUnit %d to %s: %v", transferUnitIndex, ph.Peer, err)
 	} else {
-		ph.Swarm.Uploaded += uint64(len(transferUnitData))
+		ph.Swarm.Uploaded.Add(uint64(len(transferUnitData)))
 	}
 }
 
+// Close disconnects the handler and removes it from its swarm. The session
+// is released through sm; pass nil when the session has already ended.
+// Closing a handler again does nothing.
 func (ph *PeerHandler) Close(sm *SessionManager) {
+	ph.closeOnce.Do(func() { ph.close(sm) })
+}
+
+func (ph *PeerHandler) close(sm *SessionManager) {
 	ph.SetState(protocol.StateClosed)
+	close(ph.closed)
 
-	// Remove from swarm
+	// Remove from swarm, unless the peer has been given a new handler
 	ph.Swarm.mu.Lock()
-	delete(ph.Swarm.Peers, ph.Peer)
+	if ph.Swarm.Peers[ph.Peer] == ph {
+		delete(ph.Swarm.Peers, ph.Peer)
+	}
 	ph.Swarm.mu.Unlock()
 
+	if ph.Swarm.TransferUnitManager != nil {
+		ph.Swarm.TransferUnitManager.RemovePeer(ph.Peer)
+	}
+
 	// Release session
 	if sm != nil {
 		sm.Release(ph.Peer)
@@ -354,7 +595,7 @@ func (ph *PeerHandler) SendTransferUnitRequest(transferUnitIndex uint64) error {
 		return fmt.Errorf("failed to marshal transferUnit request: %w", err)
 	}
 
-	debugs.NumTransferRequestSend++
+	debugs.NumTransferRequestSend.Add(1)
 
 	return ph.Send(protocol.PeerMessage{
 		InfoHash: ph.Swarm.InfoHash,
@@ -363,6 +604,49 @@ func (ph *PeerHandler) SendTransferUnitRequest(transferUnitIndex uint64) error {
 	})
 }
 
+// reject tells the peer a request will not be served, so it can reassign the
+// unit instead of waiting for the request to time out.
+func (ph *PeerHandler) reject(transferUnitIndex uint64, reason string) {
+	if err := ph.SendReject(transferUnitIndex, reason); err != nil {
+		log.Printf("Failed to reject transferUnit %d for %s: %v", transferUnitIndex, ph.Peer, err)
+	}
+}
+
+func (ph *PeerHandler) SendReject(transferUnitIndex uint64, reason string) error {
+	payload, err := ph.serializer.MarshalRejectPayload(&protocol.RejectPayload{
+		UnitIndex: transferUnitIndex,
+		Reason:    reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal reject message: %w", err)
+	}
+
+	debugs.NumTransferRejectSend.Add(1)
+
+	return ph.Send(protocol.PeerMessage{
+		InfoHash: ph.Swarm.InfoHash,
+		Type:     protocol.MsgReject,
+		Payload:  payload,
+	})
+}
+
+func (ph *PeerHandler) SendCancel(transferUnitIndex uint64) error {
+	payload, err := ph.serializer.MarshalCancelPayload(&protocol.CancelPayload{
+		UnitIndex: transferUnitIndex,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cancel message: %w", err)
+	}
+
+	debugs.NumTransferCancelSend.Add(1)
+
+	return ph.Send(protocol.PeerMessage{
+		InfoHash: ph.Swarm.InfoHash,
+		Type:     protocol.MsgCancel,
+		Payload:  payload,
+	})
+}
+
 func (ph *PeerHandler) SendHave(transferUnitIndex uint64) error {
 	payload, err := ph.serializer.MarshalHavePayload(&protocol.HavePayload{
 		UnitIndex: transferUnitIndex,
@@ -389,7 +673,7 @@ func (ph *PeerHandler) SendTransferUnit(transferUnitIndex uint64, data []byte) e
 
 	if proof == nil {
 		// Generate proof for this segment
-		generatedProof, calculatedRoot, err := GenerateProofOnDisk(ph.Swarm.FileIO.file, offset, length)
+		generatedProof, calculatedRoot, err := GenerateProof(ph.Swarm.FileIO, int64(ph.Swarm.File.Length), offset, length)
 		if err != nil {
 			return fmt.Errorf("failed to generate proof: %w", err)
 		}
@@ -433,7 +717,7 @@ func (ph *PeerHandler) SendTransferUnit(transferUnitIndex uint64, data []byte) e
 
 func (ph *PeerHandler) recordUpload(n int) {
 
-	debugs.NumTransferResponseSend++
+	debugs.NumTransferResponseSend.Add(1)
 
 	now := time.Now()
 
@@ -471,9 +755,16 @@ func (ph *PeerHandler) UploadRate() uint32 {
 	return uint32(sum)
 }
 
+// totals returns the bytes sent to and received from the peer.
+func (ph *PeerHandler) totals() (uploaded, downloaded uint64) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	return ph.uploadedTotal, ph.downloadedTotal
+}
+
 func (ph *PeerHandler) recordDownload(n int) {
 
-	debugs.NumTransferResponseReceived++
+	debugs.NumTransferResponseReceived.Add(1)
 
 	now := time.Now()
 
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"net"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// PeerDialer opens a session-level connection to a peer.
+type PeerDialer interface {
+	Dial(peer protocol.NodeKey) (net.Conn, error)
+}
+
+// PeerListener accepts session-level connections from peers.
+// RemoteAddr().String() of an accepted conn must be the remote NodeKey.
+type PeerListener interface {
+	Accept() (net.Conn, error)
+	Close() error
+}
+
+// PeerTransport carries peer sessions. The NKN, pipe and TCP transports
+// all implement it.
+type PeerTransport interface {
+	PeerDialer
+	PeerListener
+}
+
+// ClaimedIdentityConn is implemented by conns that may report a RemoteAddr
+// the transport has not verified. Over TCP an accepting node only has the
+// dialer's word for its address; NKN addresses are authenticated.
+type ClaimedIdentityConn interface {
+	IdentityClaimed() bool
+}
+
+// identityClaimed reports whether conn's RemoteAddr is unverified.
+func identityClaimed(conn net.Conn) bool {
+	c, ok := conn.(ClaimedIdentityConn)
+	return ok && c.IdentityClaimed()
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// ExchangePeers runs one round of peer exchange: every connected peer that
+// has not heard from us for PexInterval is sent the swarm's other peers, and
+// peers learned from others are dialed. Tracker announces stay the primary
+// source; this keeps swarms growing when trackers are unreachable.
+func (c *Client) ExchangePeers() {
+	for _, swarm := range c.Swarms.All() {
+		if c.isIdle(swarm.InfoHash) {
+			continue
+		}
+
+		swarm.sendDuePex()
+
+		for _, peer := range swarm.takePexCandidates() {
+			if peer.NodeKey == protocol.NodeKey(c.NodeKey) {
+				continue
+			}
+			go c.ConnectPeer(swarm, peer.NodeKey)
+		}
+	}
+}
+
+// connectedPeers lists connected peers other than exclude, flagging those
+// whose advertised bitfield is complete as seeders.
+func (s *Swarm) connectedPeers(exclude protocol.NodeKey) []protocol.Peer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	peers := make([]protocol.Peer, 0, len(s.Peers))
+	for key, handler := range s.Peers {
+		if key == exclude || handler.GetState() != protocol.StateConnected {
+			continue
+		}
+		peers = append(peers, protocol.Peer{
+			NodeKey:  key,
+			IsSeeder: handler.peerIsSeeder(),
+		})
+	}
+	return peers
+}
+
+func (s *Swarm) sendDuePex() {
+	s.mu.RLock()
+	handlers := make([]*PeerHandler, 0, len(s.Peers))
+	for _, handler := range s.Peers {
+		handlers = append(handlers, handler)
+	}
+	s.mu.RUnlock()
+
+	now := time.Now()
+	for _, handler := range handlers {
+		if handler.GetState() != protocol.StateConnected {
+			continue
+		}
+
+		handler.mu.Lock()
+		due := now.Sub(handler.pexSent) >= config.PexInterval
+		if due {
+			handler.pexSent = now
+		}
+		handler.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		peers := s.connectedPeers(handler.Peer)
+		if len(peers) == 0 {
+			continue
+		}
+		go func(h *PeerHandler) {
+			if err := h.SendPex(peers); err != nil {
+				log.Printf("Failed to send pex to %s: %v", h.Peer, err)
+			}
+		}(handler)
+	}
+}
+
+// addPexCandidates records peers learned from a PEX message, skipping ones we
+// are already connected to. Seeders are skipped once we are complete.
+func (s *Swarm) addPexCandidates(peers []protocol.Peer) int {
+	complete := s.FileIO.IsComplete()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := 0
+	for _, peer := range peers {
+		if len(s.pexCandidates) >= config.PexMaxCandidates {
+			break
+		}
+		if peer.NodeKey == "" || (complete && peer.IsSeeder) {
+			continue
+		}
+		if _, exists := s.Peers[peer.NodeKey]; exists {
+			continue
+		}
+		if _, exists := s.pexCandidates[peer.NodeKey]; exists {
+			continue
+		}
+		s.pexCandidates[peer.NodeKey] = peer
+		added++
+	}
+	return added
+}
+
+// takePexCandidates removes and returns as many learned peers as the swarm
+// has room for under PexMaxConnections.
+func (s *Swarm) takePexCandidates() []protocol.Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room := config.PexMaxConnections - len(s.Peers)
+	if room <= 0 || len(s.pexCandidates) == 0 {
+		return nil
+	}
+
+	out := make([]protocol.Peer, 0, len(s.pexCandidates))
+	for key, peer := range s.pexCandidates {
+		delete(s.pexCandidates, key)
+		if _, exists := s.Peers[key]; exists {
+			continue
+		}
+		out = append(out, peer)
+		if len(out) == room {
+			break
+		}
+	}
+	return out
+}
+
+// SendPex sends up to PexMaxPeers of peers, chosen at random.
+func (ph *PeerHandler) SendPex(peers []protocol.Peer) error {
+	if len(peers) > config.PexMaxPeers {
+		rand.Shuffle(len(peers), func(i, j int) {
+			peers[i], peers[j] = peers[j], peers[i]
+		})
+		peers = peers[:config.PexMaxPeers]
+	}
+
+	payload, err := ph.serializer.MarshalPexPayload(&protocol.PexPayload{Peers: peers})
+	if err != nil {
+		return err
+	}
+
+	return ph.Send(protocol.PeerMessage{
+		InfoHash: ph.Swarm.InfoHash,
+		Type:     protocol.MsgPex,
+		Payload:  payload,
+	})
+}
+
+func (ph *PeerHandler) handlePex(payload protocol.PexPayload) {
+	now := time.Now()
+
+	// Peers send at most once per PexInterval; allow some slack for timing
+	ph.mu.Lock()
+	tooSoon := !ph.pexReceived.IsZero() && now.Sub(ph.pexReceived) < config.PexInterval/2
+	if !tooSoon {
+		ph.pexReceived = now
+	}
+	ph.mu.Unlock()
+
+	if tooSoon {
+		log.Printf("Ignoring pex from %s: sent too soon", ph.Peer)
+		return
+	}
+
+	peers := payload.Peers
+	if len(peers) > config.PexMaxPeers {
+		peers = peers[:config.PexMaxPeers]
+	}
+
+	if added := ph.Swarm.addPexCandidates(peers); added > 0 {
+		log.Printf("Learned %d peers from %s via pex", added, ph.Peer)
+	}
+}
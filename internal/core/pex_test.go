@@ -0,0 +1,108 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func TestPexIntroducesPeersWithoutTracker(t *testing.T) {
+	root, err := os.MkdirTemp("", "swarm-pex-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	network := pipetransport.NewNetwork()
+	directory := tracker.NewDirectory()
+
+	// Nobody has the data, so no download races the exchange
+	srcDir := filepath.Join(root, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := createSeedFile(t, srcDir, "pex.bin", config.TransferUnitSize*2)
+
+	nodes := make(map[string]*testNode)
+	swarms := make(map[string]*Swarm)
+	for _, name := range []string{"a", "b", "c"} {
+		dir := filepath.Join(root, name)
+		nodes[name] = newTestNode(t, network, directory, name, dir)
+
+		copied := *file
+		ih, err := nodes[name].client.ImportBaoFile(&copied, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		swarms[name] = swarmOf(t, nodes[name].client, ih)
+	}
+
+	// b knows a, c knows only b
+	nodes["b"].client.ConnectPeer(swarms["b"], "a")
+	nodes["c"].client.ConnectPeer(swarms["c"], "b")
+
+	connected := func(name string, peer protocol.NodeKey) func() bool {
+		return func() bool {
+			swarms[name].mu.RLock()
+			defer swarms[name].mu.RUnlock()
+			h, ok := swarms[name].Peers[peer]
+			return ok && h.GetState() == protocol.StateConnected
+		}
+	}
+	if !waitFor(t, 5*time.Second, connected("b", "c")) {
+		t.Fatalf("b never saw c connect")
+	}
+
+	nodes["b"].client.ExchangePeers()
+
+	learned := func() bool {
+		swarms["c"].mu.RLock()
+		defer swarms["c"].mu.RUnlock()
+		_, ok := swarms["c"].pexCandidates["a"]
+		return ok
+	}
+	if !waitFor(t, 5*time.Second, learned) {
+		t.Fatalf("c did not learn about a via pex")
+	}
+
+	nodes["c"].client.ExchangePeers()
+	if !waitFor(t, 5*time.Second, connected("c", "a")) {
+		t.Fatalf("c did not connect to the peer learned via pex")
+	}
+}
+
+func TestPexRateLimitsAndCaps(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	peer, _ := newTestPeer(t, swarm, "sender", NewBitfield(4))
+
+	many := make([]protocol.Peer, config.PexMaxPeers+10)
+	for i := range many {
+		many[i] = protocol.Peer{NodeKey: protocol.NodeKey("p" + string(rune('A'+i%26)) + string(rune('a'+i/26)))}
+	}
+
+	peer.handlePex(protocol.PexPayload{Peers: many})
+	if got := len(swarm.pexCandidates); got != config.PexMaxPeers {
+		t.Fatalf("expected %d candidates after cap, got %d", config.PexMaxPeers, got)
+	}
+
+	// A second message right away is ignored
+	peer.handlePex(protocol.PexPayload{Peers: []protocol.Peer{{NodeKey: "late"}}})
+	if _, ok := swarm.pexCandidates["late"]; ok {
+		t.Fatalf("pex sent too soon should be ignored")
+	}
+
+	// Peers we are already connected to are not candidates
+	peer.mu.Lock()
+	peer.pexReceived = time.Time{}
+	peer.mu.Unlock()
+	peer.handlePex(protocol.PexPayload{Peers: []protocol.Peer{{NodeKey: "sender"}}})
+	if _, ok := swarm.pexCandidates["sender"]; ok {
+		t.Fatalf("connected peer should not become a candidate")
+	}
+}
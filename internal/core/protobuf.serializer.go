@@ -143,6 +143,112 @@ func (p *ProtobufSerializer) UnmarshalRejectPayload(data []byte, pl *protocol.Re
 	return nil
 }
 
+func (p *ProtobufSerializer) MarshalCancelPayload(pl *protocol.CancelPayload) ([]byte, error) {
+	pbPayload := &pb.CancelPayload{
+		UnitIndex: pl.UnitIndex,
+	}
+	return pbPayload.MarshalVT()
+}
+
+func (p *ProtobufSerializer) UnmarshalCancelPayload(data []byte, pl *protocol.CancelPayload) error {
+	pbPayload := &pb.CancelPayload{}
+	if err := pbPayload.UnmarshalVT(data); err != nil {
+		return err
+	}
+	pl.UnitIndex = pbPayload.UnitIndex
+	return nil
+}
+
+func (p *ProtobufSerializer) MarshalMetadataPayload(pl *protocol.MetadataPayload) ([]byte, error) {
+	pbPayload := &pb.MetadataPayload{
+		Data: pl.Data,
+	}
+	return pbPayload.MarshalVT()
+}
+
+func (p *ProtobufSerializer) UnmarshalMetadataPayload(data []byte, pl *protocol.MetadataPayload) error {
+	pbPayload := &pb.MetadataPayload{}
+	if err := pbPayload.UnmarshalVT(data); err != nil {
+		return err
+	}
+	pl.Data = pbPayload.Data
+	return nil
+}
+
+func (p *ProtobufSerializer) MarshalPexPayload(pl *protocol.PexPayload) ([]byte, error) {
+	pbPayload := &pb.PexPayload{
+		Peers: make([]*pb.PexPeer, len(pl.Peers)),
+	}
+	for i, peer := range pl.Peers {
+		pbPayload.Peers[i] = &pb.PexPeer{
+			NodeKey:  string(peer.NodeKey),
+			IsSeeder: peer.IsSeeder,
+		}
+	}
+	return pbPayload.MarshalVT()
+}
+
+func (p *ProtobufSerializer) UnmarshalPexPayload(data []byte, pl *protocol.PexPayload) error {
+	pbPayload := &pb.PexPayload{}
+	if err := pbPayload.UnmarshalVT(data); err != nil {
+		return err
+	}
+	pl.Peers = make([]protocol.Peer, len(pbPayload.Peers))
+	for i, peer := range pbPayload.Peers {
+		pl.Peers[i] = protocol.Peer{
+			NodeKey:  protocol.NodeKey(peer.NodeKey),
+			IsSeeder: peer.IsSeeder,
+		}
+	}
+	return nil
+}
+
+func (p *ProtobufSerializer) MarshalDHTPayload(pl *protocol.DHTPayload) ([]byte, error) {
+	pbPayload := &pb.DhtPayload{
+		TransactionId: pl.TransactionID,
+		Method:        pl.Method,
+		Target:        pl.Target,
+		Seeder:        pl.Seeder,
+		Nodes:         make([]string, len(pl.Nodes)),
+		Peers:         make([]*pb.PexPeer, len(pl.Peers)),
+		Error:         pl.Error,
+	}
+	for i, node := range pl.Nodes {
+		pbPayload.Nodes[i] = string(node)
+	}
+	for i, peer := range pl.Peers {
+		pbPayload.Peers[i] = &pb.PexPeer{
+			NodeKey:  string(peer.NodeKey),
+			IsSeeder: peer.IsSeeder,
+		}
+	}
+	return pbPayload.MarshalVT()
+}
+
+func (p *ProtobufSerializer) UnmarshalDHTPayload(data []byte, pl *protocol.DHTPayload) error {
+	pbPayload := &pb.DhtPayload{}
+	if err := pbPayload.UnmarshalVT(data); err != nil {
+		return err
+	}
+	pl.TransactionID = pbPayload.TransactionId
+	pl.Method = pbPayload.Method
+	pl.Target = pbPayload.Target
+	pl.Seeder = pbPayload.Seeder
+	pl.Error = pbPayload.Error
+	pl.Nodes = make([]protocol.NodeKey, len(pbPayload.Nodes))
+	for i, node := range pbPayload.Nodes {
+		pl.Nodes[i] = protocol.NodeKey(node)
+	}
+	pl.Peers = make([]protocol.Peer, len(pbPayload.Peers))
+	for i, peer := range pbPayload.Peers {
+		pl.Peers[i] = protocol.Peer{
+			NodeKey:  protocol.NodeKey(peer.NodeKey),
+			IsSeeder: peer.IsSeeder,
+		}
+	}
+	return nil
+}
+
 // Helper conversion functions
 func (p *ProtobufSerializer) peerMessageTypeToProto(t protocol.PeerMessageType) pb.PeerMessageType {
 	switch t {
@@ -158,6 +264,26 @@ func (p *ProtobufSerializer) peerMessageTypeToProto(t protocol.PeerMessageType)
 		return pb.PeerMessageType_MSG_TRANSFER
 	case protocol.MsgReject:
 		return pb.PeerMessageType_MSG_REJECT
+	case protocol.MsgCancel:
+		return pb.PeerMessageType_MSG_CANCEL
+	case protocol.MsgMetadataRequest:
+		return pb.PeerMessageType_MSG_METADATA_REQUEST
+	case protocol.MsgMetadata:
+		return pb.PeerMessageType_MSG_METADATA
+	case protocol.MsgPex:
+		return pb.PeerMessageType_MSG_PEX
+	case protocol.MsgDHTQuery:
+		return pb.PeerMessageType_MSG_DHT_QUERY
+	case protocol.MsgDHTResponse:
+		return pb.PeerMessageType_MSG_DHT_RESPONSE
+	case protocol.MsgChoke:
+		return pb.PeerMessageType_MSG_CHOKE
+	case protocol.MsgUnchoke:
+		return pb.PeerMessageType_MSG_UNCHOKE
+	case protocol.MsgInterested:
+		return pb.PeerMessageType_MSG_INTERESTED
+	case protocol.MsgNotInterested:
+		return pb.PeerMessageType_MSG_NOT_INTERESTED
 	default:
 		return pb.PeerMessageType_MSG_HANDSHAKE
 	}
@@ -177,6 +303,26 @@ func (p *ProtobufSerializer) protoToPeerMessageType(t pb.PeerMessageType) protoc
 		return protocol.MsgTransfer
 	case pb.PeerMessageType_MSG_REJECT:
 		return protocol.MsgReject
+	case pb.PeerMessageType_MSG_CANCEL:
+		return protocol.MsgCancel
+	case pb.PeerMessageType_MSG_METADATA_REQUEST:
+		return protocol.MsgMetadataRequest
+	case pb.PeerMessageType_MSG_METADATA:
+		return protocol.MsgMetadata
+	case pb.PeerMessageType_MSG_PEX:
+		return protocol.MsgPex
+	case pb.PeerMessageType_MSG_DHT_QUERY:
+		return protocol.MsgDHTQuery
+	case pb.PeerMessageType_MSG_DHT_RESPONSE:
+		return protocol.MsgDHTResponse
+	case pb.PeerMessageType_MSG_CHOKE:
+		return protocol.MsgChoke
+	case pb.PeerMessageType_MSG_UNCHOKE:
+		return protocol.MsgUnchoke
+	case pb.PeerMessageType_MSG_INTERESTED:
+		return protocol.MsgInterested
+	case pb.PeerMessageType_MSG_NOT_INTERESTED:
+		return protocol.MsgNotInterested
 	default:
 		return protocol.MsgHandshake
 	}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// QueueMove is how MoveInQueue changes a swarm's queue position.
+type QueueMove string
+
+const (
+	QueueTop    QueueMove = "top"
+	QueueUp     QueueMove = "up"
+	QueueDown   QueueMove = "down"
+	QueueBottom QueueMove = "bottom"
+)
+
+// IsQueued reports whether the swarm is held back by the queue limits.
+func (c *Client) IsQueued(ih protocol.InfoHash) bool {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	return c.queued[ih]
+}
+
+// isIdle reports whether the swarm must not connect or announce.
+func (c *Client) isIdle(ih protocol.InfoHash) bool {
+	return c.IsPaused(ih) || c.IsQueued(ih)
+}
+
+// QueuePosition returns the swarm's 0-based place in the queue, or -1.
+func (c *Client) QueuePosition(ih protocol.InfoHash) int {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	for i, queued := range c.queueOrder {
+		if queued == ih {
+			return i
+		}
+	}
+	return -1
+}
+
+// QueueLimits returns how many downloads and seeds may be active at once;
+// 0 means unlimited.
+func (c *Client) QueueLimits() (downloads, seeds int) {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	return c.maxDownloads, c.maxSeeds
+}
+
+func (c *Client) SetQueueLimits(downloads, seeds int) error {
+	if downloads < 0 || seeds < 0 {
+		return fmt.Errorf("queue limits must not be negative")
+	}
+
+	c.queueMu.Lock()
+	c.maxDownloads, c.maxSeeds = downloads, seeds
+	c.queueMu.Unlock()
+
+	c.rebalanceQueue()
+	return nil
+}
+
+// MoveInQueue changes the swarm's queue position, which may start it or
+// queue another swarm in its place.
+func (c *Client) MoveInQueue(ih protocol.InfoHash, move QueueMove) error {
+	c.queueMu.Lock()
+
+	from := -1
+	for i, queued := range c.queueOrder {
+		if queued == ih {
+			from = i
+		}
+	}
+	if from < 0 {
+		c.queueMu.Unlock()
+		return fmt.Errorf("swarm %s is not in the queue", ih)
+	}
+
+	to := from
+	switch move {
+	case QueueTop:
+		to = 0
+	case QueueUp:
+		to = from - 1
+	case QueueDown:
+		to = from + 1
+	case QueueBottom:
+		to = len(c.queueOrder) - 1
+	default:
+		c.queueMu.Unlock()
+		return fmt.Errorf("unknown queue move %q", move)
+	}
+	if to < 0 {
+		to = 0
+	}
+	if to >= len(c.queueOrder) {
+		to = len(c.queueOrder) - 1
+	}
+
+	order := append(c.queueOrder[:from:from], c.queueOrder[from+1:]...)
+	order = append(order[:to], append([]protocol.InfoHash{ih}, order[to:]...)...)
+	c.queueOrder = order
+	c.queueMu.Unlock()
+
+	c.rebalanceQueue()
+	return nil
+}
+
+// enqueueSwarm adds a new swarm at the back of the queue. It is held back
+// quietly if there is no slot for it; otherwise the caller announces it.
+func (c *Client) enqueueSwarm(ih protocol.InfoHash) {
+	c.queueMu.Lock()
+	known := false
+	for _, queued := range c.queueOrder {
+		known = known || queued == ih
+	}
+	if !known {
+		c.queueOrder = append(c.queueOrder, ih)
+	}
+	c.queued[ih] = true
+	c.queueMu.Unlock()
+
+	if swarm, ok := c.Swarms.Get(ih); ok {
+		swarm.SetPaused(true)
+	}
+	c.rebalance(ih)
+}
+
+func (c *Client) dequeueSwarm(ih protocol.InfoHash) {
+	c.queueMu.Lock()
+	for i, queued := range c.queueOrder {
+		if queued == ih {
+			c.queueOrder = append(c.queueOrder[:i], c.queueOrder[i+1:]...)
+			break
+		}
+	}
+	delete(c.queued, ih)
+	c.queueMu.Unlock()
+
+	c.rebalanceQueue()
+}
+
+// rebalanceQueue activates the first swarms in queue order up to the limits,
+// counting downloads and seeds separately, and queues the rest. Paused swarms
+// do not take a slot.
+func (c *Client) rebalanceQueue() {
+	c.rebalance(protocol.InfoHash{})
+}
+
+// rebalance does the work of rebalanceQueue. A promoted fresh swarm is not
+// announced, since whoever added or resumed it does that.
+func (c *Client) rebalance(fresh protocol.InfoHash) {
+	var started, stopped []*Swarm
+
+	c.queueMu.Lock()
+	downloads, seeds := 0, 0
+	for _, ih := range c.queueOrder {
+		swarm, ok := c.Swarms.Get(ih)
+		if !ok || c.IsPaused(ih) {
+			continue
+		}
+
+		active := false
+		if swarm.FileIO.IsComplete() {
+			seeds++
+			active = c.maxSeeds == 0 || seeds <= c.maxSeeds
+		} else {
+			downloads++
+			active = c.maxDownloads == 0 || downloads <= c.maxDownloads
+		}
+
+		switch {
+		case active && c.queued[ih]:
+			delete(c.queued, ih)
+			swarm.SetPaused(false)
+			if ih != fresh {
+				started = append(started, swarm)
+			}
+		case !active && !c.queued[ih]:
+			c.queued[ih] = true
+			swarm.SetPaused(true)
+			stopped = append(stopped, swarm)
+		}
+	}
+	c.queueMu.Unlock()
+
+	for _, swarm := range stopped {
+		log.Printf("Queued swarm %s", swarm.InfoHash)
+		swarm.DisconnectAll(c.Sessions)
+		go c.announceStopped(context.Background(), swarm)
+		swarm.emit(SwarmEvent{Kind: SwarmQueued})
+	}
+	for _, swarm := range started {
+		log.Printf("Starting queued swarm %s", swarm.InfoHash)
+		go c.AnnounceSwarm(context.Background(), swarm.InfoHash, protocol.EventStarted)
+		swarm.emit(SwarmEvent{Kind: SwarmStarted})
+	}
+
+	c.SaveState()
+}
+
+// announceStopped tells the swarm's trackers and discovery sources we left.
+func (c *Client) announceStopped(ctx context.Context, swarm *Swarm) {
+	req := protocol.AnnounceRequest{
+		InfoHash:   swarm.InfoHash,
+		Event:      protocol.EventStopped,
+		Uploaded:   swarm.Uploaded.Load(),
+		Downloaded: swarm.Downloaded.Load(),
+		Left:       swarm.CalcLeft(),
+		Timestamp:  uint64(time.Now().Unix()),
+	}
+
+	for _, target := range c.announceTargets(swarm.File.Trackers) {
+		c.announceTo(ctx, swarm, target, req)
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// newQueueTestClient imports n downloads, in order, into a client that runs
+// one download at a time.
+func newQueueTestClient(t *testing.T, n int) (*Client, []protocol.InfoHash) {
+	t.Helper()
+
+	root, err := os.MkdirTemp("", "queue-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	srcDir, dstDir := filepath.Join(root, "src"), filepath.Join(root, "dst")
+	for _, dir := range []string{srcDir, dstDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	node := newTestNode(t, pipetransport.NewNetwork(), tracker.NewDirectory(), "self", dstDir)
+	if err := node.client.SetQueueLimits(1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	ihs := make([]protocol.InfoHash, n)
+	for i := range ihs {
+		file, _ := createSeedFile(t, srcDir, fmt.Sprintf("queued-%d.bin", i), config.TransferUnitSize*(i+1))
+		ih, err := node.client.ImportBaoFile(file, dstDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ihs[i] = ih
+	}
+	return node.client, ihs
+}
+
+func expectActive(t *testing.T, c *Client, ihs []protocol.InfoHash, active ...int) {
+	t.Helper()
+
+	want := make(map[int]bool)
+	for _, i := range active {
+		want[i] = true
+	}
+	for i, ih := range ihs {
+		if active := !c.isIdle(ih); active != want[i] {
+			t.Fatalf("swarm %d: active %v, want %v", i, active, want[i])
+		}
+		if swarmOf(t, c, ih).IsPaused() != c.isIdle(ih) {
+			t.Fatalf("swarm %d: paused flag does not match the queue", i)
+		}
+	}
+}
+
+func TestQueueHoldsBackExtraDownloads(t *testing.T) {
+	c, ihs := newQueueTestClient(t, 3)
+	expectActive(t, c, ihs, 0)
+
+	for i, ih := range ihs {
+		if got := c.QueuePosition(ih); got != i {
+			t.Fatalf("swarm %d is at queue position %d", i, got)
+		}
+	}
+
+	// Pausing frees the slot for the next in line
+	c.PauseSwarm(ihs[0])
+	expectActive(t, c, ihs, 1)
+
+	c.ResumeSwarm(ihs[0])
+	expectActive(t, c, ihs, 0)
+}
+
+func TestQueueMovePromotesSwarm(t *testing.T) {
+	c, ihs := newQueueTestClient(t, 3)
+
+	if err := c.MoveInQueue(ihs[2], QueueTop); err != nil {
+		t.Fatal(err)
+	}
+	expectActive(t, c, ihs, 2)
+	if got := c.QueuePosition(ihs[0]); got != 1 {
+		t.Fatalf("moving another swarm to the top should shift swarm 0 down, got %d", got)
+	}
+
+	if err := c.MoveInQueue(ihs[2], QueueDown); err != nil {
+		t.Fatal(err)
+	}
+	expectActive(t, c, ihs, 0)
+
+	if err := c.MoveInQueue(ihs[2], "sideways"); err == nil {
+		t.Fatalf("expected an unknown move to fail")
+	}
+}
+
+func TestCompletedDownloadFreesSlot(t *testing.T) {
+	c, ihs := newQueueTestClient(t, 2)
+
+	swarmOf(t, c, ihs[0]).MarkAllUnitsAvailable()
+	c.rebalanceQueue()
+	expectActive(t, c, ihs, 0, 1)
+
+	// Seeds have their own limit
+	if err := c.SetQueueLimits(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	swarmOf(t, c, ihs[1]).MarkAllUnitsAvailable()
+	c.rebalanceQueue()
+	expectActive(t, c, ihs, 0)
+
+	c.RemoveSwarm(ihs[0])
+	if c.IsQueued(ihs[1]) {
+		t.Fatalf("removing a seed should start the queued one")
+	}
+}
+
+func TestPauseAnnouncesStoppedAndResumeRejoins(t *testing.T) {
+	dir := t.TempDir()
+	directory := tracker.NewDirectory()
+	trk := tracker.New(tracker.Config{})
+	directory.Register("bao.tracker", trk)
+
+	c := newTestNode(t, pipetransport.NewNetwork(), directory, "self", dir).client
+	file, _ := createSeedFile(t, dir, "paused.bin", config.TransferUnitSize)
+	ih, err := c.ImportBaoFile(file, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	announced := func() bool { return len(trk.Peers(ih)) == 1 }
+	if !announced() {
+		t.Fatalf("expected the swarm to be announced")
+	}
+
+	c.PauseSwarm(ih)
+	if !waitFor(t, time.Second, func() bool { return !announced() }) {
+		t.Fatalf("pausing should announce stopped")
+	}
+	if !c.ResumeSwarm(ih) || !waitFor(t, time.Second, announced) {
+		t.Fatalf("resuming should announce started")
+	}
+}
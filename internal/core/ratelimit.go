@@ -0,0 +1,328 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+)
+
+// RateLimiter is a token bucket in bytes per second. It holds up to one
+// second of tokens, but never less than a transfer unit so any unit can pass.
+// A limit of 0 means unlimited.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  uint64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(limit uint64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(limit)
+	return l
+}
+
+func (l *RateLimiter) Limit() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetLimit changes the rate, starting with a full bucket.
+func (l *RateLimiter) SetLimit(limit uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit == l.limit && !l.last.IsZero() {
+		return
+	}
+	l.limit = limit
+	l.tokens = l.burstLocked()
+	l.last = time.Now()
+}
+
+func (l *RateLimiter) burstLocked() float64 {
+	if l.limit < uint64(config.TransferUnitSize) {
+		return float64(config.TransferUnitSize)
+	}
+	return float64(l.limit)
+}
+
+func (l *RateLimiter) refillLocked(now time.Time) {
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.limit)
+		if burst := l.burstLocked(); l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+}
+
+// wait returns how long until n bytes are available, 0 if they are now.
+func (l *RateLimiter) wait(n int, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == 0 {
+		return 0
+	}
+	l.refillLocked(now)
+
+	missing := float64(n) - l.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(l.limit) * float64(time.Second))
+}
+
+func (l *RateLimiter) take(n int, now time.Time) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == 0 {
+		return
+	}
+	l.refillLocked(now)
+	l.tokens -= float64(n)
+}
+
+// waitAll returns how long until every limiter has n bytes available.
+func waitAll(limiters []*RateLimiter, n int, now time.Time) time.Duration {
+	var longest time.Duration
+	for _, l := range limiters {
+		if d := l.wait(n, now); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// takeAll spends n bytes from every limiter if all of them have them.
+func takeAll(limiters []*RateLimiter, n int, now time.Time) bool {
+	if waitAll(limiters, n, now) > 0 {
+		return false
+	}
+	for _, l := range limiters {
+		l.take(n, now)
+	}
+	return true
+}
+
+// BandwidthLimits are the client-wide limits in bytes per second; 0 means
+// unlimited. PeerUpload and PeerDownload apply to every peer separately.
+type BandwidthLimits struct {
+	Upload       uint64
+	Download     uint64
+	PeerUpload   uint64
+	PeerDownload uint64
+	Schedule     []LimitSchedule
+}
+
+// LimitSchedule replaces the client-wide limits between Start and End (local
+// "HH:MM", wrapping past midnight when End is earlier) on Days, or every day
+// if Days is empty. The first matching entry wins.
+type LimitSchedule struct {
+	Days     []time.Weekday
+	Start    string
+	End      string
+	Upload   uint64
+	Download uint64
+}
+
+func (s LimitSchedule) validate() error {
+	if _, err := parseClock(s.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(s.End); err != nil {
+		return err
+	}
+	for _, day := range s.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", day)
+		}
+	}
+	return nil
+}
+
+func (s LimitSchedule) matches(now time.Time) bool {
+	if len(s.Days) > 0 {
+		found := false
+		for _, day := range s.Days {
+			found = found || day == now.Weekday()
+		}
+		if !found {
+			return false
+		}
+	}
+
+	start, _ := parseClock(s.Start)
+	end, _ := parseClock(s.End)
+	minute := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// parseClock parses "HH:MM" into minutes past midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// clientBandwidth is shared by the client and its swarms.
+type clientBandwidth struct {
+	upload       *RateLimiter
+	download     *RateLimiter
+	peerUpload   atomic.Uint64
+	peerDownload atomic.Uint64
+
+	mu     sync.Mutex
+	limits BandwidthLimits
+}
+
+func newClientBandwidth() *clientBandwidth {
+	return &clientBandwidth{
+		upload:   NewRateLimiter(0),
+		download: NewRateLimiter(0),
+	}
+}
+
+// BandwidthLimits returns the configured client-wide limits.
+func (c *Client) BandwidthLimits() BandwidthLimits {
+	c.bandwidth.mu.Lock()
+	defer c.bandwidth.mu.Unlock()
+
+	limits := c.bandwidth.limits
+	limits.Schedule = append([]LimitSchedule(nil), limits.Schedule...)
+	return limits
+}
+
+// SetBandwidthLimits replaces the client-wide limits and applies them.
+func (c *Client) SetBandwidthLimits(limits BandwidthLimits) error {
+	for i, entry := range limits.Schedule {
+		if err := entry.validate(); err != nil {
+			return fmt.Errorf("schedule entry %d: %w", i, err)
+		}
+	}
+
+	c.bandwidth.mu.Lock()
+	c.bandwidth.limits = limits
+	c.bandwidth.mu.Unlock()
+
+	c.bandwidth.peerUpload.Store(limits.PeerUpload)
+	c.bandwidth.peerDownload.Store(limits.PeerDownload)
+	c.ApplyBandwidthSchedule(time.Now())
+	return nil
+}
+
+// ApplyBandwidthSchedule puts the client-wide limits for now into effect.
+// It is called when the limits change and periodically for the schedule.
+func (c *Client) ApplyBandwidthSchedule(now time.Time) {
+	upload, download := c.activeBandwidthLimits(now)
+	c.bandwidth.upload.SetLimit(upload)
+	c.bandwidth.download.SetLimit(download)
+}
+
+func (c *Client) activeBandwidthLimits(now time.Time) (upload, download uint64) {
+	c.bandwidth.mu.Lock()
+	defer c.bandwidth.mu.Unlock()
+
+	for _, entry := range c.bandwidth.limits.Schedule {
+		if entry.matches(now) {
+			return entry.Upload, entry.Download
+		}
+	}
+	return c.bandwidth.limits.Upload, c.bandwidth.limits.Download
+}
+
+// ActiveBandwidthLimits returns the client-wide limits in force right now.
+func (c *Client) ActiveBandwidthLimits() (upload, download uint64) {
+	return c.bandwidth.upload.Limit(), c.bandwidth.download.Limit()
+}
+
+// SetBandwidthLimit caps this swarm's upload and download in bytes per
+// second; 0 means unlimited.
+func (s *Swarm) SetBandwidthLimit(upload, download uint64) {
+	s.uploadLimit.SetLimit(upload)
+	s.downloadLimit.SetLimit(download)
+}
+
+func (s *Swarm) BandwidthLimit() (upload, download uint64) {
+	return s.uploadLimit.Limit(), s.downloadLimit.Limit()
+}
+
+// uploadLimiters returns the buckets an upload to this peer passes through,
+// from the whole client down to the peer itself.
+func (ph *PeerHandler) uploadLimiters() []*RateLimiter {
+	ph.initLimiters()
+
+	limiters := []*RateLimiter{ph.Swarm.uploadLimit, ph.uploadLimit}
+	if bw := ph.Swarm.bandwidth; bw != nil {
+		ph.uploadLimit.SetLimit(bw.peerUpload.Load())
+		limiters = append(limiters, bw.upload)
+	}
+	return limiters
+}
+
+func (ph *PeerHandler) downloadLimiters() []*RateLimiter {
+	ph.initLimiters()
+
+	limiters := []*RateLimiter{ph.Swarm.downloadLimit, ph.downloadLimit}
+	if bw := ph.Swarm.bandwidth; bw != nil {
+		ph.downloadLimit.SetLimit(bw.peerDownload.Load())
+		limiters = append(limiters, bw.download)
+	}
+	return limiters
+}
+
+func (ph *PeerHandler) initLimiters() {
+	ph.limitersOnce.Do(func() {
+		ph.uploadLimit = NewRateLimiter(0)
+		ph.downloadLimit = NewRateLimiter(0)
+	})
+}
+
+// waitUploadBandwidth blocks until n bytes may be sent to the peer, and
+// returns false if the peer is closed first.
+func (ph *PeerHandler) waitUploadBandwidth(n int) bool {
+	limiters := ph.uploadLimiters()
+	for {
+		now := time.Now()
+		if takeAll(limiters, n, now) {
+			return true
+		}
+
+		select {
+		case <-time.After(waitAll(limiters, n, now)):
+		case <-ph.closed:
+			return false
+		case <-ph.Swarm.ctx.Done():
+			return false
+		}
+	}
+}
+
+// takeDownloadBandwidth reserves a transfer unit of download bandwidth for a
+// request to the peer, or returns false if a limit has none left.
+func (ph *PeerHandler) takeDownloadBandwidth(now time.Time) bool {
+	return takeAll(ph.downloadLimiters(), config.TransferUnitSize, now)
+}
+
+func (ph *PeerHandler) downloadThrottled(now time.Time) bool {
+	return waitAll(ph.downloadLimiters(), config.TransferUnitSize, now) > 0
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+)
+
+func TestRateLimiterRefillsAtLimit(t *testing.T) {
+	unit := config.TransferUnitSize
+	l := NewRateLimiter(uint64(2 * unit))
+	start := l.last
+
+	if !takeAll([]*RateLimiter{l}, 2*unit, start) {
+		t.Fatalf("a full bucket should allow one second of traffic")
+	}
+	if takeAll([]*RateLimiter{l}, unit, start) {
+		t.Fatalf("an empty bucket should not allow more")
+	}
+	if got := l.wait(unit, start); got != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms for a unit, got %v", got)
+	}
+	if !takeAll([]*RateLimiter{l}, unit, start.Add(500*time.Millisecond)) {
+		t.Fatalf("the bucket should have refilled a unit")
+	}
+
+	l.SetLimit(0)
+	if l.wait(1<<30, start) != 0 {
+		t.Fatalf("a zero limit should be unlimited")
+	}
+}
+
+func TestLimitScheduleMatches(t *testing.T) {
+	workHours := LimitSchedule{
+		Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start: "09:00",
+		End:   "17:00",
+	}
+	night := LimitSchedule{Start: "22:00", End: "06:00"}
+
+	monday := time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		entry LimitSchedule
+		at    time.Time
+		want  bool
+	}{
+		{workHours, monday.Add(10 * time.Hour), true},
+		{workHours, monday.Add(17 * time.Hour), false},
+		{workHours, monday.Add(-14 * time.Hour), false}, // Sunday 10:00
+		{night, monday.Add(23 * time.Hour), true},
+		{night, monday.Add(5 * time.Hour), true},
+		{night, monday.Add(12 * time.Hour), false},
+	}
+	for i, c := range cases {
+		if got := c.entry.matches(c.at); got != c.want {
+			t.Fatalf("case %d: matches(%v) = %v, want %v", i, c.at, got, c.want)
+		}
+	}
+}
+
+func TestSetBandwidthLimitsAppliesSchedule(t *testing.T) {
+	c := NewClient("self", nil, nil)
+
+	err := c.SetBandwidthLimits(BandwidthLimits{Schedule: []LimitSchedule{{Start: "9am", End: "17:00"}}})
+	if err == nil {
+		t.Fatalf("expected an invalid schedule to be rejected")
+	}
+
+	err = c.SetBandwidthLimits(BandwidthLimits{
+		Upload:   1000,
+		Download: 2000,
+		Schedule: []LimitSchedule{{Start: "09:00", End: "18:00", Upload: 10, Download: 20}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2026, 10, 12, 12, 0, 0, 0, time.Local)
+	c.ApplyBandwidthSchedule(at)
+	if up, down := c.ActiveBandwidthLimits(); up != 10 || down != 20 {
+		t.Fatalf("expected scheduled limits 10/20, got %d/%d", up, down)
+	}
+
+	c.ApplyBandwidthSchedule(at.Add(7 * time.Hour))
+	if up, down := c.ActiveBandwidthLimits(); up != 1000 || down != 2000 {
+		t.Fatalf("expected base limits 1000/2000, got %d/%d", up, down)
+	}
+}
+
+func TestDownloadLimitThrottlesRequests(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	swarm.SetBandwidthLimit(0, uint64(config.TransferUnitSize))
+	newTestPeer(t, swarm, "seeder", bitfieldOf(4, 0, 1, 2, 3))
+
+	pm := swarm.TransferUnitManager
+	pm.scheduleDownloads()
+
+	pm.mu.RLock()
+	active, throttled := len(pm.activeRequests), pm.throttled
+	pm.mu.RUnlock()
+	if active != 1 || !throttled {
+		t.Fatalf("expected one request and the rest throttled, got %d active (throttled %v)", active, throttled)
+	}
+}
+
+func TestUploadLimitWaitStopsOnClose(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	swarm.SetBandwidthLimit(uint64(config.TransferUnitSize), 0)
+	ph, _ := newTestPeer(t, swarm, "leecher", NewBitfield(4))
+
+	if !ph.waitUploadBandwidth(config.TransferUnitSize) {
+		t.Fatalf("the first unit should pass at once")
+	}
+
+	close(ph.closed)
+	if ph.waitUploadBandwidth(config.TransferUnitSize) {
+		t.Fatalf("waiting for bandwidth should end when the peer closes")
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// newRejectTestSwarm has two peers advertising every unit, with more units
+// than the endgame threshold so each unit is requested from one peer only.
+func newRejectTestSwarm(t *testing.T) (*Swarm, map[protocol.NodeKey]<-chan protocol.PeerMessage) {
+	t.Helper()
+
+	units := uint64(config.EndgameMaxUnits + 4)
+	swarm := newTestSwarm(t, units)
+
+	peers := map[protocol.NodeKey]<-chan protocol.PeerMessage{}
+	for _, key := range []protocol.NodeKey{"a", "b"} {
+		all := NewBitfield(units)
+		for i := uint64(0); i < units; i++ {
+			all.Set(i)
+		}
+		_, msgs := newTestPeer(t, swarm, key, all)
+		peers[key] = msgs
+	}
+
+	swarm.TransferUnitManager.scheduleDownloads()
+	return swarm, peers
+}
+
+func primaryFor(pm *TransferUnitManager, index uint64) protocol.NodeKey {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	if req, ok := pm.activeRequests[index]; ok {
+		return req.From
+	}
+	return ""
+}
+
+func otherPeer(peer protocol.NodeKey) protocol.NodeKey {
+	if peer == "a" {
+		return "b"
+	}
+	return "a"
+}
+
+func TestRejectNotHaveReassignsUnit(t *testing.T) {
+	swarm, peers := newRejectTestSwarm(t)
+	pm := swarm.TransferUnitManager
+
+	rejecter := primaryFor(pm, 0)
+	if rejecter == "" {
+		t.Fatalf("unit 0 should have been requested")
+	}
+
+	pm.HandleReject(rejecter, 0, protocol.RejectNotHave)
+
+	if got := pm.Availability(0); got != 1 {
+		t.Fatalf("rejecting peer should no longer count for unit 0, availability %d", got)
+	}
+
+	other := otherPeer(rejecter)
+	if got := primaryFor(pm, 0); got != other {
+		t.Fatalf("unit 0 should be re-requested from %s at once, got %q", other, got)
+	}
+	expectUnits(t, other, peers[other], protocol.MsgRequest, 0)
+}
+
+func TestRejectOverloadedBacksOffPeer(t *testing.T) {
+	swarm, _ := newRejectTestSwarm(t)
+	pm := swarm.TransferUnitManager
+
+	rejecter := primaryFor(pm, 1)
+	pm.HandleReject(rejecter, 1, protocol.RejectOverloaded)
+
+	if got := pm.Availability(1); got != 2 {
+		t.Fatalf("an overloaded peer still has the unit, availability %d", got)
+	}
+	if got := primaryFor(pm, 1); got != otherPeer(rejecter) {
+		t.Fatalf("unit 1 should move to the other peer, got %q", got)
+	}
+
+	pm.mu.Lock()
+	backedOff := pm.backedOffLocked(rejecter, time.Now().Add(config.RejectBackoff/2))
+	pm.mu.Unlock()
+	if !backedOff {
+		t.Fatalf("overloaded peer should be backed off")
+	}
+}
+
+func TestSeederRejectsUnservableRequests(t *testing.T) {
+	swarm := newTestSwarm(t, 2)
+	ph, msgs := newTestPeer(t, swarm, "leecher", NewBitfield(2))
+
+	serializer := NewProtobufSerializer()
+	request := func(index uint64) protocol.PeerMessage {
+		payload, _ := serializer.MarshalTransferRequestPayload(&protocol.TransferRequestPayload{UnitIndex: index})
+		return protocol.PeerMessage{InfoHash: swarm.InfoHash, Type: protocol.MsgRequest, Payload: payload}
+	}
+	expectReject := func(index uint64, reason string) {
+		t.Helper()
+		msg := <-msgs
+		var reject protocol.RejectPayload
+		if msg.Type != protocol.MsgReject || serializer.UnmarshalRejectPayload(msg.Payload, &reject) != nil {
+			t.Fatalf("expected a reject, got %s", msg.Type)
+		}
+		if reject.UnitIndex != index || reject.Reason != reason {
+			t.Fatalf("expected reject %d/%s, got %d/%s", index, reason, reject.UnitIndex, reject.Reason)
+		}
+	}
+
+	ph.HandleMessage(request(0))
+	expectReject(0, protocol.RejectNotHave)
+
+	swarm.FileIO.haveUnits.Set(1)
+	ph.HandleMessage(request(1))
+	expectReject(1, protocol.RejectNoProof)
+
+	swarm.SetPaused(true)
+	ph.HandleMessage(request(1))
+	expectReject(1, protocol.RejectPaused)
+}
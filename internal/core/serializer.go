@@ -38,4 +38,34 @@ type Serializer interface {
 
 	// UnmarshalTransferPayload deserializes bytes into a TransferPayload
 	UnmarshalTransferPayload(data []byte, p *protocol.TransferPayload) error
+
+	// MarshalRejectPayload serializes a RejectPayload
+	MarshalRejectPayload(p *protocol.RejectPayload) ([]byte, error)
+
+	// UnmarshalRejectPayload deserializes bytes into a RejectPayload
+	UnmarshalRejectPayload(data []byte, p *protocol.RejectPayload) error
+
+	// MarshalCancelPayload serializes a CancelPayload
+	MarshalCancelPayload(p *protocol.CancelPayload) ([]byte, error)
+
+	// UnmarshalCancelPayload deserializes bytes into a CancelPayload
+	UnmarshalCancelPayload(data []byte, p *protocol.CancelPayload) error
+
+	// MarshalMetadataPayload serializes a MetadataPayload
+	MarshalMetadataPayload(p *protocol.MetadataPayload) ([]byte, error)
+
+	// UnmarshalMetadataPayload deserializes bytes into a MetadataPayload
+	UnmarshalMetadataPayload(data []byte, p *protocol.MetadataPayload) error
+
+	// MarshalPexPayload serializes a PexPayload
+	MarshalPexPayload(p *protocol.PexPayload) ([]byte, error)
+
+	// UnmarshalPexPayload deserializes bytes into a PexPayload
+	UnmarshalPexPayload(data []byte, p *protocol.PexPayload) error
+
+	// MarshalDHTPayload serializes a DHTPayload
+	MarshalDHTPayload(p *protocol.DHTPayload) ([]byte, error)
+
+	// UnmarshalDHTPayload deserializes bytes into a DHTPayload
+	UnmarshalDHTPayload(data []byte, p *protocol.DHTPayload) error
 }
@@ -10,17 +10,21 @@ import (
 	"sync"
 	"time"
 
-	"github.com/baoswarm/baobun/internal/config"
 	"github.com/baoswarm/baobun/pkg/protocol"
-	"github.com/nknorg/ncp-go"
-	nkn "github.com/nknorg/nkn-sdk-go"
 )
 
 type SessionManager struct {
-	client   *nkn.MultiClient
-	mu       sync.Mutex
-	sessions map[protocol.NodeKey]*Session
-	swarms   map[protocol.InfoHash]*Swarm
+	transport PeerTransport
+	mu        sync.Mutex
+	sessions  map[protocol.NodeKey]*Session
+	swarms    map[protocol.InfoHash]*Swarm
+	closed    bool
+
+	// Pending metadata requests, answered by MsgMetadata from that peer
+	metadataWaiters map[metadataKey]chan []byte
+
+	// Answers DHT traffic, nil if the node does not run the DHT
+	dht *DHT
 }
 
 type Session struct {
@@ -29,13 +33,40 @@ type Session struct {
 	refCount int
 	writeMu  sync.RWMutex
 	created  time.Time
+	// Set when peer is only what the remote end claimed to be
+	claimed bool
+}
+
+// Send writes one length-prefixed message to the session.
+func (sess *Session) Send(serializer Serializer, msg protocol.PeerMessage) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	data, err := serializer.MarshalPeerMessage(&msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	// 1. Write length prefix (uint32, big-endian)
+	if err := binary.Write(sess.conn, binary.BigEndian, uint32(len(data))); err != nil {
+		return fmt.Errorf("failed to write length: %w", err)
+	}
+
+	// 2. Write protobuf payload
+	if _, err := sess.conn.Write(data); err != nil {
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+
+	return nil
 }
 
-func NewSessionManager(client *nkn.MultiClient) *SessionManager {
+func NewSessionManager(transport PeerTransport) *SessionManager {
 	sm := &SessionManager{
-		client:   client,
-		sessions: make(map[protocol.NodeKey]*Session),
-		swarms:   make(map[protocol.InfoHash]*Swarm),
+		transport: transport,
+		sessions:  make(map[protocol.NodeKey]*Session),
+		swarms:    make(map[protocol.InfoHash]*Swarm),
+
+		metadataWaiters: make(map[metadataKey]chan []byte),
 	}
 
 	go sm.acceptLoop()
@@ -46,8 +77,12 @@ func (sm *SessionManager) acceptLoop() {
 	log.Println("Starting the accept loop")
 
 	for {
-		conn, err := sm.client.Accept()
+		conn, err := sm.transport.Accept()
 		if err != nil {
+			if sm.isClosed() {
+				log.Println("Accept loop stopped")
+				return
+			}
 			log.Printf("Accept error: %v", err)
 			continue
 		}
@@ -61,9 +96,18 @@ func (sm *SessionManager) acceptLoop() {
 			peer:     peer,
 			refCount: 1,
 			created:  time.Now(),
+			claimed:  identityClaimed(conn),
 		}
 
+		// Over TCP the peer's address is only its word, so it may not take
+		// over the session of a peer we already talk to.
 		sm.mu.Lock()
+		if _, taken := sm.sessions[peer]; taken && sess.claimed {
+			sm.mu.Unlock()
+			log.Printf("Refusing session claiming to be %s: that peer already has a session", peer)
+			conn.Close()
+			continue
+		}
 		sm.sessions[peer] = sess
 		sm.mu.Unlock()
 
@@ -91,17 +135,16 @@ func (sm *SessionManager) GetSession(peer protocol.NodeKey) (*Session, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	if sm.closed {
+		return nil, fmt.Errorf("session manager closed")
+	}
+
 	if s, ok := sm.sessions[peer]; ok {
 		s.refCount++
 		return s, nil
 	}
 
-	conn, err := sm.client.DialWithConfig(string(peer), &nkn.DialConfig{
-		DialTimeout: config.DialTimeoutMs,
-		SessionConfig: &ncp.Config{
-			MTU: config.MTU,
-		},
-	})
+	conn, err := sm.transport.Dial(peer)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +170,7 @@ func (sm *SessionManager) readLoop(sess *Session) {
 		var length uint32
 		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
 			log.Printf("Read length error from %s: %v", sess.peer, err)
-			sm.Release(sess.peer)
+			sm.endSession(sess)
 			return
 		}
 
@@ -135,7 +178,7 @@ func (sm *SessionManager) readLoop(sess *Session) {
 		buf := make([]byte, length)
 		if _, err := io.ReadFull(reader, buf); err != nil {
 			log.Printf("Read body error from %s: %v", sess.peer, err)
-			sm.Release(sess.peer)
+			sm.endSession(sess)
 			return
 		}
 
@@ -143,7 +186,7 @@ func (sm *SessionManager) readLoop(sess *Session) {
 		var msg protocol.PeerMessage
 		if err := serializer.UnmarshalPeerMessage(buf, &msg); err != nil {
 			log.Printf("Unmarshal error from %s: %v", sess.peer, err)
-			sm.Release(sess.peer)
+			sm.endSession(sess)
 			return
 		}
 
@@ -153,7 +196,31 @@ func (sm *SessionManager) readLoop(sess *Session) {
 			continue
 		}
 
-		// 5. Find swarm
+		// 5. Metadata exchange and the DHT need no swarm
+		switch msg.Type {
+		case protocol.MsgMetadataRequest:
+			go sm.handleMetadataRequest(sess, msg.InfoHash, serializer)
+			continue
+		case protocol.MsgMetadata:
+			sm.handleMetadata(sess.peer, msg, serializer)
+			continue
+		case protocol.MsgDHTQuery, protocol.MsgDHTResponse:
+			sm.mu.Lock()
+			dht := sm.dht
+			sm.mu.Unlock()
+
+			if dht == nil {
+				continue
+			}
+			if msg.Type == protocol.MsgDHTQuery {
+				go dht.handleQuery(sess, msg)
+			} else {
+				dht.handleResponse(sess.peer, msg)
+			}
+			continue
+		}
+
+		// 6. Find swarm
 		sm.mu.Lock()
 		swarm, swarmExists := sm.swarms[msg.InfoHash]
 		sm.mu.Unlock()
@@ -163,7 +230,7 @@ func (sm *SessionManager) readLoop(sess *Session) {
 			continue
 		}
 
-		// 6. Find handler
+		// 7. Find handler
 		swarm.mu.RLock()
 		handler := swarm.Peers[sess.peer]
 		swarm.mu.RUnlock()
@@ -173,7 +240,12 @@ func (sm *SessionManager) readLoop(sess *Session) {
 			continue
 		}
 
+		// Closing the swarm waits for messages already being handled
+		if !swarm.acquire() {
+			continue
+		}
 		handler.HandleMessage(msg)
+		swarm.release()
 	}
 }
 
@@ -194,11 +266,22 @@ func (sm *SessionManager) handleHandshake(sess *Session, msg protocol.PeerMessag
 		log.Printf("Swarm %s not found for handshake from %s", hs.InfoHash, sess.peer)
 		return
 	}
+	if swarm.IsPaused() || swarm.ctx.Err() != nil {
+		log.Printf("Ignoring handshake from %s: swarm %s is paused, queued or closed", sess.peer, hs.InfoHash)
+		return
+	}
 
 	// Check if we already have a handler for this peer
 	swarm.mu.Lock()
 	handler, exists := swarm.Peers[sess.peer]
 
+	if exists && handler.Session != nil && handler.Session != sess && sess.claimed {
+		// A claimed identity must not rebind another session's handler
+		swarm.mu.Unlock()
+		log.Printf("Ignoring handshake from %s: the peer is already connected on another session", sess.peer)
+		return
+	}
+
 	if !exists {
 		// Create handler for incoming connection
 		handler = &PeerHandler{
@@ -210,6 +293,10 @@ func (sm *SessionManager) handleHandshake(sess *Session, msg protocol.PeerMessag
 			connected:          make(chan struct{}),
 			theirHandshakeSeen: true,
 			serializer:         NewProtobufSerializer(),
+			uploadSignal:       make(chan struct{}, 1),
+			closed:             make(chan struct{}),
+			amChoking:          true,
+			peerChoking:        true,
 		}
 		swarm.Peers[sess.peer] = handler
 	} else {
@@ -271,6 +358,10 @@ func (sm *SessionManager) ConnectPeer(
 	}
 	swarm.mu.RUnlock()
 
+	if swarm.ctx.Err() != nil {
+		return nil, fmt.Errorf("swarm %s is closed", swarm.InfoHash)
+	}
+
 	// Create new handler
 	handler, err := BaoHandler(sm, swarm, peerKey, true, NewProtobufSerializer())
 	if err != nil {
@@ -310,12 +401,73 @@ func (sm *SessionManager) Release(peer protocol.NodeKey) {
 	if s == nil {
 		return
 	}
+	sm.releaseLocked(s)
+}
 
+func (sm *SessionManager) releaseLocked(s *Session) {
 	s.refCount--
 	if s.refCount > 0 {
 		return
 	}
 
 	s.conn.Close()
-	delete(sm.sessions, peer)
+	delete(sm.sessions, s.peer)
+}
+
+// endSession is called once sess's read loop stops. The connection is gone,
+// so the session is forgotten and every handler bound to it is closed, which
+// disconnects the peer from those swarms. If the peer has since been given a
+// newer session, that session and its handlers are left alone.
+func (sm *SessionManager) endSession(sess *Session) {
+	sm.mu.Lock()
+	if sm.sessions[sess.peer] == sess {
+		delete(sm.sessions, sess.peer)
+	}
+	swarms := make([]*Swarm, 0, len(sm.swarms))
+	for _, swarm := range sm.swarms {
+		swarms = append(swarms, swarm)
+	}
+	sm.mu.Unlock()
+
+	sess.conn.Close()
+
+	for _, swarm := range swarms {
+		swarm.mu.RLock()
+		handler := swarm.Peers[sess.peer]
+		bound := handler != nil && handler.Session == sess
+		swarm.mu.RUnlock()
+
+		if bound {
+			handler.Close(nil)
+		}
+	}
+}
+
+func (sm *SessionManager) isClosed() bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.closed
+}
+
+// Close stops accepting sessions and closes every open session.
+func (sm *SessionManager) Close() error {
+	sm.mu.Lock()
+	if sm.closed {
+		sm.mu.Unlock()
+		return nil
+	}
+	sm.closed = true
+
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for peer, s := range sm.sessions {
+		sessions = append(sessions, s)
+		delete(sm.sessions, peer)
+	}
+	sm.mu.Unlock()
+
+	for _, s := range sessions {
+		s.conn.Close()
+	}
+
+	return sm.transport.Close()
 }
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+const stateFileVersion = 1
+
+// StateStore persists the client's swarm list across restarts: each swarm's
+// .bao, where its data lives, whether it is paused or queued, its queue
+// position and its transfer totals.
+type StateStore struct {
+	path string
+
+	// Serializes writers and remembers the last write to skip unchanged ones
+	mu   sync.Mutex
+	last []byte
+}
+
+// SwarmState is one swarm as recorded in the state file.
+type SwarmState struct {
+	File         *BaoFile
+	FileLocation string
+	Paused       bool
+	Queued       bool
+	Uploaded     uint64
+	Downloaded   uint64
+}
+
+type stateDiskFile struct {
+	Version int              `json:"version"`
+	Swarms  []swarmStateDisk `json:"swarms"` // In queue order
+}
+
+type swarmStateDisk struct {
+	InfoHash     string          `json:"info_hash"`
+	Bao          json.RawMessage `json:"bao"`
+	FileLocation string          `json:"file_location"`
+	Paused       bool            `json:"paused"`
+	Queued       bool            `json:"queued"`
+	Uploaded     uint64          `json:"uploaded"`
+	Downloaded   uint64          `json:"downloaded"`
+}
+
+func NewStateStore(path string) *StateStore {
+	return &StateStore{path: path}
+}
+
+// Path returns the location of the state file on disk.
+func (ss *StateStore) Path() string {
+	return ss.path
+}
+
+// Load reads the recorded swarms in queue order. A missing file yields none;
+// entries whose .bao no longer loads are skipped.
+func (ss *StateStore) Load() ([]SwarmState, error) {
+	data, err := os.ReadFile(ss.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %q: %w", ss.path, err)
+	}
+
+	var onDisk stateDiskFile
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		return nil, fmt.Errorf("failed to decode state file %q: %w", ss.path, err)
+	}
+	if onDisk.Version != stateFileVersion {
+		return nil, fmt.Errorf("unsupported state file version %d", onDisk.Version)
+	}
+
+	states := make([]SwarmState, 0, len(onDisk.Swarms))
+	for _, entry := range onDisk.Swarms {
+		file, err := LoadFromBytes(entry.Bao)
+		if err != nil {
+			log.Printf("Warning: skipping saved swarm %s: %v", entry.InfoHash, err)
+			continue
+		}
+		if hex.EncodeToString(file.InfoHash[:]) != entry.InfoHash {
+			log.Printf("Warning: skipping saved swarm %s: infohash mismatch", entry.InfoHash)
+			continue
+		}
+
+		states = append(states, SwarmState{
+			File:         file,
+			FileLocation: entry.FileLocation,
+			Paused:       entry.Paused,
+			Queued:       entry.Queued,
+			Uploaded:     entry.Uploaded,
+			Downloaded:   entry.Downloaded,
+		})
+	}
+	return states, nil
+}
+
+// Save atomically replaces the state file with states, unless they are the
+// same as last written.
+func (ss *StateStore) Save(states []SwarmState) error {
+	onDisk := stateDiskFile{
+		Version: stateFileVersion,
+		Swarms:  make([]swarmStateDisk, 0, len(states)),
+	}
+	for _, state := range states {
+		bao, err := json.Marshal(state.File)
+		if err != nil {
+			return fmt.Errorf("failed to encode bao %s: %w", state.File.Name, err)
+		}
+		onDisk.Swarms = append(onDisk.Swarms, swarmStateDisk{
+			InfoHash:     hex.EncodeToString(state.File.InfoHash[:]),
+			Bao:          bao,
+			FileLocation: state.FileLocation,
+			Paused:       state.Paused,
+			Queued:       state.Queued,
+			Uploaded:     state.Uploaded,
+			Downloaded:   state.Downloaded,
+		})
+	}
+
+	data, err := json.MarshalIndent(onDisk, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state file: %w", err)
+	}
+	data = append(data, '\n')
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if bytes.Equal(data, ss.last) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(ss.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := writeFileAtomic(ss.path, data, 0644); err != nil {
+		return err
+	}
+	ss.last = data
+	return nil
+}
+
+// RestoreState adds the swarms recorded in store in their saved queue order,
+// with their paused state and transfer totals, and from then on keeps store
+// up to date. It returns the restored swarms; the caller announces them.
+func (c *Client) RestoreState(store *StateStore) ([]protocol.InfoHash, error) {
+	states, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	restored := make([]protocol.InfoHash, 0, len(states))
+	for _, state := range states {
+		ih := protocol.InfoHash(state.File.InfoHash)
+		if state.Paused {
+			c.pauseMu.Lock()
+			c.paused[ih] = true
+			c.pauseMu.Unlock()
+		}
+
+		c.addSwarm(state.File, state.FileLocation)
+		if swarm, ok := c.Swarms.Get(ih); ok {
+			swarm.Uploaded.Store(state.Uploaded)
+			swarm.Downloaded.Store(state.Downloaded)
+		}
+		restored = append(restored, ih)
+	}
+
+	c.stateMu.Lock()
+	c.state = store
+	c.stateMu.Unlock()
+
+	c.SaveState()
+	return restored, nil
+}
+
+// SaveState writes the swarm list to the state store, if there is one. It
+// runs on every change to the list and periodically for the transfer totals.
+func (c *Client) SaveState() {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.state == nil {
+		return
+	}
+
+	c.queueMu.Lock()
+	order := append([]protocol.InfoHash(nil), c.queueOrder...)
+	queued := make(map[protocol.InfoHash]bool, len(c.queued))
+	for ih := range c.queued {
+		queued[ih] = true
+	}
+	c.queueMu.Unlock()
+
+	states := make([]SwarmState, 0, len(order))
+	for _, ih := range order {
+		swarm, ok := c.Swarms.Get(ih)
+		if !ok {
+			continue
+		}
+		states = append(states, SwarmState{
+			File:         swarm.File,
+			FileLocation: swarm.FileLocation,
+			Paused:       c.IsPaused(ih),
+			Queued:       queued[ih],
+			Uploaded:     swarm.Uploaded.Load(),
+			Downloaded:   swarm.Downloaded.Load(),
+		})
+	}
+
+	if err := c.state.Save(states); err != nil {
+		log.Printf("Warning: failed to save client state: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+)
+
+func TestStateStoreRestoresSwarms(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, ".baobun", "state.json")
+
+	c := newTestNode(t, pipetransport.NewNetwork(), tracker.NewDirectory(), "self", dir).client
+	if restored, err := c.RestoreState(NewStateStore(statePath)); err != nil || len(restored) != 0 {
+		t.Fatalf("expected an empty first run, got %v (%v)", restored, err)
+	}
+
+	fileA, _ := createSeedFile(t, dir, "a.bin", config.TransferUnitSize)
+	fileB, _ := createSeedFile(t, dir, "b.bin", 2*config.TransferUnitSize)
+	a, _ := c.ImportBaoFile(fileA, dir)
+	b, _ := c.ImportBaoFile(fileB, dir)
+
+	c.PauseSwarm(a)
+	if err := c.MoveInQueue(b, QueueTop); err != nil {
+		t.Fatal(err)
+	}
+	swarmOf(t, c, b).Uploaded.Store(1234)
+	swarmOf(t, c, b).Downloaded.Store(5678)
+	c.SaveState()
+
+	restarted := newTestNode(t, pipetransport.NewNetwork(), tracker.NewDirectory(), "self", dir).client
+	restored, err := restarted.RestoreState(NewStateStore(statePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 || restored[0] != b || restored[1] != a {
+		t.Fatalf("expected both swarms in queue order, got %v", restored)
+	}
+	if !restarted.IsPaused(a) || restarted.IsPaused(b) {
+		t.Fatalf("paused state was not restored")
+	}
+	if swarm := swarmOf(t, restarted, b); swarm.Uploaded.Load() != 1234 || swarm.Downloaded.Load() != 5678 {
+		t.Fatalf("expected totals 1234/5678, got %d/%d", swarm.Uploaded.Load(), swarm.Downloaded.Load())
+	}
+	if swarm := swarmOf(t, restarted, a); swarm.FileLocation != dir {
+		t.Fatalf("expected file location %s, got %s", dir, swarm.FileLocation)
+	}
+
+	// Removing a swarm is saved at once
+	restarted.RemoveSwarm(a)
+	states, err := NewStateStore(statePath).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].File.InfoHash != b {
+		t.Fatalf("expected only swarm b to remain saved, got %d swarms", len(states))
+	}
+}
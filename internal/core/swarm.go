@@ -1,9 +1,14 @@
 package core
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/baoswarm/baobun/internal/config"
 	"github.com/baoswarm/baobun/pkg/protocol"
@@ -16,8 +21,9 @@ type Swarm struct {
 
 	InfoHash protocol.InfoHash
 
-	Downloaded uint64
-	Uploaded   uint64
+	// Transfer totals, updated by peer handlers as units arrive and are sent
+	Downloaded atomic.Uint64
+	Uploaded   atomic.Uint64
 
 	Peers map[protocol.NodeKey]*PeerHandler // peerKey → handler
 
@@ -32,18 +38,71 @@ type Swarm struct {
 	ProofCache map[uint64]*protocol.Proof // peerKey → handler
 	ProofStore *ProofStore
 	proofMu    sync.RWMutex
+
+	// Persisted have/proven bitfields, used instead of rescanning on startup
+	AvailabilityStore *AvailabilityStore
+	availabilityMu    sync.Mutex
+	// Units completed since the store was last written
+	availabilityPending atomic.Uint64
 	//TODO: We should merge proofs upwards on the tree to mimimize memory footprint, and consider clearing this map when the full file is available since
 	//at that point we can just generate proofs on demand, but needs to be researched if its worth keeping proof or not..
+
+	// Closed and replaced whenever a unit becomes available, waking readers
+	// blocked in WaitForTransferUnit.
+	unitReady   chan struct{}
+	unitReadyMu sync.Mutex
+
+	// Set while the client has the swarm paused; requests are rejected.
+	paused atomic.Bool
+
+	// Peers learned through peer exchange, not yet dialed. Guarded by mu.
+	pexCandidates map[protocol.NodeKey]protocol.Peer
+
+	// Bandwidth caps for this swarm, and the client's shared by all swarms
+	uploadLimit   *RateLimiter
+	downloadLimit *RateLimiter
+	bandwidth     *clientBandwidth
+
+	// Called once the last unit is verified, e.g. to move the swarm from the
+	// download queue to the seeds
+	onComplete func()
+	completed  atomic.Bool
+
+	// Where lifecycle events go while the swarm is in a registry
+	events   func(SwarmEvent)
+	eventsMu sync.RWMutex
+
+	// Current optimistic unchoke and when it was picked, guarded by chokeMu
+	optimistic   protocol.NodeKey
+	optimisticAt time.Time
+	chokeMu      sync.Mutex
+
+	// Cancelled by Close. Every goroutine working for the swarm is counted
+	// in work and stops once ctx is done; closing is guarded by lifeMu.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	work      sync.WaitGroup
+	lifeMu    sync.Mutex
+	closing   bool
+	closeOnce sync.Once
+	closeErr  error
 }
 
 func NewSwarm(infoHash protocol.InfoHash, file *BaoFile, fileLocation string) *Swarm {
+	ctx, cancel := context.WithCancel(context.Background())
 	swarm := &Swarm{
-		File:         file,
-		InfoHash:     infoHash,
-		Peers:        make(map[protocol.NodeKey]*PeerHandler),
-		FileLocation: fileLocation,
-		ProofCache:   make(map[uint64]*protocol.Proof),
-		ProofStore:   NewProofStore(fileLocation, infoHash),
+		ctx:               ctx,
+		cancel:            cancel,
+		File:              file,
+		InfoHash:          infoHash,
+		Peers:             make(map[protocol.NodeKey]*PeerHandler),
+		FileLocation:      fileLocation,
+		ProofCache:        make(map[uint64]*protocol.Proof),
+		ProofStore:        NewProofStore(fileLocation, infoHash),
+		AvailabilityStore: NewAvailabilityStore(fileLocation, infoHash),
+		pexCandidates:     make(map[protocol.NodeKey]protocol.Peer),
+		uploadLimit:       NewRateLimiter(0),
+		downloadLimit:     NewRateLimiter(0),
 	}
 
 	// Initialize FileIO with cache
@@ -54,24 +113,8 @@ func NewSwarm(infoHash protocol.InfoHash, file *BaoFile, fileLocation string) *S
 		swarm.FileIO = fileIO
 	}
 
-	//TODO: rework the existing files check, only check if file changed, persist etc, for now we just check the whole thing on startup.
-	for i := uint64(0); i < fileIO.unitCount; i++ {
-		data, err := fileIO.ReadTransferUnit(i)
-		if err != nil {
-			log.Printf("Warning: failed to read transfer unit: %v", err)
-		}
-		hasData := false
-		for _, b := range data {
-			if b != 0 {
-				hasData = true
-				break
-			}
-		}
-		if hasData {
-			fileIO.haveUnits.Set(i)
-		}
-	}
-
+	// Proofs are loaded first: they are authoritative for what an incomplete
+	// file may advertise, and the fallback scan verifies against them.
 	loadedProofs, err := swarm.ProofStore.LoadAll()
 	if err != nil {
 		log.Printf("Warning: proof cache load had issues: %v", err)
@@ -85,25 +128,214 @@ func NewSwarm(infoHash protocol.InfoHash, file *BaoFile, fileLocation string) *S
 		log.Printf("Loaded %d proofs from disk cache", len(loadedProofs))
 	}
 
-	// for i := uint64(0); i < fileIO.unitCount; i++ {
-	// 	hasTransferUnit := swarm.FileIO.HasTransferUnit(i)
-	// 	if hasTransferUnit {
-	// 		log.Printf("We have transferUnit %d", i)
-	// 		swarm.Have.Set(i)
-	// 	}
-	// }
+	swarm.loadAvailability()
+	swarm.completed.Store(swarm.FileIO.IsComplete())
 
 	// Initialize transferUnit manager
 	swarm.TransferUnitManager = NewTransferUnitManager(swarm, fileIO.unitCount)
 
+	swarm.spawn(swarm.chokeLoop)
+	swarm.spawn(swarm.availabilityLoop)
+
 	return swarm
 }
 
+// loadAvailability restores the have bitfield from the availability store,
+// falling back to a verified scan of the data file when the store is missing,
+// invalid or repair mode is enabled. A store is not trusted for a data file
+// that was just created or truncated, since it describes data now gone.
+func (s *Swarm) loadAvailability() {
+	if config.RepairAvailabilityEnabled() {
+		log.Printf("Availability repair mode enabled, rescanning %s", s.File.Name)
+	} else if s.FileIO.created || s.FileIO.resized {
+		if !s.FileIO.created {
+			log.Printf("Data for %s was missing or resized, rescanning", s.File.Name)
+		}
+	} else {
+		snapshot, err := s.AvailabilityStore.Load(s.File)
+		if err == nil {
+			if err := s.FileIO.SetBitfield(snapshot.HaveUnits); err == nil {
+				if s.reconcileProvenUnits(snapshot.ProvenUnits) {
+					s.persistAvailability()
+				}
+				return
+			}
+		} else if !errors.Is(err, ErrAvailabilityMissing) {
+			log.Printf("Warning: availability store rejected, rescanning: %v", err)
+		}
+	}
+
+	s.scanAvailability()
+	s.persistAvailability()
+}
+
+// reconcileProvenUnits reports whether the persisted proven bitfield disagrees
+// with the proofs actually loaded from the proof store.
+func (s *Swarm) reconcileProvenUnits(persisted Bitfield) bool {
+	current := s.provenBitfield()
+	for i := uint64(0); i < s.FileIO.unitCount; i++ {
+		if persisted.Has(i) != current.Has(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanAvailability rebuilds the have bitfield from the data on disk. A file
+// whose root hash matches is complete; otherwise only units that verify
+// against a cached proof are kept, since anything else cannot be served.
+func (s *Swarm) scanAvailability() {
+	have := NewBitfield(s.FileIO.unitCount)
+
+	if s.FileIO.created {
+		// Freshly allocated file, nothing on disk yet.
+		_ = s.FileIO.SetBitfield(have)
+		return
+	}
+
+	expectedRoot, err := hex.DecodeString(s.File.RootHash)
+	if err == nil && len(expectedRoot) == protocol.HashSize {
+		root, err := ComputeMerkleRoot(s.FileIO, int64(s.File.Length))
+		if err != nil {
+			log.Printf("Warning: failed to hash %s during availability scan: %v", s.File.Name, err)
+		} else if hex.EncodeToString(root[:]) == s.File.RootHash {
+			for i := uint64(0); i < s.FileIO.unitCount; i++ {
+				have.Set(i)
+			}
+			_ = s.FileIO.SetBitfield(have)
+			log.Printf("Availability scan: %s is complete", s.File.Name)
+			return
+		}
+	}
+
+	verified := 0
+	for i := uint64(0); i < s.FileIO.unitCount; i++ {
+		proof := s.GetProof(i)
+		if proof == nil {
+			continue
+		}
+
+		data, err := s.FileIO.ReadTransferUnit(i)
+		if err != nil {
+			log.Printf("Warning: failed to read transfer unit %d: %v", i, err)
+			continue
+		}
+
+		if err := VerifyProof(data, proof, protocol.Hash(expectedRoot), int64(s.File.Length)); err != nil {
+			continue
+		}
+
+		have.Set(i)
+		verified++
+	}
+
+	_ = s.FileIO.SetBitfield(have)
+	log.Printf("Availability scan: verified %d/%d units of %s", verified, s.FileIO.unitCount, s.File.Name)
+}
+
+// provenBitfield returns a bitfield of all units with a cached proof.
+func (s *Swarm) provenBitfield() Bitfield {
+	proven := NewBitfield(s.FileIO.unitCount)
+
+	s.proofMu.RLock()
+	defer s.proofMu.RUnlock()
+
+	for idx := range s.ProofCache {
+		if idx < s.FileIO.unitCount {
+			proven.Set(idx)
+		}
+	}
+	return proven
+}
+
+// persistAvailability writes the current have/proven state to the
+// availability store. availabilityMu keeps snapshots and writes ordered.
+func (s *Swarm) persistAvailability() {
+	if s.AvailabilityStore == nil || s.FileIO == nil {
+		return
+	}
+
+	s.availabilityMu.Lock()
+	defer s.availabilityMu.Unlock()
+
+	if err := s.AvailabilityStore.Save(s.File, s.FileIO.GetBitfield(), s.provenBitfield()); err != nil {
+		s.reportError(fmt.Errorf("failed to persist availability for %s: %w", s.File.Name, err))
+	}
+}
+
+// flushAvailability persists the availability store if units completed
+// since it was last written.
+func (s *Swarm) flushAvailability() {
+	if s.availabilityPending.Swap(0) == 0 {
+		return
+	}
+	s.persistAvailability()
+}
+
+// availabilityLoop writes completed units to the availability store every
+// AvailabilityFlushInterval, so a crash loses at most that much progress.
+func (s *Swarm) availabilityLoop() {
+	ticker := time.NewTicker(config.AvailabilityFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flushAvailability()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// SetPaused stops or restarts the swarm's downloads; while paused, peers'
+// requests are rejected and nothing is requested from them.
+func (s *Swarm) SetPaused(paused bool) {
+	if s.paused.Swap(paused) == paused || s.TransferUnitManager == nil {
+		return
+	}
+	if paused {
+		s.TransferUnitManager.Pause()
+	} else {
+		s.TransferUnitManager.Resume()
+	}
+}
+
+func (s *Swarm) IsPaused() bool {
+	return s.paused.Load()
+}
+
+func (s *Swarm) setEventSink(sink func(SwarmEvent)) {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	s.events = sink
+}
+
+// emit publishes an event for the swarm, if it is in a registry.
+func (s *Swarm) emit(event SwarmEvent) {
+	s.eventsMu.RLock()
+	sink := s.events
+	s.eventsMu.RUnlock()
+
+	if sink != nil {
+		event.InfoHash = s.InfoHash
+		sink(event)
+	}
+}
+
+// reportError logs a failure the swarm cannot recover from by itself, such
+// as a disk write, and publishes it.
+func (s *Swarm) reportError(err error) {
+	log.Printf("Swarm %s: %v", s.InfoHash, err)
+	s.emit(SwarmEvent{Kind: SwarmError, Err: err})
+}
+
 func (s *Swarm) CalcLeft() uint64 {
 	var left uint64
 
+	have := s.FileIO.GetBitfield()
 	for i := uint64(0); i < s.FileIO.unitCount; i++ {
-		if s.FileIO.haveUnits.Has(i) {
+		if have.Has(i) {
 			continue
 		}
 
@@ -124,6 +356,35 @@ func (s *Swarm) CalcLeft() uint64 {
 	return left
 }
 
+// CalcLeftRange returns how many bytes of [start, start+length) of the
+// content are still missing, e.g. for one file of a directory bao.
+func (s *Swarm) CalcLeftRange(start, length uint64) uint64 {
+	if length == 0 {
+		return 0
+	}
+
+	end := start + length
+	unitSize := uint64(config.TransferUnitSize)
+
+	var left uint64
+	for i := start / unitSize; i*unitSize < end && i < s.FileIO.unitCount; i++ {
+		if s.FileIO.HasTransferUnit(i) {
+			continue
+		}
+
+		unitStart, unitEnd := i*unitSize, (i+1)*unitSize
+		if unitStart < start {
+			unitStart = start
+		}
+		if unitEnd > end {
+			unitEnd = end
+		}
+		left += unitEnd - unitStart
+	}
+
+	return left
+}
+
 // Add methods to update peer bitfield information
 func (s *Swarm) UpdatePeerBitfield(peer protocol.NodeKey, bitfield Bitfield) {
 	s.mu.RLock()
@@ -134,19 +395,37 @@ func (s *Swarm) UpdatePeerBitfield(peer protocol.NodeKey, bitfield Bitfield) {
 		return
 	}
 
-	handler.Bitfield = bitfield
+	handler.setPeerBitfield(bitfield.Clone())
 }
 
 // Mark a transferUnit as downloaded
 func (s *Swarm) MarkTransferUnitComplete(transferUnitIndex uint64, data []byte) {
-	s.FileIO.haveUnits.Set(transferUnitIndex)
-	s.Downloaded += uint64(len(data))
+	s.FileIO.markHave(transferUnitIndex)
+	s.Downloaded.Add(uint64(len(data)))
 
 	// Notify transferUnit manager
 	s.TransferUnitManager.MarkTransferUnitComplete(transferUnitIndex)
 
+	if s.availabilityPending.Add(1) >= config.AvailabilityFlushUnits {
+		s.flushAvailability()
+	}
+	s.notifyUnitReady()
+
 	// Send HAVE messages to all connected peers
 	s.BroadcastHave(transferUnitIndex)
+	s.emit(SwarmEvent{Kind: SwarmUnitCompleted, Unit: transferUnitIndex})
+
+	// Nobody has anything left for us
+	if s.FileIO.IsComplete() && !s.completed.Swap(true) {
+		s.flushAvailability()
+		for _, handler := range s.connectedHandlers() {
+			s.spawn(func() { handler.setInterested(false) })
+		}
+		if s.onComplete != nil {
+			s.spawn(s.onComplete)
+		}
+		s.emit(SwarmEvent{Kind: SwarmCompleted})
+	}
 
 	//log.Println(s.FileIO.haveUnits.ToString(s.File.GetTransferUnitCount()))
 }
@@ -162,7 +441,7 @@ func (s *Swarm) BroadcastHave(transferUnitIndex uint64) {
 
 	for _, peer := range s.Peers {
 		if peer.GetState() == protocol.StateConnected {
-			go peer.SendHave(transferUnitIndex)
+			s.spawn(func() { peer.SendHave(transferUnitIndex) })
 		}
 	}
 }
@@ -187,6 +466,10 @@ func (s *Swarm) SaveProof(transferUnitIndex uint64, proof *protocol.Proof) error
 		return fmt.Errorf("cannot save nil proof")
 	}
 
+	if err := s.ctx.Err(); err != nil {
+		return fmt.Errorf("swarm closed: %w", err)
+	}
+
 	cloned := cloneProof(proof)
 
 	s.proofMu.Lock()
@@ -199,11 +482,16 @@ func (s *Swarm) SaveProof(transferUnitIndex uint64, proof *protocol.Proof) error
 		}
 	}
 
+	// While downloading, MarkTransferUnitComplete follows and persists both bits.
+	if s.FileIO.IsComplete() {
+		s.persistAvailability()
+	}
+
 	return nil
 }
 
 func (s *Swarm) CanServeTransferUnit(transferUnitIndex uint64) bool {
-	if !s.FileIO.haveUnits.Has(transferUnitIndex) {
+	if !s.FileIO.HasTransferUnit(transferUnitIndex) {
 		return false
 	}
 
@@ -215,13 +503,14 @@ func (s *Swarm) CanServeTransferUnit(transferUnitIndex uint64) bool {
 }
 
 func (s *Swarm) UploadBitfieldBytes() []byte {
-	if s.FileIO.IsComplete() {
-		return s.FileIO.haveUnits.Bytes()
+	have := s.FileIO.GetBitfield()
+	if have.AllSet(s.FileIO.unitCount) {
+		return have.Bytes()
 	}
 
 	out := NewBitfield(s.FileIO.unitCount)
 	for i := uint64(0); i < s.FileIO.unitCount; i++ {
-		if !s.FileIO.haveUnits.Has(i) {
+		if !have.Has(i) {
 			continue
 		}
 		if !s.HasProof(i) {
@@ -235,22 +524,83 @@ func (s *Swarm) UploadBitfieldBytes() []byte {
 
 func (s *Swarm) MarkAllUnitsAvailable() {
 	for i := uint64(0); i < s.FileIO.unitCount; i++ {
-		s.FileIO.haveUnits.Set(i)
-		if s.TransferUnitManager != nil && i < uint64(len(s.TransferUnitManager.transferUnits)) {
-			s.TransferUnitManager.transferUnits[i].State = TransferUnitStateComplete
+		s.FileIO.markHave(i)
+	}
+	if s.TransferUnitManager != nil {
+		s.TransferUnitManager.markAllComplete()
+	}
+
+	s.persistAvailability()
+	s.notifyUnitReady()
+
+	if !s.completed.Swap(true) {
+		s.emit(SwarmEvent{Kind: SwarmCompleted})
+	}
+}
+
+// WaitForTransferUnit blocks until the unit is verified and on disk, or ctx
+// is done.
+func (s *Swarm) WaitForTransferUnit(ctx context.Context, index uint64) error {
+	if index >= s.FileIO.unitCount {
+		return fmt.Errorf("transfer unit %d out of range", index)
+	}
+
+	for {
+		ready := s.unitReadyChan()
+		if s.FileIO.HasTransferUnit(index) {
+			return nil
+		}
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.ctx.Done():
+			return fmt.Errorf("swarm closed: %w", s.ctx.Err())
 		}
 	}
 }
 
-func (s *Swarm) DisconnectAll(sm *SessionManager) {
+func (s *Swarm) unitReadyChan() chan struct{} {
+	s.unitReadyMu.Lock()
+	defer s.unitReadyMu.Unlock()
+
+	if s.unitReady == nil {
+		s.unitReady = make(chan struct{})
+	}
+	return s.unitReady
+}
+
+func (s *Swarm) notifyUnitReady() {
+	s.unitReadyMu.Lock()
+	defer s.unitReadyMu.Unlock()
+
+	if s.unitReady != nil {
+		close(s.unitReady)
+		s.unitReady = nil
+	}
+}
+
+// Handlers returns a snapshot of the swarm's peer handlers, in any state.
+func (s *Swarm) Handlers() []*PeerHandler {
 	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	handlers := make([]*PeerHandler, 0, len(s.Peers))
 	for _, peer := range s.Peers {
 		handlers = append(handlers, peer)
 	}
-	s.mu.RUnlock()
+	return handlers
+}
+
+func (s *Swarm) PeerCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.Peers)
+}
 
-	for _, handler := range handlers {
+func (s *Swarm) DisconnectAll(sm *SessionManager) {
+	for _, handler := range s.Handlers() {
 		handler.Close(sm)
 	}
 }
@@ -264,11 +614,57 @@ func (s *Swarm) DisconnectAll(sm *SessionManager) {
 // 	return NewFileIO(s.File)
 // }
 
-// Don't forget to close FileIO when swarm is done
-func (s *Swarm) Close() error {
-	//TODO: make sure this is called when we are done with a swarm.
-	if s.FileIO != nil {
-		return s.FileIO.Close()
+// Context is cancelled once the swarm is closing.
+func (s *Swarm) Context() context.Context {
+	return s.ctx
+}
+
+// acquire counts work that Close must wait for, unless the swarm is already
+// closing. Each successful acquire is paired with a release.
+func (s *Swarm) acquire() bool {
+	s.lifeMu.Lock()
+	defer s.lifeMu.Unlock()
+
+	if s.closing {
+		return false
 	}
-	return nil
+	s.work.Add(1)
+	return true
+}
+
+func (s *Swarm) release() {
+	s.work.Done()
+}
+
+// spawn runs fn on a goroutine that Close waits for. Nothing is started once
+// the swarm is closing.
+func (s *Swarm) spawn(fn func()) bool {
+	if !s.acquire() {
+		return false
+	}
+	go func() {
+		defer s.release()
+		fn()
+	}()
+	return true
+}
+
+// Close cancels the swarm's context, which stops its transfer unit manager,
+// outstanding requests, choking and uploads, waits for all of its work to
+// drain, writes pending availability and then closes its files. The caller disconnects its peers first.
+func (s *Swarm) Close() error {
+	s.closeOnce.Do(func() {
+		s.lifeMu.Lock()
+		s.closing = true
+		s.lifeMu.Unlock()
+
+		s.cancel()
+		s.work.Wait()
+
+		if s.FileIO != nil {
+			s.flushAvailability()
+			s.closeErr = s.FileIO.Close()
+		}
+	})
+	return s.closeErr
 }
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"sort"
+	"time"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// SwarmDetail is a snapshot of a swarm's units, outstanding requests and
+// peers, for finding out why a download is stuck.
+type SwarmDetail struct {
+	UnitCount uint64
+
+	Have       Bitfield // Units on disk and verified
+	Advertised Bitfield // Units peers are told we have, see UploadBitfieldBytes
+	Proven     Bitfield // Units with a cached proof
+
+	// Connected peers advertising each unit
+	Availability []uint32
+
+	Requests []RequestDetail
+	Peers    []PeerDetail
+}
+
+// RequestDetail is one request waiting for a unit.
+type RequestDetail struct {
+	Unit     uint64
+	Peer     protocol.NodeKey
+	SentAt   time.Time
+	Attempts int
+	// An endgame copy of a request already sent to another peer
+	Duplicate bool
+}
+
+// PeerDetail is one peer's share of the swarm.
+type PeerDetail struct {
+	Peer  protocol.NodeKey
+	State protocol.ConnectionState
+
+	// Bytes sent to and received from the peer
+	Uploaded   uint64
+	Downloaded uint64
+
+	// Units the peer advertises, and our requests it has yet to answer
+	Units       uint64
+	Outstanding int
+
+	// When the connection to the peer was opened, zero if unknown
+	ConnectedAt time.Time
+}
+
+// Detail returns a snapshot of the swarm. Requests are ordered by unit, and
+// peers by key.
+func (s *Swarm) Detail() SwarmDetail {
+	detail := SwarmDetail{
+		UnitCount:  s.FileIO.unitCount,
+		Have:       s.FileIO.GetBitfield(),
+		Advertised: BitfieldFromBytes(s.UploadBitfieldBytes()),
+		Proven:     s.provenBitfield(),
+	}
+
+	var outstanding map[protocol.NodeKey]int
+	detail.Availability, detail.Requests, outstanding = s.TransferUnitManager.requestDetail()
+
+	for _, ph := range s.Handlers() {
+		peer := PeerDetail{
+			Peer:        ph.Peer,
+			State:       ph.GetState(),
+			Units:       ph.PeerBitfield().Count(),
+			Outstanding: outstanding[ph.Peer],
+		}
+		peer.Uploaded, peer.Downloaded = ph.totals()
+		if ph.Session != nil {
+			peer.ConnectedAt = ph.Session.created
+		}
+		detail.Peers = append(detail.Peers, peer)
+	}
+	sort.Slice(detail.Peers, func(i, j int) bool {
+		return detail.Peers[i].Peer < detail.Peers[j].Peer
+	})
+
+	return detail
+}
+
+// requestDetail returns a copy of the availability counts, the outstanding
+// requests including endgame duplicates, and how many each peer holds.
+func (pm *TransferUnitManager) requestDetail() ([]uint32, []RequestDetail, map[protocol.NodeKey]int) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	availability := append([]uint32(nil), pm.availability...)
+
+	requests := make([]RequestDetail, 0, len(pm.activeRequests))
+	for index, req := range pm.activeRequests {
+		requests = append(requests, RequestDetail{
+			Unit:     index,
+			Peer:     req.From,
+			SentAt:   req.SentAt,
+			Attempts: req.Attempts,
+		})
+		for peer, sentAt := range pm.duplicates[index] {
+			requests = append(requests, RequestDetail{
+				Unit:      index,
+				Peer:      peer,
+				SentAt:    sentAt,
+				Attempts:  1,
+				Duplicate: true,
+			})
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].Unit != requests[j].Unit {
+			return requests[i].Unit < requests[j].Unit
+		}
+		return !requests[i].Duplicate && requests[j].Duplicate
+	})
+
+	outstanding := make(map[protocol.NodeKey]int, len(pm.peerRequests))
+	for peer, units := range pm.peerRequests {
+		outstanding[peer] = len(units)
+	}
+
+	return availability, requests, outstanding
+}
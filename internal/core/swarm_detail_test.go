@@ -0,0 +1,59 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func TestSwarmDetail(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	pm := swarm.TransferUnitManager
+
+	swarm.FileIO.markHave(0)
+	swarm.FileIO.markHave(1)
+	if err := swarm.SaveProof(0, &protocol.Proof{}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := newTestPeer(t, swarm, "a", bitfieldOf(4, 1, 2))
+	newTestPeer(t, swarm, "b", bitfieldOf(4, 2, 3))
+	a.recordUpload(100)
+
+	pm.mu.Lock()
+	pm.sendTransferUnitRequest(2, "a")
+	pm.sendDuplicateRequestLocked(2, "b")
+	pm.mu.Unlock()
+
+	detail := swarm.Detail()
+
+	if detail.UnitCount != 4 || detail.Have.Count() != 2 || detail.Proven.Count() != 1 {
+		t.Fatalf("expected 2 of 4 units and 1 proof, got %d of %d and %d", detail.Have.Count(), detail.UnitCount, detail.Proven.Count())
+	}
+	// Unit 1 has no proof yet, so it is not advertised
+	if !detail.Advertised.Has(0) || detail.Advertised.Has(1) {
+		t.Fatalf("expected only unit 0 to be advertised")
+	}
+	if !reflect.DeepEqual(detail.Availability, []uint32{0, 1, 2, 1}) {
+		t.Fatalf("unexpected availability %v", detail.Availability)
+	}
+
+	if len(detail.Requests) != 2 {
+		t.Fatalf("expected a request and its duplicate, got %+v", detail.Requests)
+	}
+	if req := detail.Requests[0]; req.Unit != 2 || req.Peer != "a" || req.Duplicate || req.SentAt.IsZero() {
+		t.Fatalf("unexpected primary request %+v", req)
+	}
+	if req := detail.Requests[1]; req.Unit != 2 || req.Peer != "b" || !req.Duplicate {
+		t.Fatalf("unexpected duplicate request %+v", req)
+	}
+
+	if len(detail.Peers) != 2 || detail.Peers[0].Peer != "a" || detail.Peers[1].Peer != "b" {
+		t.Fatalf("expected peers a and b, got %+v", detail.Peers)
+	}
+	peer := detail.Peers[0]
+	if peer.Units != 2 || peer.Outstanding != 1 || peer.Uploaded != 100 || peer.ConnectedAt.IsZero() {
+		t.Fatalf("unexpected peer detail %+v", peer)
+	}
+}
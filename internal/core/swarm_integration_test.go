@@ -0,0 +1,199 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// testNode is a Client wired to an in-process pipe transport and tracker.
+type testNode struct {
+	client *Client
+	dir    string
+}
+
+func newTestNode(t *testing.T, network *pipetransport.Network, directory *tracker.Directory, name string, dir string) *testNode {
+	t.Helper()
+
+	pt, err := network.Listen(protocol.NodeKey(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := NewSessionManager(pt)
+	t.Cleanup(func() { sessions.Close() })
+
+	client := NewClient(name, tracker.NewLocalTransport(protocol.NodeKey(name), directory), sessions)
+	return &testNode{client: client, dir: dir}
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return cond()
+}
+
+// swarmOf returns the client's swarm for ih, failing the test without one.
+func swarmOf(t *testing.T, c *Client, ih protocol.InfoHash) *Swarm {
+	t.Helper()
+
+	swarm, ok := c.Swarms.Get(ih)
+	if !ok {
+		t.Fatalf("swarm %s not found", ih)
+	}
+	return swarm
+}
+
+// createSeedFile writes random data to dir/name and returns its BaoFile.
+func createSeedFile(t *testing.T, dir string, name string, size int) (*BaoFile, []byte) {
+	t.Helper()
+
+	data := make([]byte, size)
+	rand.New(rand.NewSource(42)).Read(data)
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := CreateFromFile(path, []string{"bao.tracker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, data
+}
+
+func TestSwarmTransferOverPipeTransport(t *testing.T) {
+	root, err := os.MkdirTemp("", "swarm-pipe-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	network := pipetransport.NewNetwork()
+	directory := tracker.NewDirectory()
+	directory.Register("bao.tracker", tracker.New(tracker.Config{}))
+
+	seedDir := filepath.Join(root, "seed")
+	leechDir := filepath.Join(root, "leech")
+	if err := os.MkdirAll(seedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	file, data := createSeedFile(t, seedDir, "payload.bin", config.TransferUnitSize*5+1234)
+
+	seeder := newTestNode(t, network, directory, "seeder", seedDir)
+	leecher := newTestNode(t, network, directory, "leecher", leechDir)
+
+	ih, err := seeder.client.ImportBaoFile(file, seedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !swarmOf(t, seeder.client, ih).FileIO.IsComplete() {
+		t.Fatalf("seeder should detect its complete file")
+	}
+	seeder.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	events, cancel := leecher.client.Swarms.Subscribe(256)
+	defer cancel()
+
+	leechFile := *file
+	if _, err := leecher.client.ImportBaoFile(&leechFile, leechDir); err != nil {
+		t.Fatal(err)
+	}
+	leecher.client.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+
+	swarm := swarmOf(t, leecher.client, ih)
+	if !waitFor(t, 15*time.Second, swarm.FileIO.IsComplete) {
+		t.Fatalf("leecher did not complete: %d/%d units", swarm.FileIO.GetBitfield().Count(), swarm.FileIO.unitCount)
+	}
+
+	got, err := swarm.FileIO.ReadRange(0, file.Length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("downloaded data does not match the seeded file")
+	}
+
+	// The download is reported as it happens
+	seen := make(map[SwarmEventKind]int)
+	waitFor(t, time.Second, func() bool {
+		for {
+			select {
+			case event := <-events:
+				seen[event.Kind]++
+			default:
+				return seen[SwarmCompleted] > 0
+			}
+		}
+	})
+	if seen[SwarmAdded] != 1 || seen[SwarmAnnounced] == 0 || seen[SwarmPeerConnected] == 0 ||
+		seen[SwarmUnitCompleted] != int(swarm.FileIO.unitCount) || seen[SwarmCompleted] != 1 {
+		t.Fatalf("unexpected events for the download: %v", seen)
+	}
+}
+
+func TestClientCloseAnnouncesStopped(t *testing.T) {
+	dir := t.TempDir()
+	directory := tracker.NewDirectory()
+	trk := tracker.New(tracker.Config{})
+	directory.Register("bao.tracker", trk)
+
+	c := newTestNode(t, pipetransport.NewNetwork(), directory, "self", dir).client
+	file, _ := createSeedFile(t, dir, "closing.bin", config.TransferUnitSize)
+	ih, err := c.ImportBaoFile(file, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AnnounceSwarm(context.Background(), ih, protocol.EventStarted)
+	if len(trk.Peers(ih)) != 1 {
+		t.Fatalf("expected the swarm to be announced")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Close(ctx)
+
+	if peers := trk.Peers(ih); len(peers) != 0 {
+		t.Fatalf("expected closing to announce stopped, tracker still lists %v", peers)
+	}
+}
+
+func TestRemoveSwarmStopsItsGoroutines(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestNode(t, pipetransport.NewNetwork(), tracker.NewDirectory(), "self", dir).client
+	before := runtime.NumGoroutine()
+
+	file, _ := createSeedFile(t, dir, "removed.bin", 4*config.TransferUnitSize)
+	ih, err := c.ImportBaoFile(file, filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swarm := swarmOf(t, c, ih)
+
+	c.RemoveSwarm(ih)
+	if swarm.Context().Err() == nil {
+		t.Fatalf("removing a swarm should cancel its context")
+	}
+	if !waitFor(t, time.Second, func() bool { return runtime.NumGoroutine() <= before }) {
+		t.Fatalf("removed swarm left goroutines running: %d before, %d after", before, runtime.NumGoroutine())
+	}
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// SwarmEventKind names a change in a swarm's lifecycle.
+type SwarmEventKind string
+
+const (
+	SwarmAdded     SwarmEventKind = "added"
+	SwarmRemoved   SwarmEventKind = "removed"
+	SwarmPaused    SwarmEventKind = "paused"
+	SwarmResumed   SwarmEventKind = "resumed"
+	SwarmCompleted SwarmEventKind = "completed"
+	SwarmError     SwarmEventKind = "error"
+
+	// Held back by, or started from, the download queue
+	SwarmQueued  SwarmEventKind = "queued"
+	SwarmStarted SwarmEventKind = "started"
+
+	SwarmPeerConnected    SwarmEventKind = "peer_connected"
+	SwarmPeerDisconnected SwarmEventKind = "peer_disconnected"
+	SwarmUnitCompleted    SwarmEventKind = "unit_completed"
+	SwarmAnnounced        SwarmEventKind = "announced"
+)
+
+// SwarmEvent is published by the SwarmRegistry to its subscribers. Fields
+// beyond Kind, InfoHash and Time are only set for the kinds noted.
+type SwarmEvent struct {
+	Kind     SwarmEventKind
+	InfoHash protocol.InfoHash
+	Time     time.Time
+
+	Peer    protocol.NodeKey // Peer events
+	Unit    uint64           // SwarmUnitCompleted
+	Tracker string           // SwarmAnnounced: the tracker or discovery source
+	Peers   int              // SwarmAnnounced: how many peers it returned
+	Err     error            // SwarmError, and a failed SwarmAnnounced
+}
+
+// SwarmRegistry holds the client's swarms by infohash. It is safe for
+// concurrent use, and publishes lifecycle events to its subscribers.
+type SwarmRegistry struct {
+	mu     sync.RWMutex
+	swarms map[protocol.InfoHash]*Swarm
+
+	subsMu sync.Mutex
+	subs   map[chan SwarmEvent]struct{}
+}
+
+func NewSwarmRegistry() *SwarmRegistry {
+	return &SwarmRegistry{
+		swarms: make(map[protocol.InfoHash]*Swarm),
+		subs:   make(map[chan SwarmEvent]struct{}),
+	}
+}
+
+// Get returns the swarm for ih.
+func (r *SwarmRegistry) Get(ih protocol.InfoHash) (*Swarm, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	swarm, ok := r.swarms[ih]
+	return swarm, ok
+}
+
+// Add registers swarm, unless one with its infohash is already registered.
+// It reports whether swarm was added.
+func (r *SwarmRegistry) Add(swarm *Swarm) bool {
+	r.mu.Lock()
+	if _, ok := r.swarms[swarm.InfoHash]; ok {
+		r.mu.Unlock()
+		return false
+	}
+	r.swarms[swarm.InfoHash] = swarm
+	r.mu.Unlock()
+
+	swarm.setEventSink(r.publish)
+	r.publish(SwarmEvent{Kind: SwarmAdded, InfoHash: swarm.InfoHash})
+	return true
+}
+
+// Remove unregisters the swarm for ih and returns it.
+func (r *SwarmRegistry) Remove(ih protocol.InfoHash) (*Swarm, bool) {
+	r.mu.Lock()
+	swarm, ok := r.swarms[ih]
+	delete(r.swarms, ih)
+	r.mu.Unlock()
+
+	if ok {
+		swarm.setEventSink(nil)
+		r.publish(SwarmEvent{Kind: SwarmRemoved, InfoHash: ih})
+	}
+	return swarm, ok
+}
+
+// All returns a snapshot of the registered swarms, in no particular order.
+func (r *SwarmRegistry) All() []*Swarm {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	swarms := make([]*Swarm, 0, len(r.swarms))
+	for _, swarm := range r.swarms {
+		swarms = append(swarms, swarm)
+	}
+	return swarms
+}
+
+func (r *SwarmRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.swarms)
+}
+
+// Subscribe returns a channel that receives every event from now on, and a
+// function that ends the subscription and closes the channel. A subscriber
+// whose buffer is full misses events rather than holding up the swarms.
+func (r *SwarmRegistry) Subscribe(buffer int) (<-chan SwarmEvent, func()) {
+	ch := make(chan SwarmEvent, buffer)
+
+	r.subsMu.Lock()
+	r.subs[ch] = struct{}{}
+	r.subsMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			r.subsMu.Lock()
+			delete(r.subs, ch)
+			close(ch)
+			r.subsMu.Unlock()
+		})
+	}
+}
+
+func (r *SwarmRegistry) publish(event SwarmEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	for ch := range r.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
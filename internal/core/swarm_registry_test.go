@@ -0,0 +1,234 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/internal/tracker"
+	pipetransport "github.com/baoswarm/baobun/internal/transport/pipe"
+	tcptransport "github.com/baoswarm/baobun/internal/transport/tcp"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// expectEvent waits for the next event other than tracker results, which
+// arrive whenever the background announces finish.
+func expectEvent(t *testing.T, events <-chan SwarmEvent, kind SwarmEventKind) SwarmEvent {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Kind == SwarmAnnounced {
+				continue
+			}
+			if event.Kind != kind {
+				t.Fatalf("expected a %s event, got %s", kind, event.Kind)
+			}
+			return event
+		case <-timeout:
+			t.Fatalf("no %s event", kind)
+		}
+	}
+}
+
+func TestSwarmRegistryPublishesLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestNode(t, pipetransport.NewNetwork(), tracker.NewDirectory(), "self", dir).client
+
+	events, cancel := c.Swarms.Subscribe(16)
+	defer cancel()
+
+	// Imported into an empty directory, so the data still has to arrive
+	file, _ := createSeedFile(t, dir, "events.bin", 2*config.TransferUnitSize)
+	ih, err := c.ImportBaoFile(file, filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := expectEvent(t, events, SwarmAdded); event.InfoHash != ih {
+		t.Fatalf("added event for the wrong swarm")
+	}
+
+	c.PauseSwarm(ih)
+	expectEvent(t, events, SwarmPaused)
+	c.ResumeSwarm(ih)
+	expectEvent(t, events, SwarmResumed)
+
+	swarm := swarmOf(t, c, ih)
+	swarm.MarkAllUnitsAvailable()
+	expectEvent(t, events, SwarmCompleted)
+
+	swarm.reportError(fmt.Errorf("disk full"))
+	if event := expectEvent(t, events, SwarmError); event.Err == nil {
+		t.Fatalf("expected the error on the event")
+	}
+
+	c.RemoveSwarm(ih)
+	expectEvent(t, events, SwarmRemoved)
+
+	// A removed swarm no longer reports through the registry
+	swarm.reportError(fmt.Errorf("late"))
+	cancel()
+	for event := range events {
+		if event.Kind != SwarmAnnounced {
+			t.Fatalf("expected no events after removal, got %s", event.Kind)
+		}
+	}
+}
+
+func TestSessionEndDisconnectsPeers(t *testing.T) {
+	dir := t.TempDir()
+	network := pipetransport.NewNetwork()
+	c := newTestNode(t, network, tracker.NewDirectory(), "self", dir).client
+
+	file, _ := createSeedFile(t, dir, "drop.bin", config.TransferUnitSize)
+	ih, err := c.ImportBaoFile(file, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel := c.Swarms.Subscribe(16)
+	defer cancel()
+
+	// A bare remote end that handshakes and then goes away
+	remote, err := network.Listen("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	conn, err := remote.Dial("self")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serializer := NewProtobufSerializer()
+	payload, err := serializer.MarshalHandshakePayload(&protocol.HandshakePayload{InfoHash: ih, PeerID: "self"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := &Session{conn: conn, peer: "self"}
+	if err := sess.Send(serializer, protocol.PeerMessage{InfoHash: ih, Type: protocol.MsgHandshake, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	if event := expectEvent(t, events, SwarmPeerConnected); event.Peer != "remote" {
+		t.Fatalf("connected event for the wrong peer %q", event.Peer)
+	}
+
+	conn.Close()
+	if event := expectEvent(t, events, SwarmPeerDisconnected); event.Peer != "remote" {
+		t.Fatalf("disconnected event for the wrong peer %q", event.Peer)
+	}
+	if peers := swarmOf(t, c, ih).Detail().Peers; len(peers) != 0 {
+		t.Fatalf("dropped peer is still listed: %v", peers)
+	}
+}
+
+func TestClaimedSessionCannotTakeOverPeer(t *testing.T) {
+	local, err := tcptransport.Listen("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSessionManager(local)
+	defer sm.Close()
+
+	honest, err := tcptransport.Listen("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer honest.Close()
+	peer := honest.Addr()
+
+	conn, err := honest.Dial(local.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var original *Session
+	if !waitFor(t, 2*time.Second, func() bool {
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		original = sm.sessions[peer]
+		return original != nil
+	}) {
+		t.Fatalf("honest peer's session was not accepted")
+	}
+
+	// Another node advertising the honest peer's address
+	impostor, err := tcptransport.Listen("127.0.0.1:0", string(peer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer impostor.Close()
+	fake, err := impostor.Dial(local.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+
+	_ = fake.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := fake.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Fatalf("impostor's session should be closed, got %v", err)
+	}
+	sm.mu.Lock()
+	current := sm.sessions[peer]
+	sm.mu.Unlock()
+	if current != original {
+		t.Fatalf("impostor replaced the honest peer's session")
+	}
+
+	// Nor may a claimed session rebind a swarm's handler for the peer.
+	swarm := newTestSwarm(t, 2)
+	sm.RegisterSwarm(swarm)
+	handler, _ := newTestPeer(t, swarm, peer, NewBitfield(2))
+	bound := handler.Session
+
+	serializer := NewProtobufSerializer()
+	payload, err := serializer.MarshalHandshakePayload(&protocol.HandshakePayload{InfoHash: swarm.InfoHash, PeerID: string(peer)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed := &Session{conn: fake, peer: peer, claimed: true}
+	sm.handleHandshake(claimed, protocol.PeerMessage{InfoHash: swarm.InfoHash, Type: protocol.MsgHandshake, Payload: payload}, serializer)
+
+	swarm.mu.RLock()
+	rebound := handler.Session != bound || swarm.Peers[peer] != handler
+	swarm.mu.RUnlock()
+	if rebound {
+		t.Fatalf("claimed handshake replaced the peer's session")
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func TestSwarmRegistryConcurrentAdds(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestNode(t, pipetransport.NewNetwork(), tracker.NewDirectory(), "self", dir).client
+	file, _ := createSeedFile(t, dir, "once.bin", config.TransferUnitSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ImportBaoFile(file, dir); err != nil {
+				t.Error(err)
+			}
+			_ = c.Swarms.All()
+		}()
+	}
+	wg.Wait()
+
+	if n := c.Swarms.Len(); n != 1 {
+		t.Fatalf("expected one swarm, got %d", n)
+	}
+}
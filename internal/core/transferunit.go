@@ -35,6 +35,11 @@ type transferUnitRequest struct {
 	SentAt   time.Time
 	Attempts int
 	Timeout  time.Duration
+
+	// Deadline is when a streaming unit is needed. It is set when the
+	// request is sent inside the stream window, or when the window moves
+	// over it, and is zero outside the window.
+	Deadline time.Time
 }
 
 type transferUnitCompleteEvent struct {
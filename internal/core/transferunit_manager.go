@@ -22,6 +22,33 @@ type TransferUnitManager struct {
 
 	transferUnitCompleteChan chan transferUnitCompleteEvent
 
+	// Rarest first: number of peers advertising each unit, and the
+	// bitfield each count was derived from so it can be subtracted again.
+	availability  []uint32
+	peerBitfields map[protocol.NodeKey]Bitfield
+
+	// Download strategy and the streaming playback cursor (unit index)
+	strategy     DownloadStrategy
+	cursor       uint64
+	streamWindow uint64
+
+	// Units local readers are blocked on, with how many readers marked
+	// each; requested before anything else
+	urgent map[uint64]int
+
+	// Endgame: extra peers an outstanding unit was also requested from
+	duplicates map[uint64]map[protocol.NodeKey]time.Time
+
+	// Peers that rejected us as overloaded or paused, skipped until the time
+	peerBackoff map[protocol.NodeKey]time.Time
+
+	// Set when a bandwidth limit held back a request; scheduling is retried
+	// on the next tick instead of waiting for another event.
+	throttled bool
+
+	// Set while the swarm is paused or queued; nothing is requested.
+	paused bool
+
 	mu sync.RWMutex
 }
 
@@ -33,11 +60,18 @@ func NewTransferUnitManager(swarm *Swarm, numTransferUnits uint64) *TransferUnit
 		activeRequests:           make(map[uint64]*transferUnitRequest),
 		peerRequests:             make(map[protocol.NodeKey][]uint64),
 		transferUnitCompleteChan: make(chan transferUnitCompleteEvent, 100),
+		availability:             make([]uint32, numTransferUnits),
+		peerBitfields:            make(map[protocol.NodeKey]Bitfield),
+		strategy:                 DefaultDownloadStrategy,
+		streamWindow:             uint64(config.StreamWindowUnits),
+		urgent:                   make(map[uint64]int),
+		duplicates:               make(map[uint64]map[protocol.NodeKey]time.Time),
+		peerBackoff:              make(map[protocol.NodeKey]time.Time),
 	}
 
 	for i := uint64(0); i < numTransferUnits; i++ {
 		state := TransferUnitStateMissing
-		if swarm.FileIO.haveUnits.Has(i) {
+		if swarm.FileIO.HasTransferUnit(i) {
 			state = TransferUnitStateComplete
 		}
 
@@ -47,12 +81,14 @@ func NewTransferUnitManager(swarm *Swarm, numTransferUnits uint64) *TransferUnit
 		}
 	}
 
-	go pm.run()
-	go pm.scheduleDownloads()
+	swarm.spawn(pm.run)
+	swarm.spawn(pm.scheduleDownloads)
 
 	return pm
 }
 
+// run handles completions and timeouts until the swarm closes, then drops
+// the outstanding requests.
 func (pm *TransferUnitManager) run() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
@@ -64,13 +100,35 @@ func (pm *TransferUnitManager) run() {
 
 		case <-ticker.C:
 			pm.checkTimeouts()
+			pm.retryThrottled()
+
+		case <-pm.swarm.ctx.Done():
+			pm.Pause()
+			return
 		}
 	}
 }
 
 func (pm *TransferUnitManager) MarkTransferUnitComplete(index uint64) {
-	pm.transferUnitCompleteChan <- transferUnitCompleteEvent{
-		transferUnit: index,
+	pm.notifyComplete(transferUnitCompleteEvent{transferUnit: index})
+}
+
+// notifyComplete hands a completion to run, unless the swarm is closing.
+func (pm *TransferUnitManager) notifyComplete(event transferUnitCompleteEvent) {
+	select {
+	case pm.transferUnitCompleteChan <- event:
+	case <-pm.swarm.ctx.Done():
+	}
+}
+
+// markAllComplete marks every unit complete, for data that was imported
+// rather than downloaded.
+func (pm *TransferUnitManager) markAllComplete() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, unit := range pm.transferUnits {
+		unit.State = TransferUnitStateComplete
 	}
 }
 
@@ -88,24 +146,28 @@ func (pm *TransferUnitManager) handleTransferUnitComplete(index uint64) {
 	if req, exists := pm.activeRequests[index]; exists {
 		pm.cleanupRequest(index, req.From)
 	}
+	pm.dropDuplicatesLocked(index)
 
 	pm.tryScheduleOneLocked()
 
 	log.Printf("TransferUnit %d download complete", index)
 }
 
+// checkTimeouts gives up on expired requests and sends MsgCancel to every
+// peer the unit was asked from, so they stop serving data we re-request
+// elsewhere.
 func (pm *TransferUnitManager) checkTimeouts() {
 	pm.mu.Lock()
-	defer pm.mu.Unlock()
 
 	now := time.Now()
-	timeout := config.TransferRequestTimeout
+	expired := make(map[uint64][]protocol.NodeKey)
 
 	for idx, req := range pm.activeRequests {
-		if now.Sub(req.SentAt) > timeout {
+		if pm.requestExpiredLocked(req, now) {
 			log.Printf("Request for transferUnit %d from %s timed out", idx, req.From)
 
 			pm.cleanupRequest(idx, req.From)
+			expired[idx] = append(pm.dropDuplicatesLocked(idx), req.From)
 
 			unit := pm.transferUnits[idx]
 			if unit.State == TransferUnitStateDownloading {
@@ -114,16 +176,26 @@ func (pm *TransferUnitManager) checkTimeouts() {
 
 			pm.tryScheduleOneLocked()
 
-			debugs.NumTransferResponseAwaitTimeout++
+			debugs.NumTransferResponseAwaitTimeout.Add(1)
 
 			req.Attempts++
 		}
 	}
+
+	pm.scheduleEndgameLocked()
+	pm.mu.Unlock()
+
+	for idx, peers := range expired {
+		pm.sendCancels(idx, peers)
+	}
 }
 
 func (pm *TransferUnitManager) cleanupRequest(index uint64, peer protocol.NodeKey) {
 	delete(pm.activeRequests, index)
+	pm.removePeerRequestLocked(index, peer)
+}
 
+func (pm *TransferUnitManager) removePeerRequestLocked(index uint64, peer protocol.NodeKey) {
 	if reqs, ok := pm.peerRequests[peer]; ok {
 		filtered := reqs[:0]
 		for _, r := range reqs {
@@ -143,76 +215,233 @@ func (pm *TransferUnitManager) scheduleDownloads() {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
-	for pm.tryScheduleOneLocked() {
-		// keep filling until window full or no candidates
-	}
+	// keep filling until window full or no candidates
+	pm.scheduleLocked(config.ActiveTransfersTotal())
 }
 
-func (pm *TransferUnitManager) tryScheduleOneLocked() bool {
-	if len(pm.activeRequests) >= config.ActiveTransfersTotal {
-		return false
+// retryThrottled schedules again if a bandwidth limit held requests back.
+func (pm *TransferUnitManager) retryThrottled() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.throttled {
+		pm.throttled = false
+		pm.scheduleLocked(config.ActiveTransfersTotal())
 	}
+}
 
-	//TODO: rarest first mode
-	//NOT YET IMPLEMENTED
+// Pause drops every outstanding request and stops scheduling new ones until
+// Resume.
+func (pm *TransferUnitManager) Pause() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 
-	//TODO: shuffle mode
-	var candidates []uint64
-	for unitIdx := uint64(0); unitIdx < pm.transferUnitCount; unitIdx++ {
-		unit := pm.transferUnits[unitIdx]
+	pm.paused = true
+	pm.throttled = false
+	for idx, req := range pm.activeRequests {
+		pm.cleanupRequest(idx, req.From)
+		pm.dropDuplicatesLocked(idx)
 
-		if unit.State != TransferUnitStateMissing {
-			continue
+		if unit := pm.transferUnits[idx]; unit.State == TransferUnitStateDownloading {
+			unit.State = TransferUnitStateMissing
 		}
+	}
+}
 
-		if _, active := pm.activeRequests[unitIdx]; active {
-			continue
-		}
+func (pm *TransferUnitManager) Resume() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 
-		candidates = append(candidates, unitIdx)
+	pm.paused = false
+	pm.scheduleLocked(config.ActiveTransfersTotal())
+}
+
+func (pm *TransferUnitManager) tryScheduleOneLocked() bool {
+	return pm.scheduleLocked(1) > 0
+}
+
+// scheduleLocked sends up to max requests in the order chosen by the
+// download strategy, and returns how many were sent.
+func (pm *TransferUnitManager) scheduleLocked(max int) int {
+	if pm.paused || len(pm.activeRequests) >= config.ActiveTransfersTotal() {
+		return 0
 	}
-	rand.Shuffle(len(candidates), func(i, j int) {
-		candidates[i], candidates[j] = candidates[j], candidates[i]
-	})
-	for _, unitIdx := range candidates {
-		peer := pm.selectPeerForTransferUnit(unitIdx, config.ActiveTransfersPerPeer)
+
+	sent := 0
+	for _, unitIdx := range pm.candidatesLocked() {
+		if sent >= max || len(pm.activeRequests) >= config.ActiveTransfersTotal() {
+			break
+		}
+
+		peer := pm.selectPeerForTransferUnit(unitIdx, config.ActiveTransfersPerPeer())
 		if peer == "" {
 			continue
 		}
 
 		if pm.sendTransferUnitRequest(unitIdx, peer) {
 			log.Printf("Requested transferUnit %d from %s", unitIdx, peer)
-			return true
+			sent++
 		}
 	}
 
-	return false // no schedulable unit found
+	pm.scheduleEndgameLocked()
 
-	//TODO: sequential mode
-	// for unitIdx := uint64(0); unitIdx < pm.transferUnitCount; unitIdx++ {
-	// 	unit := pm.transferUnits[unitIdx]
+	return sent
+}
 
-	// 	if unit.State != TransferUnitStateMissing {
-	// 		continue
-	// 	}
+// UpdatePeerBitfield replaces the units counted for peer with bf.
+func (pm *TransferUnitManager) UpdatePeerBitfield(peer protocol.NodeKey, bf Bitfield) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 
-	// 	if _, active := pm.activeRequests[unitIdx]; active {
-	// 		continue
-	// 	}
+	pm.removePeerLocked(peer)
 
-	// 	peer := pm.selectPeerForTransferUnit(unitIdx, maxRequestsPerPeer)
-	// 	if peer == "" {
-	// 		continue
-	// 	}
+	counted := NewBitfield(pm.transferUnitCount)
+	for i := uint64(0); i < pm.transferUnitCount; i++ {
+		if bf.Has(i) {
+			counted.Set(i)
+			pm.availability[i]++
+		}
+	}
+	pm.peerBitfields[peer] = counted
+}
+
+// PeerHave counts a single unit announced by peer.
+func (pm *TransferUnitManager) PeerHave(peer protocol.NodeKey, index uint64) {
+	if index >= pm.transferUnitCount {
+		return
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 
-	// 	if pm.sendTransferUnitRequest(unitIdx, peer) {
-	// 		log.Printf("Requested transferUnit %d from %s", unitIdx, peer)
-	// 	}
+	counted, ok := pm.peerBitfields[peer]
+	if !ok {
+		counted = NewBitfield(pm.transferUnitCount)
+		pm.peerBitfields[peer] = counted
+	}
+	if counted.Has(index) {
+		return
+	}
 
-	// 	if len(pm.activeRequests) >= maxActiveRequests {
-	// 		return
-	// 	}
-	// }
+	counted.Set(index)
+	pm.availability[index]++
+}
+
+// RemovePeer drops peer's units from the availability counts.
+func (pm *TransferUnitManager) RemovePeer(peer protocol.NodeKey) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.removePeerLocked(peer)
+	delete(pm.peerBackoff, peer)
+}
+
+// HandleReject drops a request peer refused and reschedules the unit right
+// away. A peer that lacks the unit stops being counted for it; one that is
+// overloaded or paused is skipped for RejectBackoff.
+func (pm *TransferUnitManager) HandleReject(peer protocol.NodeKey, index uint64, reason string) {
+	if index >= pm.transferUnitCount {
+		return
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	switch reason {
+	case protocol.RejectNotHave, protocol.RejectNoProof:
+		// The peer's bitfield overstated what it can serve.
+		pm.swarm.mu.RLock()
+		if handler, ok := pm.swarm.Peers[peer]; ok {
+			handler.peerLacks(index)
+		}
+		pm.swarm.mu.RUnlock()
+
+		if counted, ok := pm.peerBitfields[peer]; ok && counted.Has(index) {
+			counted.Clear(index)
+			if pm.availability[index] > 0 {
+				pm.availability[index]--
+			}
+		}
+	case protocol.RejectChoked:
+		// Scheduling skips the peer until it unchokes us again.
+	default:
+		pm.peerBackoff[peer] = time.Now().Add(config.RejectBackoff)
+	}
+
+	if dups, ok := pm.duplicates[index]; ok {
+		if _, asked := dups[peer]; asked {
+			delete(dups, peer)
+			pm.removePeerRequestLocked(index, peer)
+			if len(dups) == 0 {
+				delete(pm.duplicates, index)
+			}
+		}
+	}
+
+	if req, exists := pm.activeRequests[index]; exists && req.From == peer {
+		pm.cleanupRequest(index, peer)
+		if !pm.promoteDuplicateLocked(index) && pm.transferUnits[index].State == TransferUnitStateDownloading {
+			pm.transferUnits[index].State = TransferUnitStateMissing
+		}
+	}
+
+	log.Printf("TransferUnit %d rejected by %s (%s)", index, peer, reason)
+
+	pm.scheduleLocked(config.ActiveTransfersTotal())
+}
+
+// promoteDuplicateLocked turns an outstanding endgame request for a unit into
+// its primary request, so losing the primary does not reset the unit.
+func (pm *TransferUnitManager) promoteDuplicateLocked(index uint64) bool {
+	for peer, sentAt := range pm.duplicates[index] {
+		delete(pm.duplicates[index], peer)
+		if len(pm.duplicates[index]) == 0 {
+			delete(pm.duplicates, index)
+		}
+
+		pm.activeRequests[index] = pm.newRequestLocked(index, peer, sentAt)
+		return true
+	}
+	return false
+}
+
+func (pm *TransferUnitManager) backedOffLocked(peer protocol.NodeKey, now time.Time) bool {
+	until, ok := pm.peerBackoff[peer]
+	if !ok {
+		return false
+	}
+	if now.After(until) {
+		delete(pm.peerBackoff, peer)
+		return false
+	}
+	return true
+}
+
+func (pm *TransferUnitManager) removePeerLocked(peer protocol.NodeKey) {
+	counted, ok := pm.peerBitfields[peer]
+	if !ok {
+		return
+	}
+
+	for i := uint64(0); i < pm.transferUnitCount; i++ {
+		if counted.Has(i) && pm.availability[i] > 0 {
+			pm.availability[i]--
+		}
+	}
+	delete(pm.peerBitfields, peer)
+}
+
+// Availability returns how many connected peers advertise a unit.
+func (pm *TransferUnitManager) Availability(index uint64) uint32 {
+	if index >= pm.transferUnitCount {
+		return 0
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return pm.availability[index]
 }
 
 func (pm *TransferUnitManager) tryScheduleOne() {
@@ -229,17 +458,23 @@ func (pm *TransferUnitManager) selectPeerForTransferUnit(unit uint64, maxPerPeer
 	var candidates []protocol.NodeKey
 	minLoad := int(^uint(0) >> 1)
 	var best protocol.NodeKey
+	now := time.Now()
 
 	for peer, handler := range pm.swarm.Peers {
 		if handler.GetState() != protocol.StateConnected {
 			continue
 		}
 
-		if handler.Bitfield.bits == nil {
+		if pm.backedOffLocked(peer, now) || handler.chokingUs() {
+			continue
+		}
+
+		if handler.downloadThrottled(now) {
+			pm.throttled = true
 			continue
 		}
 
-		if !handler.Bitfield.Has(unit) {
+		if !handler.peerHas(unit) {
 			continue
 		}
 
@@ -267,12 +502,24 @@ func (pm *TransferUnitManager) selectPeerForTransferUnit(unit uint64, maxPerPeer
 	return ""
 }
 
+func (pm *TransferUnitManager) newRequestLocked(index uint64, peer protocol.NodeKey, sentAt time.Time) *transferUnitRequest {
+	req := &transferUnitRequest{
+		Index:    index,
+		From:     peer,
+		SentAt:   sentAt,
+		Attempts: 1,
+		Timeout:  30 * time.Second,
+	}
+	req.Deadline, _ = pm.streamDeadlineLocked(index, sentAt)
+	return req
+}
+
 func (pm *TransferUnitManager) sendTransferUnitRequest(index uint64, peer protocol.NodeKey) bool {
 	pm.swarm.mu.RLock()
 	handler, exists := pm.swarm.Peers[peer]
 	pm.swarm.mu.RUnlock()
 
-	if !exists {
+	if !exists || !handler.takeDownloadBandwidth(time.Now()) {
 		return false
 	}
 
@@ -281,13 +528,7 @@ func (pm *TransferUnitManager) sendTransferUnitRequest(index uint64, peer protoc
 		return false
 	}
 
-	pm.activeRequests[index] = &transferUnitRequest{
-		Index:    index,
-		From:     peer,
-		SentAt:   time.Now(),
-		Attempts: 1,
-		Timeout:  30 * time.Second,
-	}
+	pm.activeRequests[index] = pm.newRequestLocked(index, peer, time.Now())
 
 	pm.peerRequests[peer] = append(pm.peerRequests[peer], index)
 	pm.transferUnits[index].State = TransferUnitStateDownloading
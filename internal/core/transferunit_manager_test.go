@@ -0,0 +1,160 @@
+package core
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func newTestSwarm(t *testing.T, units uint64) *Swarm {
+	t.Helper()
+
+	tempDir, err := os.MkdirTemp("", "tum-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	file := createTestBaoFile("units.bin", uint64(config.TransferUnitSize)*units, uint64(config.TransferUnitSize))
+	file.InfoHash = protocol.InfoHash{9}
+
+	swarm := NewSwarm(file.InfoHash, file, tempDir)
+	t.Cleanup(func() { swarm.Close() })
+	return swarm
+}
+
+func bitfieldOf(units uint64, set ...uint64) Bitfield {
+	bf := NewBitfield(units)
+	for _, idx := range set {
+		bf.Set(idx)
+	}
+	return bf
+}
+
+func TestTransferUnitManagerAvailabilityCounts(t *testing.T) {
+	swarm := newTestSwarm(t, 8)
+	pm := swarm.TransferUnitManager
+
+	pm.UpdatePeerBitfield("a", bitfieldOf(8, 0, 1, 2))
+	pm.UpdatePeerBitfield("b", bitfieldOf(8, 1, 2))
+	pm.PeerHave("c", 2)
+	pm.PeerHave("c", 2) // duplicate HAVE is counted once
+
+	expect := map[uint64]uint32{0: 1, 1: 2, 2: 3, 3: 0}
+	for idx, want := range expect {
+		if got := pm.Availability(idx); got != want {
+			t.Fatalf("unit %d availability: got %d, want %d", idx, got, want)
+		}
+	}
+
+	// A replacement bitfield replaces, rather than adds to, the old counts.
+	pm.UpdatePeerBitfield("a", bitfieldOf(8, 3))
+	if got := pm.Availability(0); got != 0 {
+		t.Fatalf("unit 0 should no longer be available, got %d", got)
+	}
+	if got := pm.Availability(3); got != 1 {
+		t.Fatalf("unit 3 should be available once, got %d", got)
+	}
+
+	pm.RemovePeer("b")
+	if got := pm.Availability(1); got != 0 {
+		t.Fatalf("unit 1 should drop to 0 after peer removal, got %d", got)
+	}
+	if got := pm.Availability(2); got != 1 {
+		t.Fatalf("unit 2 should drop to 1 after peer removal, got %d", got)
+	}
+}
+
+func TestTransferUnitManagerRarestFirstOrder(t *testing.T) {
+	swarm := newTestSwarm(t, 8)
+	pm := swarm.TransferUnitManager
+
+	pm.UpdatePeerBitfield("a", bitfieldOf(8, 0, 1, 2, 3, 4))
+	pm.UpdatePeerBitfield("b", bitfieldOf(8, 0, 1, 2, 3))
+	pm.UpdatePeerBitfield("c", bitfieldOf(8, 0, 1))
+
+	pm.mu.Lock()
+	pm.transferUnits[1].State = TransferUnitStateComplete
+	candidates := pm.candidatesLocked()
+	pm.mu.Unlock()
+
+	if len(candidates) != 4 {
+		t.Fatalf("expected 4 candidates (units 0,2,3,4), got %v", candidates)
+	}
+	if candidates[0] != 4 {
+		t.Fatalf("rarest unit 4 should come first, got %v", candidates)
+	}
+	if candidates[3] != 0 {
+		t.Fatalf("most replicated unit 0 should come last, got %v", candidates)
+	}
+	for _, idx := range candidates {
+		if idx == 1 || idx >= 5 {
+			t.Fatalf("unexpected candidate %d in %v", idx, candidates)
+		}
+	}
+}
+
+func TestPausedSwarmRequestsNothing(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	newTestPeer(t, swarm, "seeder", bitfieldOf(4, 0, 1, 2, 3))
+
+	pm := swarm.TransferUnitManager
+	pm.scheduleDownloads()
+
+	swarm.SetPaused(true)
+	pm.mu.RLock()
+	active := len(pm.activeRequests)
+	pm.mu.RUnlock()
+	if active != 0 {
+		t.Fatalf("pausing should drop outstanding requests, %d left", active)
+	}
+
+	pm.scheduleDownloads()
+	pm.mu.RLock()
+	active = len(pm.activeRequests)
+	pm.mu.RUnlock()
+	if active != 0 {
+		t.Fatalf("a paused swarm should not schedule, sent %d requests", active)
+	}
+
+	swarm.SetPaused(false)
+	pm.mu.RLock()
+	active = len(pm.activeRequests)
+	pm.mu.RUnlock()
+	if active != 4 {
+		t.Fatalf("resuming should request every unit again, got %d", active)
+	}
+}
+
+func TestClosedSwarmDropsRequestsAndStops(t *testing.T) {
+	swarm := newTestSwarm(t, 4)
+	ph, _ := newTestPeer(t, swarm, "seeder", bitfieldOf(4, 0, 1, 2, 3))
+
+	pm := swarm.TransferUnitManager
+	pm.scheduleDownloads()
+	ph.enqueueUpload(0) // Starts the peer's upload loop
+
+	done := make(chan error, 1)
+	go func() { done <- swarm.Close() }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("close did not return once the swarm's goroutines were asked to stop")
+	}
+
+	pm.mu.RLock()
+	active := len(pm.activeRequests)
+	pm.mu.RUnlock()
+	if active != 0 {
+		t.Fatalf("closing should drop outstanding requests, %d left", active)
+	}
+	if swarm.spawn(func() {}) {
+		t.Fatalf("a closed swarm should not start goroutines")
+	}
+	if err := swarm.SaveProof(0, &protocol.Proof{}); err == nil {
+		t.Fatalf("a closed swarm should not write proofs")
+	}
+}
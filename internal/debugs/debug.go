@@ -1,23 +1,37 @@
 package debugs
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 var (
-	NumTransferRequestSend          int
-	NumTransferRequestReceived      int
-	NumTransferResponseSend         int
-	NumTransferResponseReceived     int
-	NumTransferResponseAwaitTimeout int
+	NumTransferRequestSend          atomic.Int64
+	NumTransferRequestReceived      atomic.Int64
+	NumTransferResponseSend         atomic.Int64
+	NumTransferResponseReceived     atomic.Int64
+	NumTransferResponseAwaitTimeout atomic.Int64
+	NumTransferCancelSend           atomic.Int64
+	NumTransferRequestCancelled     atomic.Int64
+	NumTransferDuplicateReceived    atomic.Int64
+	NumTransferRejectSend           atomic.Int64
+	NumTransferRejectReceived       atomic.Int64
 
 	ConnectedToTracker bool
 )
 
 func DumpLog() {
 	fmt.Printf("Connection to tracker: %t\n", ConnectedToTracker)
-	fmt.Printf("NumTransferRequestSend: %d\n", NumTransferRequestSend)
-	fmt.Printf("NumTransferRequestReceived: %d\n", NumTransferRequestReceived)
-	fmt.Printf("NumTransferResponseSend: %d\n", NumTransferResponseSend)
-	fmt.Printf("NumTransferResponseReceived: %d\n\n", NumTransferResponseReceived)
+	fmt.Printf("NumTransferRequestSend: %d\n", NumTransferRequestSend.Load())
+	fmt.Printf("NumTransferRequestReceived: %d\n", NumTransferRequestReceived.Load())
+	fmt.Printf("NumTransferResponseSend: %d\n", NumTransferResponseSend.Load())
+	fmt.Printf("NumTransferResponseReceived: %d\n\n", NumTransferResponseReceived.Load())
+
+	fmt.Printf("NumTransferResponseAwaitTimeout: %d\n\n", NumTransferResponseAwaitTimeout.Load())
 
-	fmt.Printf("NumTransferResponseAwaitTimeout: %d\n\n", NumTransferResponseAwaitTimeout)
+	fmt.Printf("NumTransferCancelSend: %d\n", NumTransferCancelSend.Load())
+	fmt.Printf("NumTransferRequestCancelled: %d\n", NumTransferRequestCancelled.Load())
+	fmt.Printf("NumTransferDuplicateReceived: %d\n", NumTransferDuplicateReceived.Load())
+	fmt.Printf("NumTransferRejectSend: %d\n", NumTransferRejectSend.Load())
+	fmt.Printf("NumTransferRejectReceived: %d\n\n", NumTransferRejectReceived.Load())
 }
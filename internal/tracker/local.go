@@ -0,0 +1,72 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+// Directory maps tracker addresses to in-process trackers.
+type Directory struct {
+	mu       sync.RWMutex
+	trackers map[string]*Tracker
+}
+
+func NewDirectory() *Directory {
+	return &Directory{
+		trackers: make(map[string]*Tracker),
+	}
+}
+
+func (d *Directory) Register(address string, t *Tracker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.trackers[address] = t
+}
+
+func (d *Directory) lookup(address string) (*Tracker, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	t, ok := d.trackers[address]
+	return t, ok
+}
+
+/*
+LocalTransport announces to trackers in the same process.
+It satisfies core.TrackerTransport, so a Client can be
+pointed at a Tracker without any network.
+*/
+type LocalTransport struct {
+	nodeKey   protocol.NodeKey
+	directory *Directory
+}
+
+func NewLocalTransport(nodeKey protocol.NodeKey, directory *Directory) *LocalTransport {
+	return &LocalTransport{
+		nodeKey:   nodeKey,
+		directory: directory,
+	}
+}
+
+func (lt *LocalTransport) Announce(
+	ctx context.Context,
+	trackerKey string,
+	req protocol.AnnounceRequest,
+) (protocol.AnnounceResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return protocol.AnnounceResponse{}, err
+	}
+
+	t, ok := lt.directory.lookup(trackerKey)
+	if !ok {
+		return protocol.AnnounceResponse{}, fmt.Errorf("unknown tracker %q", trackerKey)
+	}
+
+	return t.Announce(lt.nodeKey, req), nil
+}
+
+func (lt *LocalTransport) Close() {}
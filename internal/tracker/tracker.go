@@ -0,0 +1,240 @@
+package tracker
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+const (
+	DefaultInterval = 30 * time.Second
+	DefaultPeerTTL  = 3 * DefaultInterval
+	DefaultMaxPeers = 50
+)
+
+type Config struct {
+	// Interval is returned to clients as the time between regular announces.
+	Interval time.Duration
+	// PeerTTL is how long a peer stays listed without announcing again.
+	PeerTTL time.Duration
+	// MaxPeers caps the number of peers returned per announce.
+	MaxPeers int
+}
+
+/*
+Tracker keeps per-InfoHash peer sets.
+It does not know how announces arrive; transports
+decode requests and pass them in together with the sender's NodeKey.
+*/
+type Tracker struct {
+	cfg Config
+
+	mu     sync.Mutex
+	swarms map[protocol.InfoHash]*swarmPeers
+
+	now func() time.Time
+}
+
+type swarmPeers struct {
+	peers     map[protocol.NodeKey]*peerEntry
+	completed int
+}
+
+type peerEntry struct {
+	isSeeder   bool
+	uploaded   uint64
+	downloaded uint64
+	left       uint64
+	lastSeen   time.Time
+}
+
+// SwarmStats summarizes one InfoHash.
+type SwarmStats struct {
+	Seeders   int
+	Leechers  int
+	Completed int
+}
+
+func New(cfg Config) *Tracker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.PeerTTL <= 0 {
+		cfg.PeerTTL = 3 * cfg.Interval
+	}
+	if cfg.MaxPeers <= 0 {
+		cfg.MaxPeers = DefaultMaxPeers
+	}
+
+	return &Tracker{
+		cfg:    cfg,
+		swarms: make(map[protocol.InfoHash]*swarmPeers),
+		now:    time.Now,
+	}
+}
+
+// Announce records the announce from peer and returns the peers it should
+// connect to. A stopped event removes the peer and returns no peers.
+func (t *Tracker) Announce(peer protocol.NodeKey, req protocol.AnnounceRequest) protocol.AnnounceResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	resp := protocol.AnnounceResponse{
+		Interval: int(t.cfg.Interval / time.Second),
+		Peers:    make([]protocol.Peer, 0),
+	}
+
+	sw := t.swarms[req.InfoHash]
+
+	if req.Event == protocol.EventStopped {
+		if sw != nil {
+			delete(sw.peers, peer)
+			if len(sw.peers) == 0 {
+				delete(t.swarms, req.InfoHash)
+			}
+		}
+		return resp
+	}
+
+	if sw == nil {
+		sw = &swarmPeers{peers: make(map[protocol.NodeKey]*peerEntry)}
+		t.swarms[req.InfoHash] = sw
+	}
+
+	entry, exists := sw.peers[peer]
+	if !exists {
+		entry = &peerEntry{}
+		sw.peers[peer] = entry
+	}
+
+	wasSeeder := exists && entry.isSeeder
+	entry.isSeeder = req.Left == 0
+	entry.uploaded = req.Uploaded
+	entry.downloaded = req.Downloaded
+	entry.left = req.Left
+	entry.lastSeen = now
+
+	if req.Event == protocol.EventCompleted && !wasSeeder {
+		sw.completed++
+	}
+
+	resp.Peers = t.selectPeersLocked(sw, peer, entry.isSeeder, now)
+	return resp
+}
+
+// selectPeersLocked returns a random subset of live peers, excluding the
+// requester. Seeders are only handed leechers since they never download.
+func (t *Tracker) selectPeersLocked(sw *swarmPeers, requester protocol.NodeKey, requesterIsSeeder bool, now time.Time) []protocol.Peer {
+	out := make([]protocol.Peer, 0, len(sw.peers))
+	for key, entry := range sw.peers {
+		if key == requester {
+			continue
+		}
+		if now.Sub(entry.lastSeen) > t.cfg.PeerTTL {
+			continue
+		}
+		if requesterIsSeeder && entry.isSeeder {
+			continue
+		}
+		out = append(out, protocol.Peer{
+			NodeKey:  key,
+			IsSeeder: entry.isSeeder,
+		})
+	}
+
+	rand.Shuffle(len(out), func(i, j int) {
+		out[i], out[j] = out[j], out[i]
+	})
+	if len(out) > t.cfg.MaxPeers {
+		out = out[:t.cfg.MaxPeers]
+	}
+
+	return out
+}
+
+// Expire drops peers that have not announced within the peer TTL.
+func (t *Tracker) Expire() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	removed := 0
+	for ih, sw := range t.swarms {
+		for key, entry := range sw.peers {
+			if now.Sub(entry.lastSeen) > t.cfg.PeerTTL {
+				delete(sw.peers, key)
+				removed++
+			}
+		}
+		if len(sw.peers) == 0 {
+			delete(t.swarms, ih)
+		}
+	}
+
+	return removed
+}
+
+// RunExpiry calls Expire every interval until stop is closed.
+func (t *Tracker) RunExpiry(stop <-chan struct{}) {
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.Expire()
+		}
+	}
+}
+
+// Peers returns the live peers for an InfoHash.
+func (t *Tracker) Peers(ih protocol.InfoHash) []protocol.Peer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sw := t.swarms[ih]
+	if sw == nil {
+		return nil
+	}
+
+	now := t.now()
+	out := make([]protocol.Peer, 0, len(sw.peers))
+	for key, entry := range sw.peers {
+		if now.Sub(entry.lastSeen) > t.cfg.PeerTTL {
+			continue
+		}
+		out = append(out, protocol.Peer{NodeKey: key, IsSeeder: entry.isSeeder})
+	}
+	return out
+}
+
+// Stats returns seeder/leecher counts for an InfoHash.
+func (t *Tracker) Stats(ih protocol.InfoHash) SwarmStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var stats SwarmStats
+	sw := t.swarms[ih]
+	if sw == nil {
+		return stats
+	}
+
+	now := t.now()
+	stats.Completed = sw.completed
+	for _, entry := range sw.peers {
+		if now.Sub(entry.lastSeen) > t.cfg.PeerTTL {
+			continue
+		}
+		if entry.isSeeder {
+			stats.Seeders++
+		} else {
+			stats.Leechers++
+		}
+	}
+	return stats
+}
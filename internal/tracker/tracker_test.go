@@ -0,0 +1,130 @@
+package tracker
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/core"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+func TestTrackerAnnounceEvents(t *testing.T) {
+	tr := New(Config{Interval: 10 * time.Second})
+	ih := protocol.InfoHash{1}
+
+	resp := tr.Announce("seeder", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 0})
+	if resp.Interval != 10 {
+		t.Fatalf("expected interval 10, got %d", resp.Interval)
+	}
+	if len(resp.Peers) != 0 {
+		t.Fatalf("first peer should receive no peers, got %d", len(resp.Peers))
+	}
+
+	resp = tr.Announce("leecher", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 100})
+	if len(resp.Peers) != 1 || resp.Peers[0].NodeKey != "seeder" || !resp.Peers[0].IsSeeder {
+		t.Fatalf("leecher should receive the seeder, got %+v", resp.Peers)
+	}
+
+	stats := tr.Stats(ih)
+	if stats.Seeders != 1 || stats.Leechers != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Seeders are not handed other seeders.
+	tr.Announce("seeder2", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 0})
+	resp = tr.Announce("seeder", protocol.AnnounceRequest{InfoHash: ih, Left: 0})
+	for _, p := range resp.Peers {
+		if p.IsSeeder {
+			t.Fatalf("seeder should only receive leechers, got %+v", resp.Peers)
+		}
+	}
+
+	tr.Announce("leecher", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventCompleted, Left: 0})
+	stats = tr.Stats(ih)
+	if stats.Seeders != 3 || stats.Leechers != 0 || stats.Completed != 1 {
+		t.Fatalf("unexpected stats after completion %+v", stats)
+	}
+
+	resp = tr.Announce("seeder2", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStopped})
+	if len(resp.Peers) != 0 {
+		t.Fatalf("stopped announce should not return peers")
+	}
+	if got := len(tr.Peers(ih)); got != 2 {
+		t.Fatalf("expected 2 peers after stop, got %d", got)
+	}
+}
+
+func TestTrackerExpiry(t *testing.T) {
+	tr := New(Config{Interval: time.Second, PeerTTL: 5 * time.Second})
+	now := time.Unix(1000, 0)
+	tr.now = func() time.Time { return now }
+
+	ih := protocol.InfoHash{2}
+	tr.Announce("a", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 1})
+
+	now = now.Add(3 * time.Second)
+	tr.Announce("b", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 1})
+
+	now = now.Add(3 * time.Second)
+	resp := tr.Announce("c", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 1})
+	if len(resp.Peers) != 1 || resp.Peers[0].NodeKey != "b" {
+		t.Fatalf("expired peer should not be returned, got %+v", resp.Peers)
+	}
+
+	if removed := tr.Expire(); removed != 1 {
+		t.Fatalf("expected 1 expired peer, got %d", removed)
+	}
+}
+
+func TestTrackerMaxPeers(t *testing.T) {
+	tr := New(Config{MaxPeers: 3})
+	ih := protocol.InfoHash{3}
+
+	for _, key := range []protocol.NodeKey{"a", "b", "c", "d", "e"} {
+		tr.Announce(key, protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 1})
+	}
+
+	resp := tr.Announce("f", protocol.AnnounceRequest{InfoHash: ih, Event: protocol.EventStarted, Left: 1})
+	if len(resp.Peers) != 3 {
+		t.Fatalf("expected 3 peers, got %d", len(resp.Peers))
+	}
+}
+
+func TestTrackerWithClient(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tracker-client-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tr := New(Config{})
+	directory := NewDirectory()
+	directory.Register("bao.tracker", tr)
+
+	file := &core.BaoFile{
+		Name:     "tracked.bin",
+		Length:   4096,
+		RootHash: "unused",
+		InfoHash: protocol.InfoHash{4},
+		Trackers: []string{"bao.tracker"},
+	}
+
+	client := core.NewClient("bao.client", NewLocalTransport("bao.client", directory), nil)
+	swarm := core.NewSwarm(file.InfoHash, file, tempDir)
+	defer swarm.Close()
+	client.Swarms.Add(swarm)
+
+	client.AnnounceSwarm(context.Background(), file.InfoHash, protocol.EventStarted)
+
+	peers := tr.Peers(file.InfoHash)
+	if len(peers) != 1 || peers[0].NodeKey != "bao.client" || peers[0].IsSeeder {
+		t.Fatalf("client should be listed as a leecher, got %+v", peers)
+	}
+
+	client.AnnounceSwarm(context.Background(), file.InfoHash, protocol.EventStopped)
+	if peers := tr.Peers(file.InfoHash); len(peers) != 0 {
+		t.Fatalf("stopped client should be removed, got %+v", peers)
+	}
+}
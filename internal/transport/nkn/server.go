@@ -27,7 +27,7 @@ func NewTransport(client *nkn.MultiClient) *Transport {
 
 	log.Println("Listening at", client.Addr())
 
-	sm := core.NewSessionManager(client)
+	sm := core.NewSessionManager(&sessionTransport{client: client})
 
 	return &Transport{
 		client:   client,
@@ -56,8 +56,13 @@ func (t *Transport) Announce(
 		debugs.ConnectedToTracker = false
 		return protocol.AnnounceResponse{}, err
 	}
-	resp := <-reply.C
-	if len(resp.Data) == 0 {
+	var resp *nkn.Message
+	select {
+	case resp = <-reply.C:
+	case <-ctx.Done():
+		return protocol.AnnounceResponse{}, ctx.Err()
+	}
+	if resp == nil || len(resp.Data) == 0 {
 		debugs.ConnectedToTracker = false
 		return protocol.AnnounceResponse{}, fmt.Errorf("no reply from tracker")
 	}
@@ -73,6 +78,9 @@ func (t *Transport) Announce(
 }
 
 func (t *Transport) Close() {
-	t.client.Close()
+	// Closing the session manager also closes the underlying NKN client.
+	if err := t.Sessions.Close(); err != nil {
+		log.Printf("failed to close sessions: %v", err)
+	}
 	log.Println("Client closed...")
 }
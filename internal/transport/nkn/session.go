@@ -0,0 +1,32 @@
+package nkntransport
+
+import (
+	"net"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+	"github.com/nknorg/ncp-go"
+	nkn "github.com/nknorg/nkn-sdk-go"
+)
+
+// sessionTransport carries peer sessions over NKN ncp sessions.
+type sessionTransport struct {
+	client *nkn.MultiClient
+}
+
+func (st *sessionTransport) Dial(peer protocol.NodeKey) (net.Conn, error) {
+	return st.client.DialWithConfig(string(peer), &nkn.DialConfig{
+		DialTimeout: config.DialTimeoutMs,
+		SessionConfig: &ncp.Config{
+			MTU: config.MTU,
+		},
+	})
+}
+
+func (st *sessionTransport) Accept() (net.Conn, error) {
+	return st.client.Accept()
+}
+
+func (st *sessionTransport) Close() error {
+	return st.client.Close()
+}
@@ -0,0 +1,42 @@
+package nkntransport
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/baoswarm/baobun/internal/tracker"
+	"github.com/baoswarm/baobun/pkg/protocol"
+	nkn "github.com/nknorg/nkn-sdk-go"
+)
+
+// ServeTracker answers AnnounceRequest messages sent to client with replies
+// from t. It blocks until the client's message channel is closed.
+func ServeTracker(client *nkn.MultiClient, t *tracker.Tracker) {
+	<-client.OnConnect.C
+
+	log.Println("Tracker listening at", client.Address())
+
+	for msg := range client.OnMessage.C {
+		if msg == nil {
+			continue
+		}
+
+		var req protocol.AnnounceRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			log.Printf("invalid announce from %s: %v", msg.Src, err)
+			continue
+		}
+
+		resp := t.Announce(protocol.NodeKey(msg.Src), req)
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			log.Printf("failed to marshal announce response: %v", err)
+			continue
+		}
+
+		if err := msg.Reply(data); err != nil {
+			log.Printf("failed to reply to %s: %v", msg.Src, err)
+		}
+	}
+}
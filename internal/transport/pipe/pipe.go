@@ -0,0 +1,217 @@
+// Package pipetransport carries peer sessions between clients in the same
+// process, for running multi-node swarms without any network.
+package pipetransport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+var ErrClosed = errors.New("pipe transport closed")
+
+// Network is a registry of in-process listeners keyed by NodeKey.
+type Network struct {
+	mu        sync.RWMutex
+	listeners map[protocol.NodeKey]*Transport
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		listeners: make(map[protocol.NodeKey]*Transport),
+	}
+}
+
+// Listen registers a transport reachable at addr.
+func (n *Network) Listen(addr protocol.NodeKey) (*Transport, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, exists := n.listeners[addr]; exists {
+		return nil, fmt.Errorf("address %s already in use", addr)
+	}
+
+	t := &Transport{
+		network: n,
+		addr:    addr,
+		accept:  make(chan net.Conn, 16),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[addr] = t
+
+	return t, nil
+}
+
+func (n *Network) lookup(addr protocol.NodeKey) (*Transport, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	t, ok := n.listeners[addr]
+	return t, ok
+}
+
+func (n *Network) remove(addr protocol.NodeKey) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.listeners, addr)
+}
+
+// Transport implements core.PeerTransport on top of a Network.
+type Transport struct {
+	network *Network
+	addr    protocol.NodeKey
+
+	accept    chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Addr returns the NodeKey other transports dial to reach this one.
+func (t *Transport) Addr() protocol.NodeKey {
+	return t.addr
+}
+
+func (t *Transport) Dial(peer protocol.NodeKey) (net.Conn, error) {
+	select {
+	case <-t.closed:
+		return nil, ErrClosed
+	default:
+	}
+
+	remote, ok := t.network.lookup(peer)
+	if !ok {
+		return nil, fmt.Errorf("no pipe listener at %s", peer)
+	}
+
+	local, accepted := newConnPair(t.addr, peer)
+
+	select {
+	case remote.accept <- accepted:
+		return local, nil
+	case <-remote.closed:
+		return nil, fmt.Errorf("pipe listener at %s closed", peer)
+	}
+}
+
+func (t *Transport) Accept() (net.Conn, error) {
+	select {
+	case conn := <-t.accept:
+		return conn, nil
+	case <-t.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (t *Transport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.network.remove(t.addr)
+	})
+	return nil
+}
+
+type pipeAddr protocol.NodeKey
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// buffer is one direction of a conn. Writes never block, so two peers
+// writing to each other from their read loops cannot deadlock.
+type buffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	data   bytes.Buffer
+	closed bool
+}
+
+func newBuffer() *buffer {
+	b := &buffer{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *buffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	n, err := b.data.Write(p)
+	b.cond.Broadcast()
+	return n, err
+}
+
+func (b *buffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.data.Len() == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if b.data.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	return b.data.Read(p)
+}
+
+func (b *buffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+type conn struct {
+	rx     *buffer
+	tx     *buffer
+	local  pipeAddr
+	remote pipeAddr
+}
+
+func newConnPair(dialer, listener protocol.NodeKey) (*conn, *conn) {
+	toListener := newBuffer()
+	toDialer := newBuffer()
+
+	dialerSide := &conn{
+		rx:     toDialer,
+		tx:     toListener,
+		local:  pipeAddr(dialer),
+		remote: pipeAddr(listener),
+	}
+	listenerSide := &conn{
+		rx:     toListener,
+		tx:     toDialer,
+		local:  pipeAddr(listener),
+		remote: pipeAddr(dialer),
+	}
+
+	return dialerSide, listenerSide
+}
+
+func (c *conn) Read(p []byte) (int, error)  { return c.rx.read(p) }
+func (c *conn) Write(p []byte) (int, error) { return c.tx.write(p) }
+
+func (c *conn) Close() error {
+	c.rx.close()
+	c.tx.close()
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+// Deadlines are not supported; session reads block until data or close.
+func (c *conn) SetDeadline(t time.Time) error      { return nil }
+func (c *conn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *conn) SetWriteDeadline(t time.Time) error { return nil }
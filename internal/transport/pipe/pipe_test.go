@@ -0,0 +1,85 @@
+package pipetransport
+
+import (
+	"io"
+	"testing"
+)
+
+func TestPipeDialAccept(t *testing.T) {
+	network := NewNetwork()
+
+	a, err := network.Listen("node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	b, err := network.Listen("node-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if _, err := network.Listen("node-a"); err == nil {
+		t.Fatalf("expected duplicate listen to fail")
+	}
+
+	dialed, err := a.Dial("node-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted, err := b.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := accepted.RemoteAddr().String(); got != "node-a" {
+		t.Fatalf("accepted conn should report dialer address, got %s", got)
+	}
+	if got := dialed.RemoteAddr().String(); got != "node-b" {
+		t.Fatalf("dialed conn should report listener address, got %s", got)
+	}
+
+	// Both sides can write before either reads.
+	if _, err := dialed.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accepted.Write([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(accepted, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expected ping, got %q (%v)", buf, err)
+	}
+	if _, err := io.ReadFull(dialed, buf); err != nil || string(buf) != "pong" {
+		t.Fatalf("expected pong, got %q (%v)", buf, err)
+	}
+
+	dialed.Close()
+	if _, err := accepted.Read(buf); err != io.EOF {
+		t.Fatalf("expected EOF after close, got %v", err)
+	}
+}
+
+func TestPipeDialUnknownAndClosed(t *testing.T) {
+	network := NewNetwork()
+
+	a, err := network.Listen("node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Dial("missing"); err == nil {
+		t.Fatalf("expected dial to unknown address to fail")
+	}
+
+	a.Close()
+	if _, err := a.Accept(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed from Accept, got %v", err)
+	}
+	if _, err := network.Listen("node-a"); err != nil {
+		t.Fatalf("address should be reusable after close: %v", err)
+	}
+}
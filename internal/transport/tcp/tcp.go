@@ -0,0 +1,175 @@
+// Package tcptransport carries peer sessions over plain TCP.
+package tcptransport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/baoswarm/baobun/internal/config"
+	"github.com/baoswarm/baobun/pkg/protocol"
+)
+
+const (
+	maxAddrLength   = 255
+	preambleTimeout = 10 * time.Second
+)
+
+var ErrClosed = errors.New("tcp transport closed")
+
+/*
+Transport implements core.PeerTransport over TCP.
+A TCP remote address is an ephemeral port, so the dialer
+first sends its advertised address and the accepting side
+reports that as the conn's RemoteAddr (the peer's NodeKey).
+*/
+type Transport struct {
+	listener net.Listener
+	addr     protocol.NodeKey
+
+	accepted  chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen starts accepting on listenAddr. advertiseAddr is the address peers
+// dial to reach us; when empty the listener's address is used.
+func Listen(listenAddr string, advertiseAddr string) (*Transport, error) {
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if advertiseAddr == "" {
+		advertiseAddr = l.Addr().String()
+	}
+	if len(advertiseAddr) > maxAddrLength {
+		l.Close()
+		return nil, fmt.Errorf("advertise address too long")
+	}
+
+	t := &Transport{
+		listener: l,
+		addr:     protocol.NodeKey(advertiseAddr),
+		accepted: make(chan net.Conn),
+		closed:   make(chan struct{}),
+	}
+
+	go t.acceptLoop()
+
+	return t, nil
+}
+
+// Addr returns the NodeKey other transports dial to reach this one.
+func (t *Transport) Addr() protocol.NodeKey {
+	return t.addr
+}
+
+func (t *Transport) acceptLoop() {
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.closed:
+				return
+			default:
+			}
+			log.Printf("tcp accept error: %v", err)
+			continue
+		}
+
+		go t.handshake(c)
+	}
+}
+
+// handshake reads the dialer's advertised address before handing the conn
+// to Accept, so a slow peer cannot stall other incoming sessions.
+func (t *Transport) handshake(c net.Conn) {
+	_ = c.SetReadDeadline(time.Now().Add(preambleTimeout))
+
+	var length uint8
+	if err := binary.Read(c, binary.BigEndian, &length); err != nil {
+		c.Close()
+		return
+	}
+	remote := make([]byte, length)
+	if _, err := io.ReadFull(c, remote); err != nil || length == 0 {
+		c.Close()
+		return
+	}
+
+	_ = c.SetReadDeadline(time.Time{})
+
+	select {
+	case t.accepted <- &identifiedConn{Conn: c, remote: tcpAddr(remote), claimed: true}:
+	case <-t.closed:
+		c.Close()
+	}
+}
+
+func (t *Transport) Dial(peer protocol.NodeKey) (net.Conn, error) {
+	select {
+	case <-t.closed:
+		return nil, ErrClosed
+	default:
+	}
+
+	c, err := net.DialTimeout("tcp", string(peer), time.Duration(config.DialTimeoutMs)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	preamble := append([]byte{byte(len(t.addr))}, t.addr...)
+	if _, err := c.Write(preamble); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return &identifiedConn{Conn: c, remote: tcpAddr(peer)}, nil
+}
+
+func (t *Transport) Accept() (net.Conn, error) {
+	select {
+	case c := <-t.accepted:
+		return c, nil
+	case <-t.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (t *Transport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		err = t.listener.Close()
+	})
+	return err
+}
+
+type tcpAddr string
+
+func (a tcpAddr) Network() string { return "tcp" }
+func (a tcpAddr) String() string  { return string(a) }
+
+// identifiedConn reports the peer's advertised address as RemoteAddr.
+type identifiedConn struct {
+	net.Conn
+	remote tcpAddr
+	// Set on accepted conns, whose address is only what the dialer sent
+	claimed bool
+}
+
+func (c *identifiedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// IdentityClaimed reports whether the remote address was sent by the peer
+// rather than dialed by us, so it may not be the peer's.
+func (c *identifiedConn) IdentityClaimed() bool {
+	return c.claimed
+}
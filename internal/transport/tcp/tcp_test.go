@@ -0,0 +1,63 @@
+package tcptransport
+
+import (
+	"io"
+	"testing"
+)
+
+func TestTCPDialAccept(t *testing.T) {
+	a, err := Listen("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	b, err := Listen("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	dialed, err := a.Dial(b.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close()
+
+	if _, err := dialed.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	accepted, err := b.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accepted.Close()
+
+	if got := accepted.RemoteAddr().String(); got != string(a.Addr()) {
+		t.Fatalf("accepted conn should report dialer address %s, got %s", a.Addr(), got)
+	}
+	if !accepted.(*identifiedConn).IdentityClaimed() {
+		t.Fatalf("the dialer's address is only claimed on the accepting side")
+	}
+	if dialed.(*identifiedConn).IdentityClaimed() {
+		t.Fatalf("a dialed address is the one we connected to")
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(accepted, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("expected hello, got %q (%v)", buf, err)
+	}
+}
+
+func TestTCPAcceptAfterClose(t *testing.T) {
+	a, err := Listen("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Close()
+	if _, err := a.Accept(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
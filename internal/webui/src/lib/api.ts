@@ -1,14 +1,69 @@
 import type {
+  AuthStatus,
   HiddenCountResponse,
   SeedConfig,
   BaoActionKind,
   BaoActionResponse,
+  BaoDetail,
   BaoStatus,
+  BandwidthLimits,
+  ClientConfig,
+  DownloadStrategy,
+  QueueConfig,
+  QueueMove,
+  RuntimeConfig,
+  StreamEvent,
+  StreamEventType,
   UploadBaoResponse,
 } from "./types";
 
+// Thrown when the API needs a token and the session has none.
+export class UnauthorizedError extends Error {}
+
+export async function fetchAuthStatus(): Promise<AuthStatus> {
+  const res = await fetch("/api/v1/auth/session");
+  if (!res.ok) {
+    throw new Error("failed to fetch auth status");
+  }
+
+  return res.json();
+}
+
+// Exchanges an API token for a session cookie.
+export async function login(token: string): Promise<AuthStatus> {
+  const res = await fetch("/api/v1/auth/login", {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ token }),
+  });
+
+  if (res.status === 401) {
+    throw new Error("Invalid token");
+  }
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to log in");
+  }
+
+  return res.json();
+}
+
+export async function logout(): Promise<AuthStatus> {
+  const res = await fetch("/api/v1/auth/logout", { method: "POST" });
+  if (!res.ok) {
+    throw new Error("failed to log out");
+  }
+
+  return res.json();
+}
+
 export async function fetchBaos(): Promise<BaoStatus[]> {
   const res = await fetch("/api/v1/baos");
+  if (res.status === 401) {
+    throw new UnauthorizedError("login required");
+  }
   if (!res.ok) {
     throw new Error("failed to fetch baos");
   }
@@ -28,6 +83,60 @@ export async function fetchBaos(): Promise<BaoStatus[]> {
   })) as BaoStatus[];
 }
 
+const STREAM_EVENT_TYPES: StreamEventType[] = [
+  "added",
+  "removed",
+  "paused",
+  "resumed",
+  "completed",
+  "error",
+  "queued",
+  "started",
+  "peer_connected",
+  "peer_disconnected",
+  "unit_completed",
+  "announced",
+  "progress",
+];
+
+// Listens to /api/v1/events until the returned function is called. The
+// browser reconnects on its own; onStatus reports whether the stream is up.
+export function subscribeEvents(
+  onEvent: (event: StreamEvent) => void,
+  onStatus: (connected: boolean) => void
+): () => void {
+  const source = new EventSource("/api/v1/events");
+
+  const listener = (message: MessageEvent) => {
+    try {
+      onEvent(JSON.parse(message.data) as StreamEvent);
+    } catch {
+      // Ignore malformed messages; the next poll catches up.
+    }
+  };
+  for (const type of STREAM_EVENT_TYPES) {
+    source.addEventListener(type, listener);
+  }
+  source.onopen = () => onStatus(true);
+  source.onerror = () => onStatus(false);
+
+  return () => source.close();
+}
+
+export async function fetchBaoDetail(id: string): Promise<BaoDetail> {
+  const res = await fetch(`/api/v1/baos/${encodeURIComponent(id)}`);
+  if (!res.ok) {
+    throw new Error("failed to fetch bao detail");
+  }
+
+  return res.json();
+}
+
+// URL of the bao's file, playable while it downloads (supports HTTP Range).
+export function baoContentUrl(id: string): string {
+  return `/api/v1/baos/${encodeURIComponent(id)}/content`;
+}
+
 export async function uploadBao(
   fileName: string,
   data: Uint8Array
@@ -49,6 +158,22 @@ export async function uploadBao(
   return res.json();
 }
 
+// Joins a swarm from a bao: link; the node fetches the .bao from peers.
+export async function addBaoUri(uri: string): Promise<UploadBaoResponse> {
+  const res = await fetch("/api/v1/bao", {
+    method: "POST",
+    headers: { "Content-Type": "text/plain" },
+    body: uri.trim(),
+  });
+
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to add bao link");
+  }
+
+  return res.json();
+}
+
 export async function fetchSeedConfig(): Promise<SeedConfig> {
   const res = await fetch("/api/v1/config/seeds");
   if (!res.ok) {
@@ -113,6 +238,149 @@ export async function applyBaoAction(
   return res.json();
 }
 
+export async function setBaoStrategy(
+  ids: string[],
+  strategy: DownloadStrategy,
+  options: { position?: number; window?: number } = {}
+): Promise<BaoActionResponse> {
+  const res = await fetch("/api/v1/baos/actions/strategy", {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ ids, strategy, ...options }),
+  });
+
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to set download strategy");
+  }
+
+  return res.json();
+}
+
+export async function moveBaos(
+  ids: string[],
+  move: QueueMove
+): Promise<BaoActionResponse> {
+  const res = await fetch("/api/v1/baos/actions/queue", {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ ids, move }),
+  });
+
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to move baos");
+  }
+
+  return res.json();
+}
+
+export async function fetchClientConfig(): Promise<ClientConfig> {
+  const res = await fetch("/api/v1/config");
+  if (!res.ok) {
+    throw new Error("failed to fetch config");
+  }
+  return res.json();
+}
+
+export async function saveRuntimeConfig(
+  config: RuntimeConfig
+): Promise<ClientConfig> {
+  const res = await fetch("/api/v1/config", {
+    method: "PUT",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(config),
+  });
+
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to save config");
+  }
+
+  return res.json();
+}
+
+export async function fetchQueueConfig(): Promise<QueueConfig> {
+  const res = await fetch("/api/v1/config/queue");
+  if (!res.ok) {
+    throw new Error("failed to fetch queue config");
+  }
+  return res.json();
+}
+
+export async function saveQueueConfig(
+  config: QueueConfig
+): Promise<QueueConfig> {
+  const res = await fetch("/api/v1/config/queue", {
+    method: "PUT",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(config),
+  });
+
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to save queue config");
+  }
+
+  return res.json();
+}
+
+export async function setBaoLimits(
+  ids: string[],
+  upload: number,
+  download: number
+): Promise<BaoActionResponse> {
+  const res = await fetch("/api/v1/baos/actions/limits", {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ ids, upload, download }),
+  });
+
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to set bandwidth limits");
+  }
+
+  return res.json();
+}
+
+export async function fetchBandwidthLimits(): Promise<BandwidthLimits> {
+  const res = await fetch("/api/v1/config/limits");
+  if (!res.ok) {
+    throw new Error("failed to fetch bandwidth limits");
+  }
+  return res.json();
+}
+
+export async function saveBandwidthLimits(
+  limits: BandwidthLimits
+): Promise<BandwidthLimits> {
+  const res = await fetch("/api/v1/config/limits", {
+    method: "PUT",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(limits),
+  });
+
+  if (!res.ok) {
+    const text = await res.text();
+    throw new Error(text || "failed to save bandwidth limits");
+  }
+
+  return res.json();
+}
+
 export async function unhideBaos(
   passkey: string
 ): Promise<BaoActionResponse> {
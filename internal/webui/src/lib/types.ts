@@ -20,8 +20,143 @@ export interface BaoStatus {
   state: BaoState;
   fileSize: number;
   remaining: number;
+  strategy: DownloadStrategy;
+  playbackPosition: number; // bytes
+  publisher?: string; // hex key of the verified .bao signer
+  uri: string;        // bao: link for sharing the swarm
+  queuePosition: number; // 0-based, decides which queued baos start first
+  uploadLimit: number;   // bytes/sec, 0 = unlimited
+  downloadLimit: number; // bytes/sec, 0 = unlimited
 }
 
+// GET /api/v1/baos/{id}. Bitfields are base64, unit 0 being the high bit of
+// the first byte.
+export interface BaoDetail extends Omit<BaoStatus, "peers"> {
+  unitCount: number;
+  unitSize: number;   // bytes
+  have: string;       // units we have
+  haveCount: number;
+  advertised: string; // units peers are told we have
+  advertisedCount: number;
+  proven: string;     // units with a cached proof
+  provenCount: number;
+  availability: number[]; // connected peers advertising each unit
+  requests: RequestStatus[];
+  peers: PeerDetail[];
+}
+
+export interface RequestStatus {
+  unit: number;
+  peer: string;
+  sentAt: number;     // Unix milliseconds
+  age: number;        // milliseconds
+  attempts: number;
+  duplicate: boolean; // endgame copy of a request sent to another peer
+}
+
+export interface PeerDetail extends PeerStatus {
+  uploaded: number;   // bytes sent to the peer
+  downloaded: number; // bytes received from it
+  units: number;      // units the peer advertises
+  completion: number; // 0..1
+  outstanding: number; // our requests it has yet to answer
+  connectedFor: number; // milliseconds
+}
+
+// One message on /api/v1/events; fields beyond type, id and time depend on
+// the type.
+export type StreamEventType =
+  | "added"
+  | "removed"
+  | "paused"
+  | "resumed"
+  | "completed"
+  | "error"
+  | "queued"
+  | "started"
+  | "peer_connected"
+  | "peer_disconnected"
+  | "unit_completed"
+  | "announced"
+  | "progress";
+
+export interface StreamEvent {
+  type: StreamEventType;
+  id: string;
+  time: number; // Unix milliseconds
+  state?: BaoState;
+  peer?: string;
+  unit?: number;
+  tracker?: string;
+  peers?: number; // peers the tracker returned
+  error?: string;
+  progress?: BaoProgress;
+}
+
+export interface BaoProgress {
+  downloaded: number;
+  uploaded: number;
+  remaining: number;
+  fileSize: number;
+  downRate: number;
+  upRate: number;
+}
+
+export type QueueMove = "top" | "up" | "down" | "bottom";
+
+// How many baos may download and seed at once (0 = unlimited).
+// Settings in effect; only runtime can change without a restart.
+export interface ClientConfig {
+  configFile: string;
+  listen: string;
+  dataDir: string;
+  identity?: string;
+  tls: boolean;
+  nodes: { listen: string; dataDir: string }[];
+  seedRpcServers: string[];
+  multiClientNumClients: number;
+  transferUnitSize: number;
+  runtime: RuntimeConfig;
+}
+
+export interface RuntimeConfig {
+  activeTransfersPerPeer: number;
+  activeTransfersTotal: number;
+  transferRequestTimeout: string; // Go duration, e.g. "60s"
+}
+
+export interface QueueConfig {
+  maxActiveDownloads: number;
+  maxActiveSeeds: number;
+}
+
+// Client-wide limits in bytes/sec (0 = unlimited); peer limits apply per peer.
+export interface BandwidthLimits {
+  upload: number;
+  download: number;
+  peerUpload: number;
+  peerDownload: number;
+  schedule: LimitScheduleEntry[];
+  activeUpload?: number;   // in force now, read only
+  activeDownload?: number;
+}
+
+// Replaces the client-wide limits between start and end ("HH:MM") on the
+// given days (0 = Sunday), or every day when days is empty.
+export interface LimitScheduleEntry {
+  days?: number[];
+  start: string;
+  end: string;
+  upload: number;
+  download: number;
+}
+
+export type DownloadStrategy =
+  | "random"
+  | "rarest-first"
+  | "sequential"
+  | "streaming";
+
 export interface FileStatus {
   path: string;
   length: number;
@@ -33,6 +168,10 @@ export interface PeerStatus {
   state: string;
   downRate: number;   // bytes/sec
   upRate: number;     // bytes/sec
+  choking: boolean;   // we refuse the peer's requests
+  choked: boolean;    // the peer refuses ours
+  interested: boolean;
+  peerInterested: boolean;
 }
 
 export interface SeedConfig {
@@ -47,7 +186,7 @@ export interface UploadBaoResponse {
   name: string;
 }
 
-export type BaoActionKind = "pause" | "archive" | "delete" | "hide";
+export type BaoActionKind = "pause" | "resume" | "archive" | "delete" | "hide";
 
 export interface BaoActionResponse {
   processed: number;
@@ -60,3 +199,13 @@ export interface BaoActionResponse {
 export interface HiddenCountResponse {
   count: number;
 }
+
+export type TokenScope = "read" | "admin";
+
+// /api/v1/auth/*: whether the API needs a token and the caller's token.
+export interface AuthStatus {
+  required: boolean;
+  authenticated: boolean;
+  name?: string;
+  scope?: TokenScope;
+}
@@ -5,7 +5,7 @@ export default defineConfig({
   plugins: [svelte()],
   server: {
     proxy: {
-      "/api": "http://localhost:8880"
+      "/api": "http://localhost:8888"
     }
   }
 });
@@ -13,6 +13,19 @@ const (
 	MsgRequest   PeerMessageType = "request"
 	MsgTransfer  PeerMessageType = "transfer"
 	MsgReject    PeerMessageType = "reject"
+	MsgCancel    PeerMessageType = "cancel"
+
+	MsgMetadataRequest PeerMessageType = "metadata_request"
+	MsgMetadata        PeerMessageType = "metadata"
+	MsgPex             PeerMessageType = "pex"
+	MsgDHTQuery        PeerMessageType = "dht_query"
+	MsgDHTResponse     PeerMessageType = "dht_response"
+
+	// Choking and interest carry no payload
+	MsgChoke         PeerMessageType = "choke"
+	MsgUnchoke       PeerMessageType = "unchoke"
+	MsgInterested    PeerMessageType = "interested"
+	MsgNotInterested PeerMessageType = "not_interested"
 )
 
 type PeerMessage struct {
@@ -53,6 +66,53 @@ type RejectPayload struct {
 	Reason    string `json:"reason,omitempty"`
 }
 
+// Reasons a seeder gives in a RejectPayload
+const (
+	RejectNoProof    = "no_proof"   // has the unit but cannot prove it yet
+	RejectNotHave    = "not_have"   // does not have the unit
+	RejectOverloaded = "overloaded" // upload queue is full, retry later
+	RejectPaused     = "paused"     // swarm is paused, retry later
+	RejectChoked     = "choked"     // requester is choked, wait for an unchoke
+)
+
+// CancelPayload withdraws an earlier request, e.g. once another peer's copy
+// of the unit has been verified during endgame.
+type CancelPayload struct {
+	UnitIndex uint64 `json:"unit_index"`
+}
+
+// MetadataPayload answers a MsgMetadataRequest with the .bao JSON for the
+// message's InfoHash. Data is empty if the peer does not have it.
+type MetadataPayload struct {
+	Data []byte `json:"data,omitempty"`
+}
+
+// PexPayload lists other peers the sender is connected to in the same swarm.
+type PexPayload struct {
+	Peers []Peer `json:"peers"`
+}
+
+// DHT methods carried in DHTPayload.Method
+const (
+	DHTPing         = "ping"
+	DHTFindNode     = "find_node"
+	DHTGetPeers     = "get_peers"
+	DHTAnnouncePeer = "announce_peer"
+)
+
+// DHTPayload is a DHT query or its response. Responses echo the query's
+// TransactionID and carry the closest nodes to Target the responder knows,
+// plus the peers it stores for Target on get_peers.
+type DHTPayload struct {
+	TransactionID uint64    `json:"transaction_id"`
+	Method        string    `json:"method"`
+	Target        []byte    `json:"target,omitempty"`
+	Seeder        bool      `json:"seeder,omitempty"`
+	Nodes         []NodeKey `json:"nodes,omitempty"`
+	Peers         []Peer    `json:"peers,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
 // TransferPayload includes the segment data and its Bao proof
 type TransferPayload struct {
 	UnitIndex uint64 `json:"unit_index"`
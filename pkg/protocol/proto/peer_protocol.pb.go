@@ -25,31 +25,61 @@ const (
 type PeerMessageType int32
 
 const (
-	PeerMessageType_MSG_HANDSHAKE PeerMessageType = 0
-	PeerMessageType_MSG_BITFIELD  PeerMessageType = 1
-	PeerMessageType_MSG_HAVE      PeerMessageType = 2
-	PeerMessageType_MSG_REQUEST   PeerMessageType = 3
-	PeerMessageType_MSG_TRANSFER  PeerMessageType = 4
-	PeerMessageType_MSG_REJECT    PeerMessageType = 5
+	PeerMessageType_MSG_HANDSHAKE        PeerMessageType = 0
+	PeerMessageType_MSG_BITFIELD         PeerMessageType = 1
+	PeerMessageType_MSG_HAVE             PeerMessageType = 2
+	PeerMessageType_MSG_REQUEST          PeerMessageType = 3
+	PeerMessageType_MSG_TRANSFER         PeerMessageType = 4
+	PeerMessageType_MSG_REJECT           PeerMessageType = 5
+	PeerMessageType_MSG_CANCEL           PeerMessageType = 6
+	PeerMessageType_MSG_METADATA_REQUEST PeerMessageType = 7
+	PeerMessageType_MSG_METADATA         PeerMessageType = 8
+	PeerMessageType_MSG_PEX              PeerMessageType = 9
+	PeerMessageType_MSG_DHT_QUERY        PeerMessageType = 10
+	PeerMessageType_MSG_DHT_RESPONSE     PeerMessageType = 11
+	PeerMessageType_MSG_CHOKE            PeerMessageType = 12
+	PeerMessageType_MSG_UNCHOKE          PeerMessageType = 13
+	PeerMessageType_MSG_INTERESTED       PeerMessageType = 14
+	PeerMessageType_MSG_NOT_INTERESTED   PeerMessageType = 15
 )
 
 // Enum value maps for PeerMessageType.
 var (
 	PeerMessageType_name = map[int32]string{
-		0: "MSG_HANDSHAKE",
-		1: "MSG_BITFIELD",
-		2: "MSG_HAVE",
-		3: "MSG_REQUEST",
-		4: "MSG_TRANSFER",
-		5: "MSG_REJECT",
+		0:  "MSG_HANDSHAKE",
+		1:  "MSG_BITFIELD",
+		2:  "MSG_HAVE",
+		3:  "MSG_REQUEST",
+		4:  "MSG_TRANSFER",
+		5:  "MSG_REJECT",
+		6:  "MSG_CANCEL",
+		7:  "MSG_METADATA_REQUEST",
+		8:  "MSG_METADATA",
+		9:  "MSG_PEX",
+		10: "MSG_DHT_QUERY",
+		11: "MSG_DHT_RESPONSE",
+		12: "MSG_CHOKE",
+		13: "MSG_UNCHOKE",
+		14: "MSG_INTERESTED",
+		15: "MSG_NOT_INTERESTED",
 	}
 	PeerMessageType_value = map[string]int32{
-		"MSG_HANDSHAKE": 0,
-		"MSG_BITFIELD":  1,
-		"MSG_HAVE":      2,
-		"MSG_REQUEST":   3,
-		"MSG_TRANSFER":  4,
-		"MSG_REJECT":    5,
+		"MSG_HANDSHAKE":        0,
+		"MSG_BITFIELD":         1,
+		"MSG_HAVE":             2,
+		"MSG_REQUEST":          3,
+		"MSG_TRANSFER":         4,
+		"MSG_REJECT":           5,
+		"MSG_CANCEL":           6,
+		"MSG_METADATA_REQUEST": 7,
+		"MSG_METADATA":         8,
+		"MSG_PEX":              9,
+		"MSG_DHT_QUERY":        10,
+		"MSG_DHT_RESPONSE":     11,
+		"MSG_CHOKE":            12,
+		"MSG_UNCHOKE":          13,
+		"MSG_INTERESTED":       14,
+		"MSG_NOT_INTERESTED":   15,
 	}
 )
 
@@ -555,6 +585,286 @@ func (x *RejectPayload) GetReason() string {
 	return ""
 }
 
+// CancelPayload structure
+type CancelPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UnitIndex     uint64                 `protobuf:"varint,1,opt,name=unit_index,json=unitIndex,proto3" json:"unit_index,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelPayload) Reset() {
+	*x = CancelPayload{}
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelPayload) ProtoMessage() {}
+
+func (x *CancelPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelPayload.ProtoReflect.Descriptor instead.
+func (*CancelPayload) Descriptor() ([]byte, []int) {
+	return file_pkg_protocol_proto_peer_protocol_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CancelPayload) GetUnitIndex() uint64 {
+	if x != nil {
+		return x.UnitIndex
+	}
+	return 0
+}
+
+// MetadataPayload structure
+type MetadataPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"` // .bao JSON, empty if the peer does not have it
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataPayload) Reset() {
+	*x = MetadataPayload{}
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataPayload) ProtoMessage() {}
+
+func (x *MetadataPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataPayload.ProtoReflect.Descriptor instead.
+func (*MetadataPayload) Descriptor() ([]byte, []int) {
+	return file_pkg_protocol_proto_peer_protocol_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *MetadataPayload) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// PexPayload structure
+type PexPeer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeKey       string                 `protobuf:"bytes,1,opt,name=node_key,json=nodeKey,proto3" json:"node_key,omitempty"`
+	IsSeeder      bool                   `protobuf:"varint,2,opt,name=is_seeder,json=isSeeder,proto3" json:"is_seeder,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PexPeer) Reset() {
+	*x = PexPeer{}
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PexPeer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PexPeer) ProtoMessage() {}
+
+func (x *PexPeer) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PexPeer.ProtoReflect.Descriptor instead.
+func (*PexPeer) Descriptor() ([]byte, []int) {
+	return file_pkg_protocol_proto_peer_protocol_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PexPeer) GetNodeKey() string {
+	if x != nil {
+		return x.NodeKey
+	}
+	return ""
+}
+
+func (x *PexPeer) GetIsSeeder() bool {
+	if x != nil {
+		return x.IsSeeder
+	}
+	return false
+}
+
+type PexPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Peers         []*PexPeer             `protobuf:"bytes,1,rep,name=peers,proto3" json:"peers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PexPayload) Reset() {
+	*x = PexPayload{}
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PexPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PexPayload) ProtoMessage() {}
+
+func (x *PexPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PexPayload.ProtoReflect.Descriptor instead.
+func (*PexPayload) Descriptor() ([]byte, []int) {
+	return file_pkg_protocol_proto_peer_protocol_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *PexPayload) GetPeers() []*PexPeer {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+// DhtPayload structure, used for both queries and responses
+type DhtPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransactionId uint64                 `protobuf:"varint,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	Method        string                 `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`  // ping, find_node, get_peers, announce_peer
+	Target        []byte                 `protobuf:"bytes,3,opt,name=target,proto3" json:"target,omitempty"`  // node ID or InfoHash
+	Seeder        bool                   `protobuf:"varint,4,opt,name=seeder,proto3" json:"seeder,omitempty"` // announce_peer only
+	Nodes         []string               `protobuf:"bytes,5,rep,name=nodes,proto3" json:"nodes,omitempty"`    // closest known nodes to target
+	Peers         []*PexPeer             `protobuf:"bytes,6,rep,name=peers,proto3" json:"peers,omitempty"`    // get_peers only
+	Error         string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DhtPayload) Reset() {
+	*x = DhtPayload{}
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DhtPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DhtPayload) ProtoMessage() {}
+
+func (x *DhtPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_protocol_proto_peer_protocol_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DhtPayload.ProtoReflect.Descriptor instead.
+func (*DhtPayload) Descriptor() ([]byte, []int) {
+	return file_pkg_protocol_proto_peer_protocol_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DhtPayload) GetTransactionId() uint64 {
+	if x != nil {
+		return x.TransactionId
+	}
+	return 0
+}
+
+func (x *DhtPayload) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *DhtPayload) GetTarget() []byte {
+	if x != nil {
+		return x.Target
+	}
+	return nil
+}
+
+func (x *DhtPayload) GetSeeder() bool {
+	if x != nil {
+		return x.Seeder
+	}
+	return false
+}
+
+func (x *DhtPayload) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *DhtPayload) GetPeers() []*PexPeer {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+func (x *DhtPayload) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 var File_pkg_protocol_proto_peer_protocol_proto protoreflect.FileDescriptor
 
 const file_pkg_protocol_proto_peer_protocol_proto_rawDesc = "" +
@@ -592,7 +902,27 @@ const file_pkg_protocol_proto_peer_protocol_proto_rawDesc = "" +
 	"\rRejectPayload\x12\x1d\n" +
 	"\n" +
 	"unit_index\x18\x01 \x01(\x04R\tunitIndex\x12\x16\n" +
-	"\x06reason\x18\x02 \x01(\tR\x06reason*w\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\".\n" +
+	"\rCancelPayload\x12\x1d\n" +
+	"\n" +
+	"unit_index\x18\x01 \x01(\x04R\tunitIndex\"%\n" +
+	"\x0fMetadataPayload\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"A\n" +
+	"\aPexPeer\x12\x19\n" +
+	"\bnode_key\x18\x01 \x01(\tR\anodeKey\x12\x1b\n" +
+	"\tis_seeder\x18\x02 \x01(\bR\bisSeeder\"5\n" +
+	"\n" +
+	"PexPayload\x12'\n" +
+	"\x05peers\x18\x01 \x03(\v2\x11.protocol.PexPeerR\x05peers\"\xd0\x01\n" +
+	"\n" +
+	"DhtPayload\x12%\n" +
+	"\x0etransaction_id\x18\x01 \x01(\x04R\rtransactionId\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\x12\x16\n" +
+	"\x06target\x18\x03 \x01(\fR\x06target\x12\x16\n" +
+	"\x06seeder\x18\x04 \x01(\bR\x06seeder\x12\x14\n" +
+	"\x05nodes\x18\x05 \x03(\tR\x05nodes\x12'\n" +
+	"\x05peers\x18\x06 \x03(\v2\x11.protocol.PexPeerR\x05peers\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error*\xb5\x02\n" +
 	"\x0fPeerMessageType\x12\x11\n" +
 	"\rMSG_HANDSHAKE\x10\x00\x12\x10\n" +
 	"\fMSG_BITFIELD\x10\x01\x12\f\n" +
@@ -600,7 +930,19 @@ const file_pkg_protocol_proto_peer_protocol_proto_rawDesc = "" +
 	"\vMSG_REQUEST\x10\x03\x12\x10\n" +
 	"\fMSG_TRANSFER\x10\x04\x12\x0e\n" +
 	"\n" +
-	"MSG_REJECT\x10\x05B/Z-github.com/baoswarm/baobun/pkg/protocol/protob\x06proto3"
+	"MSG_REJECT\x10\x05\x12\x0e\n" +
+	"\n" +
+	"MSG_CANCEL\x10\x06\x12\x18\n" +
+	"\x14MSG_METADATA_REQUEST\x10\a\x12\x10\n" +
+	"\fMSG_METADATA\x10\b\x12\v\n" +
+	"\aMSG_PEX\x10\t\x12\x11\n" +
+	"\rMSG_DHT_QUERY\x10\n" +
+	"\x12\x14\n" +
+	"\x10MSG_DHT_RESPONSE\x10\v\x12\r\n" +
+	"\tMSG_CHOKE\x10\f\x12\x0f\n" +
+	"\vMSG_UNCHOKE\x10\r\x12\x12\n" +
+	"\x0eMSG_INTERESTED\x10\x0e\x12\x16\n" +
+	"\x12MSG_NOT_INTERESTED\x10\x0fB/Z-github.com/baoswarm/baobun/pkg/protocol/protob\x06proto3"
 
 var (
 	file_pkg_protocol_proto_peer_protocol_proto_rawDescOnce sync.Once
@@ -615,7 +957,7 @@ func file_pkg_protocol_proto_peer_protocol_proto_rawDescGZIP() []byte {
 }
 
 var file_pkg_protocol_proto_peer_protocol_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_pkg_protocol_proto_peer_protocol_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_pkg_protocol_proto_peer_protocol_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
 var file_pkg_protocol_proto_peer_protocol_proto_goTypes = []any{
 	(PeerMessageType)(0),           // 0: protocol.PeerMessageType
 	(*PeerMessage)(nil),            // 1: protocol.PeerMessage
@@ -627,16 +969,23 @@ var file_pkg_protocol_proto_peer_protocol_proto_goTypes = []any{
 	(*BaoProof)(nil),               // 7: protocol.BaoProof
 	(*TransferPayload)(nil),        // 8: protocol.TransferPayload
 	(*RejectPayload)(nil),          // 9: protocol.RejectPayload
+	(*CancelPayload)(nil),          // 10: protocol.CancelPayload
+	(*MetadataPayload)(nil),        // 11: protocol.MetadataPayload
+	(*PexPeer)(nil),                // 12: protocol.PexPeer
+	(*PexPayload)(nil),             // 13: protocol.PexPayload
+	(*DhtPayload)(nil),             // 14: protocol.DhtPayload
 }
 var file_pkg_protocol_proto_peer_protocol_proto_depIdxs = []int32{
-	0, // 0: protocol.PeerMessage.type:type_name -> protocol.PeerMessageType
-	6, // 1: protocol.BaoProof.proof:type_name -> protocol.BaoProofNode
-	7, // 2: protocol.TransferPayload.proof:type_name -> protocol.BaoProof
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	0,  // 0: protocol.PeerMessage.type:type_name -> protocol.PeerMessageType
+	6,  // 1: protocol.BaoProof.proof:type_name -> protocol.BaoProofNode
+	7,  // 2: protocol.TransferPayload.proof:type_name -> protocol.BaoProof
+	12, // 3: protocol.PexPayload.peers:type_name -> protocol.PexPeer
+	12, // 4: protocol.DhtPayload.peers:type_name -> protocol.PexPeer
+	5,  // [5:5] is the sub-list for method output_type
+	5,  // [5:5] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_pkg_protocol_proto_peer_protocol_proto_init() }
@@ -650,7 +999,7 @@ func file_pkg_protocol_proto_peer_protocol_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_protocol_proto_peer_protocol_proto_rawDesc), len(file_pkg_protocol_proto_peer_protocol_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   9,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   0,
 		},